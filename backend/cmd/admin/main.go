@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"ownthegrid/internal/config"
+	"ownthegrid/internal/db"
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+	"ownthegrid/internal/service"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: admin [grant | revoke] <username>")
+	}
+	flag.Parse()
+
+	role := ""
+	switch flag.Arg(0) {
+	case "grant":
+		role = domain.RoleAdmin
+	case "revoke":
+		role = domain.RoleUser
+	}
+	username := flag.Arg(1)
+	if role == "" || username == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+	pgDB := db.NewPostgres(cfg.DatabaseURL)
+	defer pgDB.Close()
+
+	keys, err := service.NewKeySet(cfg.JwtKeyFiles, cfg.JwtSigningKID, cfg.JwtSecret)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+	userService := service.NewUserService(
+		repository.NewUserRepo(pgDB),
+		repository.NewSessionRepo(pgDB),
+		repository.NewCredentialRepo(pgDB),
+		repository.NewAPIKeyRepo(pgDB),
+		nil,
+		nil,
+		keys,
+		cfg.AccessTokenTTL,
+		cfg.RefreshTokenTTL,
+		cfg.APIKeyRate,
+	)
+	user, err := userService.SetRole(context.Background(), username, role)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		log.Fatalf("No user called %q", username)
+	}
+	if err != nil {
+		log.Fatalf("Set role failed: %v", err)
+	}
+
+	fmt.Printf("%s (%s) is now %s\n", user.Username, user.ID, user.Role)
+	if role == domain.RoleAdmin {
+		fmt.Printf("token: %s\nrefresh token: %s\n", user.Token, user.RefreshToken)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/joho/godotenv"
+
+	"ownthegrid/internal/db"
+	"ownthegrid/migrations"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: migrate [up | down [steps] | status]")
+	}
+	flag.Parse()
+
+	_ = godotenv.Load()
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		log.Fatal("DATABASE_URL is required")
+	}
+
+	pgDB := db.NewPostgres(databaseURL)
+	defer pgDB.Close()
+
+	command := flag.Arg(0)
+	if command == "" {
+		command = "up"
+	}
+
+	switch command {
+	case "up":
+		if err := db.Migrate(pgDB, migrations.FS); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+	case "down":
+		steps := 1
+		if arg := flag.Arg(1); arg != "" {
+			parsed, err := strconv.Atoi(arg)
+			if err != nil || parsed < 1 {
+				log.Fatal("steps must be a positive integer")
+			}
+			steps = parsed
+		}
+		if err := db.MigrateDown(pgDB, migrations.FS, steps); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+	case "status":
+		all, err := db.LoadMigrations(migrations.FS)
+		if err != nil {
+			log.Fatalf("Load migrations: %v", err)
+		}
+		applied, err := db.AppliedVersions(context.Background(), pgDB)
+		if err != nil {
+			log.Fatalf("Load status: %v", err)
+		}
+		for _, m := range all {
+			state := "pending"
+			if applied[m.Version] {
+				state = "applied"
+			}
+			fmt.Printf("%03d_%s\t%s\n", m.Version, m.Name, state)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -12,14 +12,18 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 
 	"ownthegrid/internal/config"
 	"ownthegrid/internal/db"
+	"ownthegrid/internal/domain"
 	httphandler "ownthegrid/internal/handler/http"
 	"ownthegrid/internal/handler/ws"
 	"ownthegrid/internal/pubsub"
 	"ownthegrid/internal/repository"
 	"ownthegrid/internal/service"
+	"ownthegrid/migrations"
 )
 
 func main() {
@@ -28,8 +32,8 @@ func main() {
 	pgDB := db.NewPostgres(cfg.DatabaseURL)
 	defer pgDB.Close()
 
-	if err := db.Migrate(pgDB); err != nil {
-		log.Printf("Warning: Migration failed: %v", err)
+	if err := db.Migrate(pgDB, migrations.FS); err != nil {
+		log.Fatalf("Migration failed: %v", err)
 	}
 
 	redisClient := db.NewRedis(cfg.RedisURL)
@@ -37,42 +41,109 @@ func main() {
 
 	tileRepo := repository.NewTileRepo(pgDB)
 	userRepo := repository.NewUserRepo(pgDB)
+	boardRepo := repository.NewBoardRepo(pgDB)
+	eventRepo := repository.NewEventRepo(pgDB)
+	teamRepo := repository.NewTeamRepo(pgDB)
+	seasonRepo := repository.NewSeasonRepo(pgDB)
+	auditRepo := repository.NewAuditRepo(pgDB)
+	sessionRepo := repository.NewSessionRepo(pgDB)
+	credentialRepo := repository.NewCredentialRepo(pgDB)
+	apiKeyRepo := repository.NewAPIKeyRepo(pgDB)
 
 	redisStore := service.NewRedisStore(redisClient)
-	tileService := service.NewTileService(tileRepo, redisStore, cfg.GridWidth, cfg.GridHeight)
-	userService := service.NewUserService(userRepo, redisStore, cfg.JwtSecret, cfg.TokenTTL)
+	captureRules := domain.CaptureRules{
+		Enabled:          cfg.CaptureEnabled,
+		ProtectionWindow: cfg.CaptureProtection,
+		RequireAdjacent:  cfg.CaptureAdjacent,
+		Cost:             cfg.CaptureCost,
+	}
+	claimLimiter := service.NewClaimLimiter(redisStore, cfg.ClaimRatePerSecond, cfg.ClaimBurst, cfg.ClaimCooldown)
+	boardService := service.NewBoardService(boardRepo)
+	tileService := service.NewTileService(tileRepo, boardService, redisStore, captureRules, claimLimiter)
+	instanceID := cfg.InstanceID
+	if instanceID == "" {
+		instanceID = uuid.NewString()
+	}
+	presence := service.NewPresence(redisStore, instanceID, cfg.PresenceTTL)
+	keys, err := service.NewKeySet(cfg.JwtKeyFiles, cfg.JwtSigningKID, cfg.JwtSecret)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+	userService := service.NewUserService(
+		userRepo,
+		sessionRepo,
+		credentialRepo,
+		apiKeyRepo,
+		redisStore,
+		presence,
+		keys,
+		cfg.AccessTokenTTL,
+		cfg.RefreshTokenTTL,
+		cfg.APIKeyRate,
+	)
+	historyService := service.NewHistoryService(eventRepo, boardService)
+	leaderboardService := service.NewLeaderboardService(tileRepo, userRepo, teamRepo, boardService, redisStore)
+	teamService := service.NewTeamService(teamRepo, boardService, leaderboardService)
+	seasonService := service.NewSeasonService(seasonRepo, boardService, leaderboardService, cfg.SeasonLength)
+	adminService := service.NewAdminService(userRepo, tileService, boardService, leaderboardService, auditRepo)
 
-	if err := tileService.SeedIfNeeded(context.Background()); err != nil {
-		log.Printf("Warning: Failed to seed tiles: %v", err)
+	if _, err := boardService.EnsureDefault(context.Background(), cfg.GridWidth, cfg.GridHeight); err != nil {
+		log.Fatalf("Failed to seed default board: %v", err)
 	}
 
-	hub := ws.NewHub()
+	wsOptions := ws.Options{
+		Compression:     cfg.WSCompression,
+		MaxBatch:        cfg.WSMaxBatch,
+		SlowConsumer:    ws.SlowConsumerPolicy(cfg.SlowConsumerPolicy),
+		Shards:          cfg.HubShards,
+		AllowedOrigins:  cfg.ClientOrigins,
+		AllowQueryToken: cfg.WSQueryToken,
+	}
+	hub := ws.NewHub(wsOptions)
 	go hub.Run()
 
-	publisher := pubsub.NewRedisPublisher(redisClient, pubsub.BoardEventsChannel)
-	subscriber := pubsub.NewRedisSubscriber(redisClient, hub, pubsub.BoardEventsChannel)
+	publisher, eventLog, subscriber := newBroadcast(cfg, redisClient, hub)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go subscriber.Subscribe(ctx)
 
-	go startLeaderboardTicker(ctx, userService, publisher, cfg.LeaderboardInterval, cfg.LeaderboardLimit)
+	control := pubsub.NewControlBus(redisClient)
+	go control.Subscribe(ctx, hub)
+
+	leaders := service.NewLeaderElection(redisStore, instanceID, cfg.LeaderLease)
+
+	go leaders.Run(ctx, "leaderboard", func(ctx context.Context) {
+		startLeaderboardTicker(ctx, boardService, userService, leaderboardService, publisher, cfg.LeaderboardInterval, cfg.LeaderboardLimit)
+	})
+
+	go leaders.Run(ctx, "leaderboard-reconcile", func(ctx context.Context) {
+		startLeaderboardReconcile(ctx, boardService, leaderboardService, cfg.ReconcileInterval)
+	})
+
+	go leaders.Run(ctx, "seasons", func(ctx context.Context) {
+		startSeasonScheduler(ctx, boardService, seasonService, publisher, cfg.SeasonCheckInterval, cfg.LeaderboardLimit)
+	})
 
-	go startStaleConnectionCleanup(ctx, hub, userService, publisher)
+	go startPresenceHeartbeat(ctx, hub, presence, cfg.PresenceHeartbeat)
+
+	go leaders.Run(ctx, "presence-eviction", func(ctx context.Context) {
+		startStalePresenceEviction(ctx, presence, boardService, userService, publisher, cfg.PresenceHeartbeat)
+	})
 
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.Use(httphandler.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{cfg.ClientOrigin},
+		AllowedOrigins:   cfg.ClientOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
-	httphandler.Mount(r, tileService, userService)
-	r.Get("/ws", ws.NewHandler(hub, tileService, userService, publisher).ServeHTTP)
+	httphandler.Mount(r, tileService, userService, boardService, historyService, leaderboardService, teamService, seasonService, adminService, publisher, control, hub)
+	r.Get("/ws", ws.NewHandler(hub, tileService, userService, boardService, publisher, eventLog, wsOptions).ServeHTTP)
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -104,14 +175,32 @@ func main() {
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
+	if err := presence.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Presence shutdown error: %v", err)
+	}
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Shutdown error: %v", err)
 	}
 }
 
+func newBroadcast(
+	cfg config.Config,
+	client *redis.Client,
+	hub *ws.Hub,
+) (pubsub.Publisher, pubsub.EventLog, pubsub.Subscriber) {
+	if cfg.BroadcastBackend == "streams" {
+		publisher := pubsub.NewStreamPublisher(client, cfg.ReplayBufferSize, cfg.StreamMaxLen)
+		return publisher, publisher, pubsub.NewStreamSubscriber(client, hub)
+	}
+	publisher := pubsub.NewRedisPublisher(client, cfg.ReplayBufferSize)
+	return publisher, publisher, pubsub.NewRedisSubscriber(client, hub)
+}
+
 func startLeaderboardTicker(
 	ctx context.Context,
+	boardService *service.BoardService,
 	userService *service.UserService,
+	leaderboardService *service.LeaderboardService,
 	publisher pubsub.Publisher,
 	interval time.Duration,
 	limit int,
@@ -127,28 +216,80 @@ func startLeaderboardTicker(
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			leaderboard, err := userService.GetLeaderboard(ctx, limit)
+			boards, err := boardService.List(ctx)
 			if err != nil {
 				log.Printf("Leaderboard update failed: %v", err)
 				continue
 			}
-			payload := map[string]interface{}{
-				"leaderboard": leaderboard,
-			}
-			if err := publisher.Publish(ctx, ws.MsgTypeLeaderboardUpdate, payload); err != nil {
-				log.Printf("Leaderboard publish failed: %v", err)
+			for _, board := range boards {
+				publishLeaderboard(ctx, board.ID, userService, leaderboardService, publisher, limit)
 			}
 		}
 	}
 }
 
-func startStaleConnectionCleanup(
+func publishLeaderboard(
 	ctx context.Context,
-	hub *ws.Hub,
+	boardID string,
 	userService *service.UserService,
+	leaderboardService *service.LeaderboardService,
 	publisher pubsub.Publisher,
+	limit int,
+) {
+	if onlineCount, err := userService.OnlineCount(ctx, boardID); err == nil && onlineCount == 0 {
+		return
+	}
+	leaderboard, err := leaderboardService.Top(ctx, boardID, limit)
+	if err != nil {
+		log.Printf("Leaderboard update failed for board %s: %v", boardID, err)
+		return
+	}
+	teams, err := leaderboardService.TopTeams(ctx, boardID, limit)
+	if err != nil {
+		log.Printf("Team leaderboard update failed for board %s: %v", boardID, err)
+		teams = []domain.TeamLeaderboardEntry{}
+	}
+	payload := map[string]interface{}{
+		"leaderboard": leaderboard,
+		"teams":       teams,
+	}
+	if err := publisher.Publish(ctx, boardID, ws.MsgTypeLeaderboardUpdate, payload); err != nil {
+		log.Printf("Leaderboard publish failed for board %s: %v", boardID, err)
+	}
+}
+
+// startLeaderboardReconcile rebuilds every board's leaderboard set from
+// Postgres straight away, then rebuilds any set that has drifted every
+// interval.
+func startLeaderboardReconcile(
+	ctx context.Context,
+	boardService *service.BoardService,
+	leaderboardService *service.LeaderboardService,
+	interval time.Duration,
 ) {
-	ticker := time.NewTicker(15 * time.Second)
+	reconcile := func(force bool) {
+		boards, err := boardService.List(ctx)
+		if err != nil {
+			log.Printf("Leaderboard reconcile: failed to list boards: %v", err)
+			return
+		}
+		for _, board := range boards {
+			rebuilt, err := leaderboardService.Reconcile(ctx, board.ID, force)
+			if err != nil {
+				log.Printf("Leaderboard reconcile failed for board %s: %v", board.ID, err)
+				continue
+			}
+			if rebuilt && !force {
+				log.Printf("Leaderboard reconcile: rebuilt drifted leaderboard for board %s", board.ID)
+			}
+		}
+	}
+
+	reconcile(true)
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
@@ -156,48 +297,198 @@ func startStaleConnectionCleanup(
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			cleanupStaleRedisEntries(ctx, hub, userService, publisher)
+			reconcile(false)
 		}
 	}
 }
 
-func cleanupStaleRedisEntries(
+// startSeasonScheduler starts a season on boards without one and ends
+// seasons whose time is up, checking every interval.
+func startSeasonScheduler(
 	ctx context.Context,
-	hub *ws.Hub,
-	userService *service.UserService,
+	boardService *service.BoardService,
+	seasonService *service.SeasonService,
+	publisher pubsub.Publisher,
+	interval time.Duration,
+	limit int,
+) {
+	check := func() {
+		boards, err := boardService.List(ctx)
+		if err != nil {
+			log.Printf("Seasons: failed to list boards: %v", err)
+			return
+		}
+		for _, board := range boards {
+			advanceSeason(ctx, board.ID, seasonService, publisher, limit)
+		}
+	}
+
+	check()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+func advanceSeason(
+	ctx context.Context,
+	boardID string,
+	seasonService *service.SeasonService,
 	publisher pubsub.Publisher,
+	limit int,
 ) {
-	redisUsers, err := userService.ListOnlineUsers(ctx)
+	current, err := seasonService.Current(ctx, boardID)
 	if err != nil {
-		log.Printf("Stale cleanup: failed to list online users: %v", err)
+		log.Printf("Seasons: failed to load season for board %s: %v", boardID, err)
+		return
+	}
+
+	if current == nil {
+		if !seasonService.Enabled() {
+			return
+		}
+		started, err := seasonService.Start(ctx, boardID)
+		if err != nil {
+			log.Printf("Seasons: failed to start season on board %s: %v", boardID, err)
+			return
+		}
+		if started != nil {
+			publishSeasonStarted(ctx, started, publisher)
+		}
+		return
+	}
+	if time.Now().Before(current.EndsAt) {
 		return
 	}
 
-	if len(redisUsers) == 0 {
+	// End only fails after committing when the leaderboard rebuild does, in
+	// which case the reset still has to be announced.
+	ended, next, err := seasonService.End(ctx, current)
+	if err != nil {
+		log.Printf("Seasons: failed to end season %d on board %s: %v", current.Number, boardID, err)
+	}
+	if ended == nil {
 		return
 	}
+	log.Printf("Seasons: season %d on board %s ended", ended.Number, boardID)
+
+	results, err := seasonService.Results(ctx, ended.ID)
+	if err != nil {
+		log.Printf("Seasons: failed to load results of season %d on board %s: %v", ended.Number, boardID, err)
+		results = &domain.SeasonResults{
+			Season:      ended,
+			Leaderboard: []domain.LeaderboardEntry{},
+			Teams:       []domain.TeamLeaderboardEntry{},
+		}
+	}
+	payload := map[string]interface{}{
+		"season":      results.Season,
+		"leaderboard": results.Leaderboard[:min(limit, len(results.Leaderboard))],
+		"teams":       results.Teams[:min(limit, len(results.Teams))],
+	}
+	if err := publisher.Publish(ctx, boardID, ws.MsgTypeSeasonEnded, payload); err != nil {
+		log.Printf("Seasons: failed to publish SEASON_ENDED: %v", err)
+	}
+	if next != nil {
+		publishSeasonStarted(ctx, next, publisher)
+	}
+}
 
-	connectedIDs := make(map[string]bool)
-	for _, id := range hub.GetConnectedUserIDs() {
-		connectedIDs[id] = true
+func publishSeasonStarted(ctx context.Context, season *domain.Season, publisher pubsub.Publisher) {
+	payload := map[string]interface{}{
+		"season": season,
 	}
+	if err := publisher.Publish(ctx, season.BoardID, ws.MsgTypeSeasonStarted, payload); err != nil {
+		log.Printf("Seasons: failed to publish SEASON_STARTED: %v", err)
+	}
+}
+
+func startPresenceHeartbeat(
+	ctx context.Context,
+	hub *ws.Hub,
+	presence *service.Presence,
+	interval time.Duration,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	for _, user := range redisUsers {
-		if !connectedIDs[user.ID.String()] {
-			log.Printf("Stale cleanup: removing stale user %s (%s) from online set", user.ID, user.Username)
-			if err := userService.SetOffline(ctx, user.ID); err != nil {
-				log.Printf("Stale cleanup: failed to set offline: %v", err)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := presence.Heartbeat(ctx, hub.ConnectedUsersByBoard()); err != nil {
+				log.Printf("Presence heartbeat failed: %v", err)
+			}
+		}
+	}
+}
+
+func startStalePresenceEviction(
+	ctx context.Context,
+	presence *service.Presence,
+	boardService *service.BoardService,
+	userService *service.UserService,
+	publisher pubsub.Publisher,
+	interval time.Duration,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			boards, err := boardService.List(ctx)
+			if err != nil {
+				log.Printf("Stale presence: failed to list boards: %v", err)
 				continue
 			}
-			onlineCount, _ := userService.OnlineCount(ctx)
-			payload := map[string]interface{}{
-				"userId":      user.ID.String(),
-				"username":    user.Username,
-				"onlineCount": onlineCount,
+			for _, board := range boards {
+				evictStalePresence(ctx, board.ID, userService, publisher)
 			}
-			if err := publisher.Publish(ctx, ws.MsgTypeUserLeft, payload); err != nil {
-				log.Printf("Stale cleanup: failed to publish USER_LEFT: %v", err)
+			if err := presence.PruneInstances(ctx); err != nil {
+				log.Printf("Stale presence: %v", err)
 			}
 		}
 	}
 }
+
+// evictStalePresence drops users held online only by instances that stopped
+// heartbeating and announces their departure.
+func evictStalePresence(
+	ctx context.Context,
+	boardID string,
+	userService *service.UserService,
+	publisher pubsub.Publisher,
+) {
+	evicted, err := userService.EvictStalePresence(ctx, boardID)
+	if err != nil {
+		log.Printf("Stale presence: eviction failed for board %s: %v", boardID, err)
+		return
+	}
+	if len(evicted) == 0 {
+		return
+	}
+
+	onlineCount, _ := userService.OnlineCount(ctx, boardID)
+	for _, user := range evicted {
+		log.Printf("Stale presence: removing user %s (%s) from board %s", user.ID, user.Username, boardID)
+		payload := map[string]interface{}{
+			"userId":      user.ID.String(),
+			"username":    user.Username,
+			"onlineCount": onlineCount,
+		}
+		if err := publisher.Publish(ctx, boardID, ws.MsgTypeUserLeft, payload); err != nil {
+			log.Printf("Stale presence: failed to publish USER_LEFT: %v", err)
+		}
+	}
+}
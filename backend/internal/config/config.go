@@ -1,9 +1,11 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -17,42 +19,189 @@ func init() {
 
 type Config struct {
 	Port                string
-	ClientOrigin        string
+	ClientOrigins       []string
 	DatabaseURL         string
 	RedisURL            string
 	JwtSecret           string
+	JwtKeyFiles         []string
+	JwtSigningKID       string
 	GridWidth           int
 	GridHeight          int
-	TokenTTL            time.Duration
+	AccessTokenTTL      time.Duration
+	RefreshTokenTTL     time.Duration
+	APIKeyRate          int
 	LeaderboardInterval time.Duration
 	LeaderboardLimit    int
+	ReconcileInterval   time.Duration
+	CaptureEnabled      bool
+	CaptureProtection   time.Duration
+	CaptureAdjacent     bool
+	CaptureCost         int
+	ClaimCooldown       time.Duration
+	ClaimRatePerSecond  int
+	ClaimBurst          int
+	ReplayBufferSize    int
+	BroadcastBackend    string
+	StreamMaxLen        int
+	InstanceID          string
+	PresenceHeartbeat   time.Duration
+	PresenceTTL         time.Duration
+	LeaderLease         time.Duration
+	WSCompression       bool
+	WSQueryToken        bool
+	WSMaxBatch          int
+	SlowConsumerPolicy  string
+	HubShards           int
+	SeasonLength        time.Duration
+	SeasonCheckInterval time.Duration
 }
 
 func Load() Config {
 	cfg := Config{
 		Port:                getEnv("PORT", "8080"),
-		ClientOrigin:        getEnv("CLIENT_ORIGIN", "http://localhost:5173"),
+		ClientOrigins:       getEnvList("CLIENT_ORIGIN"),
 		DatabaseURL:         requireEnv("DATABASE_URL"),
 		RedisURL:            requireEnv("REDIS_URL"),
-		JwtSecret:           requireEnv("JWT_SECRET"),
+		JwtSecret:           getEnv("JWT_SECRET", ""),
+		JwtKeyFiles:         getEnvList("JWT_KEY_FILES"),
+		JwtSigningKID:       getEnv("JWT_SIGNING_KID", ""),
 		GridWidth:           getEnvInt("GRID_WIDTH", 50),
 		GridHeight:          getEnvInt("GRID_HEIGHT", 40),
-		TokenTTL:            time.Duration(getEnvInt("TOKEN_TTL_HOURS", 168)) * time.Hour,
+		AccessTokenTTL:      time.Duration(getEnvInt("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute,
+		RefreshTokenTTL:     time.Duration(getEnvInt("REFRESH_TOKEN_TTL_HOURS", 720)) * time.Hour,
+		APIKeyRate:          getEnvInt("API_KEY_RATE_PER_MINUTE", 120),
 		LeaderboardInterval: time.Duration(getEnvInt("LEADERBOARD_INTERVAL_SECONDS", 10)) * time.Second,
 		LeaderboardLimit:    getEnvInt("LEADERBOARD_LIMIT", 10),
+		ReconcileInterval:   time.Duration(getEnvInt("LEADERBOARD_RECONCILE_SECONDS", 300)) * time.Second,
+		CaptureEnabled:      getEnvBool("CAPTURE_ENABLED", false),
+		CaptureProtection:   time.Duration(getEnvInt("CAPTURE_PROTECTION_SECONDS", 30)) * time.Second,
+		CaptureAdjacent:     getEnvBool("CAPTURE_REQUIRE_ADJACENT", false),
+		CaptureCost:         getEnvInt("CAPTURE_COST", 3),
+		ClaimCooldown:       time.Duration(getEnvInt("CLAIM_COOLDOWN_MS", 250)) * time.Millisecond,
+		ClaimRatePerSecond:  getEnvInt("CLAIM_RATE_PER_SECOND", 2),
+		ClaimBurst:          getEnvInt("CLAIM_BURST", 10),
+		ReplayBufferSize:    getEnvInt("REPLAY_BUFFER_SIZE", 1000),
+		BroadcastBackend:    getEnv("BROADCAST_BACKEND", "pubsub"),
+		StreamMaxLen:        getEnvInt("STREAM_MAX_LEN", 10000),
+		InstanceID:          getEnv("INSTANCE_ID", ""),
+		PresenceHeartbeat:   time.Duration(getEnvInt("PRESENCE_HEARTBEAT_SECONDS", 10)) * time.Second,
+		PresenceTTL:         time.Duration(getEnvInt("PRESENCE_TTL_SECONDS", 30)) * time.Second,
+		LeaderLease:         time.Duration(getEnvInt("LEADER_LEASE_SECONDS", 15)) * time.Second,
+		WSCompression:       getEnvBool("WS_COMPRESSION", true),
+		WSQueryToken:        getEnvBool("WS_QUERY_TOKEN", false),
+		WSMaxBatch:          getEnvInt("WS_MAX_BATCH", 64),
+		SlowConsumerPolicy:  getEnv("SLOW_CONSUMER_POLICY", "disconnect"),
+		HubShards:           getEnvInt("WS_HUB_SHARDS", 0),
+		SeasonLength:        time.Duration(getEnvInt("SEASON_LENGTH_HOURS", 0)) * time.Hour,
+		SeasonCheckInterval: time.Duration(getEnvInt("SEASON_CHECK_SECONDS", 30)) * time.Second,
 	}
 
-	if len(cfg.JwtSecret) < 32 {
-		log.Fatal("JWT_SECRET must be at least 32 characters")
+	if len(cfg.ClientOrigins) == 0 {
+		cfg.ClientOrigins = []string{"http://localhost:5173"}
 	}
 
-	if cfg.GridWidth <= 0 || cfg.GridHeight <= 0 {
-		log.Fatal("GRID_WIDTH and GRID_HEIGHT must be positive")
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
 	}
 
 	return cfg
 }
 
+// Validate reports the first setting that is out of range or inconsistent
+// with another.
+func (c Config) Validate() error {
+	if len(c.JwtKeyFiles) == 0 && c.JwtSecret == "" {
+		return errors.New("JWT_SECRET or JWT_KEY_FILES is required")
+	}
+
+	if c.JwtSecret != "" && len(c.JwtSecret) < 32 {
+		return errors.New("JWT_SECRET must be at least 32 characters")
+	}
+
+	if c.AccessTokenTTL <= 0 || c.RefreshTokenTTL < c.AccessTokenTTL {
+		return errors.New("ACCESS_TOKEN_TTL_MINUTES must be positive and no longer than REFRESH_TOKEN_TTL_HOURS")
+	}
+
+	if c.APIKeyRate < 1 {
+		return errors.New("API_KEY_RATE_PER_MINUTE must be at least 1")
+	}
+
+	if c.GridWidth <= 0 || c.GridHeight <= 0 {
+		return errors.New("GRID_WIDTH and GRID_HEIGHT must be positive")
+	}
+
+	if c.CaptureProtection < 0 {
+		return errors.New("CAPTURE_PROTECTION_SECONDS must not be negative")
+	}
+
+	if c.CaptureCost < 1 {
+		return errors.New("CAPTURE_COST must be at least 1")
+	}
+
+	if c.ClaimCooldown < 0 || c.ClaimRatePerSecond < 0 {
+		return errors.New("CLAIM_COOLDOWN_MS and CLAIM_RATE_PER_SECOND must not be negative")
+	}
+
+	if c.ClaimRatePerSecond > 0 && c.ClaimBurst < 1 {
+		return errors.New("CLAIM_BURST must be at least 1 when rate limiting is enabled")
+	}
+
+	if c.ReplayBufferSize < 0 {
+		return errors.New("REPLAY_BUFFER_SIZE must not be negative")
+	}
+
+	if c.BroadcastBackend != "pubsub" && c.BroadcastBackend != "streams" {
+		return errors.New("BROADCAST_BACKEND must be pubsub or streams")
+	}
+
+	if c.StreamMaxLen <= 0 {
+		return errors.New("STREAM_MAX_LEN must be positive")
+	}
+
+	if c.PresenceHeartbeat <= 0 || c.PresenceTTL <= c.PresenceHeartbeat {
+		return errors.New("PRESENCE_HEARTBEAT_SECONDS must be positive and below PRESENCE_TTL_SECONDS")
+	}
+
+	if c.LeaderLease < 3*time.Second {
+		return errors.New("LEADER_LEASE_SECONDS must be at least 3")
+	}
+
+	if c.WSMaxBatch < 1 {
+		return errors.New("WS_MAX_BATCH must be at least 1")
+	}
+
+	if c.HubShards < 0 {
+		return errors.New("WS_HUB_SHARDS must not be negative")
+	}
+
+	if c.SeasonLength < 0 {
+		return errors.New("SEASON_LENGTH_HOURS must not be negative")
+	}
+
+	if c.SeasonCheckInterval <= 0 {
+		return errors.New("SEASON_CHECK_SECONDS must be positive")
+	}
+
+	switch c.SlowConsumerPolicy {
+	case "disconnect", "drop-oldest", "collapse":
+	default:
+		return errors.New("SLOW_CONSUMER_POLICY must be disconnect, drop-oldest or collapse")
+	}
+
+	if c.CaptureEnabled && c.CaptureCost > 1 {
+		// The cost is paid in claim limiter tokens, which don't exist
+		// without a refill rate.
+		if c.ClaimRatePerSecond == 0 {
+			return errors.New("CAPTURE_COST above 1 requires CLAIM_RATE_PER_SECOND; set CAPTURE_COST=1 to capture without rate limiting")
+		}
+		if c.CaptureCost > c.ClaimBurst {
+			return errors.New("CAPTURE_COST must not exceed CLAIM_BURST")
+		}
+	}
+
+	return nil
+}
+
 func getEnv(key, fallback string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -69,6 +218,17 @@ func requireEnv(key string) string {
 	return value
 }
 
+// getEnvList splits a comma-separated variable, dropping empty entries.
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getEnvInt(key string, fallback int) int {
 	value := os.Getenv(key)
 	if value == "" {
@@ -80,3 +240,15 @@ func getEnvInt(key string, fallback int) int {
 	}
 	return parsed
 }
+
+func getEnvBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("%s must be a boolean", key)
+	}
+	return parsed
+}
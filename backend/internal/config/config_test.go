@@ -0,0 +1,76 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() Config {
+	return Config{
+		JwtSecret:           strings.Repeat("s", 32),
+		GridWidth:           50,
+		GridHeight:          40,
+		AccessTokenTTL:      15 * time.Minute,
+		RefreshTokenTTL:     720 * time.Hour,
+		APIKeyRate:          120,
+		CaptureProtection:   30 * time.Second,
+		CaptureCost:         3,
+		ClaimCooldown:       250 * time.Millisecond,
+		ClaimRatePerSecond:  2,
+		ClaimBurst:          10,
+		BroadcastBackend:    "pubsub",
+		StreamMaxLen:        10000,
+		PresenceHeartbeat:   10 * time.Second,
+		PresenceTTL:         30 * time.Second,
+		LeaderLease:         15 * time.Second,
+		WSMaxBatch:          64,
+		SlowConsumerPolicy:  "disconnect",
+		SeasonCheckInterval: 30 * time.Second,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		wantErr string
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"capture with the default cost", func(c *Config) { c.CaptureEnabled = true }, ""},
+		{"no signing key", func(c *Config) { c.JwtSecret = "" }, "JWT_SECRET or JWT_KEY_FILES"},
+		{"short secret", func(c *Config) { c.JwtSecret = "short" }, "at least 32 characters"},
+		{"refresh shorter than access", func(c *Config) { c.RefreshTokenTTL = time.Minute }, "ACCESS_TOKEN_TTL_MINUTES"},
+		{"zero capture cost", func(c *Config) { c.CaptureCost = 0 }, "CAPTURE_COST must be at least 1"},
+		{"no burst", func(c *Config) { c.ClaimBurst = 0 }, "CLAIM_BURST"},
+		{"unknown backend", func(c *Config) { c.BroadcastBackend = "kafka" }, "BROADCAST_BACKEND"},
+		{"heartbeat past the TTL", func(c *Config) { c.PresenceHeartbeat = c.PresenceTTL }, "PRESENCE_HEARTBEAT_SECONDS"},
+		{"unknown policy", func(c *Config) { c.SlowConsumerPolicy = "block" }, "SLOW_CONSUMER_POLICY"},
+		{"capture cost without rate limiting", func(c *Config) {
+			c.CaptureEnabled, c.ClaimRatePerSecond = true, 0
+		}, "CAPTURE_COST above 1 requires CLAIM_RATE_PER_SECOND"},
+		{"capture at cost 1 without rate limiting", func(c *Config) {
+			c.CaptureEnabled, c.ClaimRatePerSecond, c.CaptureCost = true, 0, 1
+		}, ""},
+		{"capture cost ignored with capture off", func(c *Config) { c.ClaimRatePerSecond = 0 }, ""},
+		{"capture cost over the burst", func(c *Config) {
+			c.CaptureEnabled, c.CaptureCost = true, 11
+		}, "CAPTURE_COST must not exceed CLAIM_BURST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.change(&c)
+			err := c.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
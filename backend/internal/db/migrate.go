@@ -2,51 +2,213 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"io/fs"
 	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 
 	"github.com/jmoiron/sqlx"
 )
 
-func Migrate(db *sqlx.DB) error {
-	ctx := context.Background()
+// migrationLockID serialises migration runs across instances starting at once.
+const migrationLockID = 7_245_001
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
 
-	migrations := []string{
-		`CREATE EXTENSION IF NOT EXISTS "pgcrypto"`,
-		`CREATE TABLE IF NOT EXISTS users (
-			id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-			username VARCHAR(32) NOT NULL UNIQUE,
-			color CHAR(7) NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-			last_seen TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		)`,
-		`CREATE TABLE IF NOT EXISTS tiles (
-			id INTEGER PRIMARY KEY,
-			x INTEGER NOT NULL,
-			y INTEGER NOT NULL,
-			owner_id UUID REFERENCES users(id) ON DELETE SET NULL,
-			claimed_at TIMESTAMPTZ,
-			UNIQUE (x, y)
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_tiles_owner ON tiles(owner_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_tiles_claimed_at ON tiles(claimed_at)`,
-		`CREATE TABLE IF NOT EXISTS tile_events (
-			id BIGSERIAL PRIMARY KEY,
-			tile_id INTEGER NOT NULL REFERENCES tiles(id),
-			user_id UUID NOT NULL REFERENCES users(id),
-			event_type VARCHAR(16) NOT NULL,
-			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_events_user ON tile_events(user_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_events_created ON tile_events(created_at DESC)`,
-	}
-
-	for _, m := range migrations {
-		if _, err := db.ExecContext(ctx, m); err != nil {
-			log.Printf("Migration warning: %v", err)
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
 			continue
 		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, path.Join(".", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d used by both %q and %q", version, m.Name, match[2])
+		}
+		script := &m.Up
+		if match[3] == "down" {
+			script = &m.Down
+		}
+		if *script != "" {
+			return nil, fmt.Errorf("migration %03d_%s has more than one %s file", version, m.Name, match[3])
+		}
+		*script = string(body)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %03d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrate applies every pending up migration in version order, each in its own
+// transaction. It stops at the first failure.
+func Migrate(db *sqlx.DB, fsys fs.FS) error {
+	ctx := context.Background()
+
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return err
 	}
 
-	log.Println("Database migration completed")
+	return withMigrationLock(ctx, db, func() error {
+		applied, err := AppliedVersions(ctx, db)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if applied[m.Version] {
+				continue
+			}
+			if err := runMigration(ctx, db, m, m.Up, true); err != nil {
+				return err
+			}
+			log.Printf("Applied migration %03d_%s", m.Version, m.Name)
+		}
+
+		log.Println("Database migration completed")
+		return nil
+	})
+}
+
+// MigrateDown reverts the most recently applied migrations, newest first.
+func MigrateDown(db *sqlx.DB, fsys fs.FS, steps int) error {
+	ctx := context.Background()
+
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(ctx, db, func() error {
+		applied, err := AppliedVersions(ctx, db)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if !applied[m.Version] {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %03d_%s has no down file", m.Version, m.Name)
+			}
+			if err := runMigration(ctx, db, m, m.Down, false); err != nil {
+				return err
+			}
+			log.Printf("Reverted migration %03d_%s", m.Version, m.Name)
+			steps--
+		}
+		return nil
+	})
+}
+
+func AppliedVersions(ctx context.Context, db *sqlx.DB) (map[int]bool, error) {
+	if err := ensureMigrationsTable(ctx, db); err != nil {
+		return nil, err
+	}
+	versions := []int{}
+	if err := db.SelectContext(ctx, &versions, `SELECT version FROM schema_migrations`); err != nil {
+		return nil, fmt.Errorf("applied migrations: %w", err)
+	}
+	applied := make(map[int]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
+	return applied, nil
+}
+
+func ensureMigrationsTable(ctx context.Context, db *sqlx.DB) error {
+	query := `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version     INTEGER PRIMARY KEY,
+            name        TEXT NOT NULL,
+            applied_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+        )
+    `
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
 	return nil
 }
+
+func runMigration(ctx context.Context, db *sqlx.DB, m Migration, script string, up bool) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("migration %03d_%s: %w", m.Version, m.Name, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %03d_%s: %w", m.Version, m.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("migration %03d_%s: record: %w", m.Version, m.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration %03d_%s: commit: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+func withMigrationLock(ctx context.Context, db *sqlx.DB, fn func() error) error {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("migration lock: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("migration lock: %w", err)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+	}()
+
+	return fn()
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"ownthegrid/migrations"
+)
+
+func sqlFile(body string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(body)}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []Migration
+		wantErr string
+	}{
+		{
+			name:  "empty",
+			files: fstest.MapFS{},
+			want:  []Migration{},
+		},
+		{
+			name: "sorted by version",
+			files: fstest.MapFS{
+				"010_later.up.sql":    sqlFile("UP 10"),
+				"002_second.up.sql":   sqlFile("UP 2"),
+				"002_second.down.sql": sqlFile("DOWN 2"),
+				"001_first.up.sql":    sqlFile("UP 1"),
+			},
+			want: []Migration{
+				{Version: 1, Name: "first", Up: "UP 1"},
+				{Version: 2, Name: "second", Up: "UP 2", Down: "DOWN 2"},
+				{Version: 10, Name: "later", Up: "UP 10"},
+			},
+		},
+		{
+			name: "other files ignored",
+			files: fstest.MapFS{
+				"001_first.up.sql":     sqlFile("UP 1"),
+				"README.md":            sqlFile("docs"),
+				"001_first.sql":        sqlFile("no direction"),
+				"002_Upper.up.sql":     sqlFile("bad name"),
+				"nested/003_x.up.sql":  sqlFile("in a directory"),
+				"004_draft.up.sql.bak": sqlFile("backup"),
+			},
+			want: []Migration{{Version: 1, Name: "first", Up: "UP 1"}},
+		},
+		{
+			name: "down without up",
+			files: fstest.MapFS{
+				"001_first.down.sql": sqlFile("DOWN 1"),
+			},
+			wantErr: "migration 001_first has no up file",
+		},
+		{
+			name: "version reused",
+			files: fstest.MapFS{
+				"001_first.up.sql": sqlFile("UP 1"),
+				"001_other.up.sql": sqlFile("UP 1 again"),
+			},
+			wantErr: `migration version 1 used by both "first" and "other"`,
+		},
+		{
+			name: "version written two ways",
+			files: fstest.MapFS{
+				"001_first.up.sql": sqlFile("UP 1"),
+				"1_first.up.sql":   sqlFile("UP 1 again"),
+			},
+			wantErr: "migration 001_first has more than one up file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadMigrations(tt.files)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadMigrations() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadMigrations() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("LoadMigrations() = %+v, want %+v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("migration %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestShippedMigrations checks the embedded migrations number from 1 with no
+// gaps and can all be reverted.
+func TestShippedMigrations(t *testing.T) {
+	got, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range got {
+		if m.Version != i+1 {
+			t.Fatalf("migration %03d_%s follows version %d", m.Version, m.Name, i)
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %03d_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
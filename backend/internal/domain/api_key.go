@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Scopes an API key can be granted.
+const (
+	ScopeReadBoard = "read-board"
+	ScopeClaim     = "claim"
+	ScopeAdmin     = "admin"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrScopeDenied    = errors.New("scope not granted")
+)
+
+// APIKey lets a program act as its owner within Scopes, at no more than
+// RatePerMinute requests. Only a hash of the key is stored; Key is set once,
+// when it is created.
+type APIKey struct {
+	ID            uuid.UUID      `db:"id" json:"id"`
+	UserID        uuid.UUID      `db:"user_id" json:"userId"`
+	Name          string         `db:"name" json:"name"`
+	Prefix        string         `db:"prefix" json:"prefix"`
+	Scopes        pq.StringArray `db:"scopes" json:"scopes"`
+	RatePerMinute int            `db:"rate_per_minute" json:"ratePerMinute"`
+	CreatedAt     time.Time      `db:"created_at" json:"createdAt"`
+	LastUsedAt    *time.Time     `db:"last_used_at" json:"lastUsedAt,omitempty"`
+	RevokedAt     *time.Time     `db:"revoked_at" json:"revokedAt,omitempty"`
+	Key           string         `db:"-" json:"key,omitempty"`
+}
+
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeReadBoard, ScopeClaim, ScopeAdmin:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Admin actions recorded in the audit log.
+const (
+	AuditUnclaimTile  = "unclaim_tile"
+	AuditReassignTile = "reassign_tile"
+	AuditBanUser      = "ban_user"
+	AuditUnbanUser    = "unban_user"
+	AuditDisconnect   = "disconnect_user"
+	AuditResetRegion  = "reset_region"
+	AuditAnnouncement = "announcement"
+)
+
+// AuditEntry records one admin action. Target names what was acted on, such
+// as a user id or a tile id; Details holds the action's parameters.
+type AuditEntry struct {
+	ID        int64           `db:"id" json:"id"`
+	AdminID   *uuid.UUID      `db:"admin_id" json:"adminId"`
+	Action    string          `db:"action" json:"action"`
+	BoardID   *string         `db:"board_id" json:"boardId,omitempty"`
+	Target    *string         `db:"target" json:"target,omitempty"`
+	Details   json.RawMessage `db:"details" json:"details"`
+	CreatedAt time.Time       `db:"created_at" json:"createdAt"`
+}
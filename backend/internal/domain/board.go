@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DefaultBoardID = "default"
+
+// MaxBoardDimension caps a board's width and height.
+const MaxBoardDimension = 1000
+
+var (
+	ErrBoardNotFound    = errors.New("board not found")
+	ErrBoardExists      = errors.New("board already exists")
+	ErrBoardIDInvalid   = errors.New("board id must be 1-32 lowercase letters, digits or dashes")
+	ErrBoardNameInvalid = errors.New("board name must be at most 64 characters")
+	ErrBoardSizeInvalid = errors.New("board dimensions are out of range")
+)
+
+type Board struct {
+	ID        string     `db:"id" json:"id"`
+	Name      string     `db:"name" json:"name"`
+	Width     int        `db:"width" json:"width"`
+	Height    int        `db:"height" json:"height"`
+	CreatedBy *uuid.UUID `db:"created_by" json:"createdBy,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"createdAt"`
+}
+
+func (b *Board) TileCount() int {
+	return b.Width * b.Height
+}
+
+func (b *Board) Contains(tileID int) bool {
+	return tileID >= 0 && tileID < b.TileCount()
+}
@@ -0,0 +1,37 @@
+package domain
+
+import "errors"
+
+// ChunkSize is the edge length of the square chunks a board is split into
+// for caching and spatial fan-out.
+const ChunkSize = 32
+
+var ErrChunkNotFound = errors.New("chunk not found")
+
+// Chunk is one ChunkSize x ChunkSize region of a board. Version is bumped by
+// every claim inside it.
+type Chunk struct {
+	BoardID string
+	CX      int
+	CY      int
+	Bounds  Viewport
+	Version int64
+	Tiles   []*Tile
+}
+
+func ChunkOf(x, y int) (cx, cy int) {
+	return x / ChunkSize, y / ChunkSize
+}
+
+// ChunkBounds returns the tiles covered by chunk cx, cy, trimmed to the
+// board. ok is false when the chunk lies off the board.
+func (b *Board) ChunkBounds(cx, cy int) (Viewport, bool) {
+	if cx < 0 || cy < 0 {
+		return Viewport{}, false
+	}
+	x, y := cx*ChunkSize, cy*ChunkSize
+	if x >= b.Width || y >= b.Height {
+		return Viewport{}, false
+	}
+	return Viewport{X: x, Y: y, W: min(ChunkSize, b.Width-x), H: min(ChunkSize, b.Height-y)}, true
+}
@@ -0,0 +1,23 @@
+package domain
+
+import "github.com/google/uuid"
+
+// LeaderboardEntry is a user's standing on a board. Users with the same tile
+// count share a rank (1, 2, 2, 4).
+type LeaderboardEntry struct {
+	UserID    uuid.UUID `db:"user_id" json:"userId"`
+	Username  string    `db:"username" json:"username"`
+	Color     string    `db:"color" json:"color"`
+	TileCount int       `db:"tile_count" json:"tileCount"`
+	Rank      int       `db:"rank" json:"rank"`
+}
+
+// TeamLeaderboardEntry is a team's standing on a board: the tiles owned by
+// its current members. Ranks are shared the same way as for users.
+type TeamLeaderboardEntry struct {
+	TeamID    uuid.UUID `db:"team_id" json:"teamId"`
+	Name      string    `db:"name" json:"name"`
+	Color     *string   `db:"color" json:"color"`
+	TileCount int       `db:"tile_count" json:"tileCount"`
+	Rank      int       `db:"rank" json:"rank"`
+}
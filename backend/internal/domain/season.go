@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrSeasonNotFound = errors.New("season not found")
+	ErrSeasonEnded    = errors.New("season has already ended")
+)
+
+// Season is one round of play on a board. EndedAt is set once the season
+// has been archived and the board reset; until then it is the board's
+// current season.
+type Season struct {
+	ID       int64      `db:"id" json:"id"`
+	BoardID  string     `db:"board_id" json:"boardId"`
+	Number   int        `db:"number" json:"number"`
+	StartsAt time.Time  `db:"starts_at" json:"startsAt"`
+	EndsAt   time.Time  `db:"ends_at" json:"endsAt"`
+	EndedAt  *time.Time `db:"ended_at" json:"endedAt,omitempty"`
+
+	// Winners and WinningTeams hold everyone ranked first in an ended
+	// season.
+	Winners      []LeaderboardEntry     `json:"winners,omitempty"`
+	WinningTeams []TeamLeaderboardEntry `json:"winningTeams,omitempty"`
+}
+
+// SeasonResults is an ended season's archived final standings.
+type SeasonResults struct {
+	Season      *Season                `json:"season"`
+	Leaderboard []LeaderboardEntry     `json:"leaderboard"`
+	Teams       []TeamLeaderboardEntry `json:"teams"`
+}
@@ -0,0 +1,34 @@
+package domain
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTokenInvalid = errors.New("invalid token")
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+// Session is one sign-in: the chain of refresh tokens issued from a single
+// registration or login, and the access tokens minted from them.
+type Session struct {
+	ID     uuid.UUID `db:"session_id"`
+	UserID uuid.UUID `db:"user_id"`
+}
+
+// TokenReuseError reports a refresh token presented after it had already
+// been rotated. The token may have leaked, so its whole session has been
+// revoked.
+type TokenReuseError struct {
+	Session Session
+}
+
+func (e *TokenReuseError) Error() string {
+	return "refresh token reused"
+}
+
+func (e *TokenReuseError) Unwrap() error {
+	return ErrTokenRevoked
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTeamNotFound = errors.New("team not found")
+	ErrTeamExists   = errors.New("team already exists")
+	ErrNotInTeam    = errors.New("user is not in a team")
+)
+
+// Team groups users under one name. When Color is set it replaces the
+// members' own colors on the tiles they own.
+type Team struct {
+	ID          uuid.UUID  `db:"id" json:"id"`
+	Name        string     `db:"name" json:"name"`
+	Color       *string    `db:"color" json:"color"`
+	CreatedBy   *uuid.UUID `db:"created_by" json:"createdBy,omitempty"`
+	CreatedAt   time.Time  `db:"created_at" json:"createdAt"`
+	MemberCount int        `db:"member_count" json:"memberCount"`
+	Members     []*User    `json:"members,omitempty"`
+}
@@ -10,8 +10,23 @@ import (
 var (
 	ErrTileInvalid        = errors.New("tile ID is out of range")
 	ErrTileAlreadyClaimed = errors.New("tile is already claimed")
+	ErrTileProtected      = errors.New("tile is protected from capture")
+	ErrTileNotAdjacent    = errors.New("capture requires an adjacent owned tile")
+	ErrRateLimited        = errors.New("claim rate limit exceeded")
 )
 
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return ErrRateLimited.Error()
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
 type Tile struct {
 	ID            int        `db:"id" json:"id"`
 	X             int        `db:"x" json:"x"`
@@ -20,9 +35,42 @@ type Tile struct {
 	ClaimedAt     *time.Time `db:"claimed_at" json:"claimedAt"`
 	OwnerUsername *string    `db:"owner_username" json:"ownerUsername,omitempty"`
 	OwnerColor    *string    `db:"owner_color" json:"ownerColor,omitempty"`
+	OwnerTeamID   *uuid.UUID `db:"owner_team_id" json:"ownerTeamId,omitempty"`
+	OwnerTeamName *string    `db:"owner_team_name" json:"ownerTeamName,omitempty"`
 }
 
 type ClaimRequest struct {
 	TileID int       `json:"tileId"`
 	UserID uuid.UUID `json:"userId"`
 }
+
+type CaptureRules struct {
+	Enabled          bool
+	ProtectionWindow time.Duration
+	RequireAdjacent  bool
+	Cost             int
+}
+
+type ClaimResult struct {
+	Tile            *Tile
+	PreviousOwnerID *uuid.UUID
+	PreviousTeamID  *uuid.UUID
+	ChunkVersion    int64
+}
+
+func (r *ClaimResult) Captured() bool {
+	return r.PreviousOwnerID != nil
+}
+
+type TileEvent struct {
+	ID        int64     `db:"id" json:"id"`
+	BoardID   string    `db:"board_id" json:"boardId"`
+	TileID    int       `db:"tile_id" json:"tileId"`
+	X         int       `db:"x" json:"x"`
+	Y         int       `db:"y" json:"y"`
+	UserID    uuid.UUID `db:"user_id" json:"userId"`
+	Username  string    `db:"username" json:"username"`
+	Color     string    `db:"color" json:"color"`
+	EventType string    `db:"event_type" json:"eventType"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
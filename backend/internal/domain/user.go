@@ -1,20 +1,45 @@
 package domain
 
 import (
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserBanned         = errors.New("user is banned")
+	ErrInvalidCredentials = errors.New("invalid username or credentials")
+)
+
+// User is also what the public user endpoints return, so the role and ban
+// are left out of its JSON; admin routes add them back.
 type User struct {
-	ID         uuid.UUID `db:"id" json:"id"`
-	Username   string    `db:"username" json:"username"`
-	Color      string    `db:"color" json:"color"`
-	CreatedAt  time.Time `db:"created_at" json:"createdAt"`
-	LastSeen   time.Time `db:"last_seen" json:"lastSeen"`
-	ClaimCount int       `json:"claimCount,omitempty"`
-	IsOnline   bool      `json:"isOnline,omitempty"`
-	Token      string    `json:"token,omitempty"`
+	ID             uuid.UUID  `db:"id" json:"id"`
+	Username       string     `db:"username" json:"username"`
+	Color          string     `db:"color" json:"color"`
+	TeamID         *uuid.UUID `db:"team_id" json:"teamId,omitempty"`
+	Role           string     `db:"role" json:"-"`
+	BannedAt       *time.Time `db:"banned_at" json:"-"`
+	BanReason      *string    `db:"ban_reason" json:"-"`
+	CreatedAt      time.Time  `db:"created_at" json:"createdAt"`
+	LastSeen       time.Time  `db:"last_seen" json:"lastSeen"`
+	ClaimCount     int        `json:"claimCount,omitempty"`
+	IsOnline       bool       `json:"isOnline,omitempty"`
+	Token          string     `json:"token,omitempty"`
+	TokenExpiresAt *time.Time `json:"tokenExpiresAt,omitempty"`
+	RefreshToken   string     `json:"refreshToken,omitempty"`
+	RecoveryCodes  []string   `json:"recoveryCodes,omitempty"`
+}
+
+func (u *User) Banned() bool {
+	return u.BannedAt != nil
 }
 
 var ColorPalette = []string{
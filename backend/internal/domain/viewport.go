@@ -0,0 +1,34 @@
+package domain
+
+import "errors"
+
+// MaxViewportTiles caps how many tiles a single viewport may cover.
+const MaxViewportTiles = 256 * 256
+
+var ErrViewportInvalid = errors.New("invalid viewport")
+
+// Viewport is the rectangle of a board a client is looking at.
+type Viewport struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+func (v Viewport) Contains(x, y int) bool {
+	return x >= v.X && x < v.X+v.W && y >= v.Y && y < v.Y+v.H
+}
+
+// ClampTo trims the viewport to the board's bounds. It fails when the
+// viewport is empty, lies entirely off the board or exceeds MaxViewportTiles.
+func (v Viewport) ClampTo(b *Board) (Viewport, error) {
+	if v.W <= 0 || v.H <= 0 || v.W > MaxViewportTiles || v.H > MaxViewportTiles || v.W*v.H > MaxViewportTiles {
+		return Viewport{}, ErrViewportInvalid
+	}
+	x0, y0 := max(v.X, 0), max(v.Y, 0)
+	x1, y1 := min(v.X+v.W, b.Width), min(v.Y+v.H, b.Height)
+	if x0 >= x1 || y0 >= y1 {
+		return Viewport{}, ErrViewportInvalid
+	}
+	return Viewport{X: x0, Y: y0, W: x1 - x0, H: y1 - y0}, nil
+}
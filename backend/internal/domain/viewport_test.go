@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestViewportClampTo(t *testing.T) {
+	board := &Board{Width: 100, Height: 50}
+	tests := []struct {
+		name    string
+		in      Viewport
+		want    Viewport
+		wantErr error
+	}{
+		{"inside", Viewport{X: 10, Y: 10, W: 20, H: 5}, Viewport{X: 10, Y: 10, W: 20, H: 5}, nil},
+		{"whole board", Viewport{X: 0, Y: 0, W: 100, H: 50}, Viewport{X: 0, Y: 0, W: 100, H: 50}, nil},
+		{"past right and bottom", Viewport{X: 90, Y: 40, W: 20, H: 20}, Viewport{X: 90, Y: 40, W: 10, H: 10}, nil},
+		{"past left and top", Viewport{X: -5, Y: -5, W: 10, H: 10}, Viewport{X: 0, Y: 0, W: 5, H: 5}, nil},
+		{"covers the board", Viewport{X: -10, Y: -10, W: 200, H: 200}, Viewport{X: 0, Y: 0, W: 100, H: 50}, nil},
+		{"single tile", Viewport{X: 99, Y: 49, W: 1, H: 1}, Viewport{X: 99, Y: 49, W: 1, H: 1}, nil},
+		{"zero width", Viewport{X: 0, Y: 0, W: 0, H: 10}, Viewport{}, ErrViewportInvalid},
+		{"negative height", Viewport{X: 0, Y: 0, W: 10, H: -1}, Viewport{}, ErrViewportInvalid},
+		{"off the right", Viewport{X: 100, Y: 0, W: 10, H: 10}, Viewport{}, ErrViewportInvalid},
+		{"off the top", Viewport{X: 0, Y: -10, W: 10, H: 10}, Viewport{}, ErrViewportInvalid},
+		{"largest", Viewport{X: 0, Y: 0, W: 256, H: 256}, Viewport{X: 0, Y: 0, W: 100, H: 50}, nil},
+		{"too many tiles", Viewport{X: 0, Y: 0, W: 257, H: 256}, Viewport{}, ErrViewportInvalid},
+		{"overflowing area", Viewport{X: 0, Y: 0, W: 1 << 32, H: 1 << 32}, Viewport{}, ErrViewportInvalid},
+		{"overflowing edge", Viewport{X: math.MaxInt, Y: 0, W: 10, H: 10}, Viewport{}, ErrViewportInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.in.ClampTo(board)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ClampTo() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("ClampTo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/handler/ws"
+	"ownthegrid/internal/pubsub"
+	"ownthegrid/internal/service"
+)
+
+const defaultAuditLimit = 50
+
+// adminUser is a user as admin routes show it, with the role and ban that
+// domain.User keeps out of its JSON.
+type adminUser struct {
+	*domain.User
+	Role      string     `json:"role"`
+	BannedAt  *time.Time `json:"bannedAt,omitempty"`
+	BanReason *string    `json:"banReason,omitempty"`
+}
+
+func newAdminUser(user *domain.User) adminUser {
+	return adminUser{User: user, Role: user.Role, BannedAt: user.BannedAt, BanReason: user.BanReason}
+}
+
+type AdminHandler struct {
+	adminService *service.AdminService
+	publisher    pubsub.Publisher
+	control      *pubsub.ControlBus
+	hub          *ws.Hub
+}
+
+func NewAdminHandler(adminService *service.AdminService, publisher pubsub.Publisher, control *pubsub.ControlBus, hub *ws.Hub) *AdminHandler {
+	return &AdminHandler{adminService: adminService, publisher: publisher, control: control, hub: hub}
+}
+
+func (h *AdminHandler) UnclaimTile(w http.ResponseWriter, r *http.Request) {
+	tileID, ok := tileIDParam(w, r)
+	if !ok {
+		return
+	}
+	boardID := boardIDParam(r)
+	vp, count, err := h.adminService.UnclaimTile(r.Context(), currentUserID(r), boardID, tileID)
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+	if count > 0 {
+		h.publishRegionReset(r, boardID, vp, count)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"tileId": tileID,
+		"reset":  count,
+	})
+}
+
+func (h *AdminHandler) ReassignTile(w http.ResponseWriter, r *http.Request) {
+	tileID, ok := tileIDParam(w, r)
+	if !ok {
+		return
+	}
+	var payload struct {
+		UserID uuid.UUID `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.UserID == uuid.Nil {
+		respondError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	boardID := boardIDParam(r)
+	result, err := h.adminService.ReassignTile(r.Context(), currentUserID(r), boardID, tileID, payload.UserID)
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+	username := ""
+	if result.Tile.OwnerUsername != nil {
+		username = *result.Tile.OwnerUsername
+	}
+	if err := h.publisher.Publish(r.Context(), boardID, ws.MsgTypeTileClaimed, ws.TileClaimedPayload(result, username)); err != nil {
+		log.Printf("Admin: publish reassign failed: %v", err)
+	}
+	respondJSON(w, http.StatusOK, result.Tile)
+}
+
+func (h *AdminHandler) Ban(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	var payload struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid payload")
+			return
+		}
+	}
+
+	user, err := h.adminService.Ban(r.Context(), currentUserID(r), userID, payload.Reason)
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+	h.disconnect(r, user.ID, ws.CloseBanned, "banned")
+	respondJSON(w, http.StatusOK, newAdminUser(user))
+}
+
+func (h *AdminHandler) Unban(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	user, err := h.adminService.Unban(r.Context(), currentUserID(r), userID)
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, newAdminUser(user))
+}
+
+func (h *AdminHandler) Disconnect(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	user, err := h.adminService.Disconnect(r.Context(), currentUserID(r), userID)
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+	h.disconnect(r, user.ID, ws.CloseKicked, "disconnected by an admin")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AdminHandler) ResetRegion(w http.ResponseWriter, r *http.Request) {
+	var payload domain.Viewport
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+	boardID := boardIDParam(r)
+	vp, count, err := h.adminService.ResetRegion(r.Context(), currentUserID(r), boardID, payload)
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+	if count > 0 {
+		h.publishRegionReset(r, boardID, vp, count)
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"region": vp,
+		"reset":  count,
+	})
+}
+
+// Announce sends a system announcement to the board named by boardId, or to
+// every board when it is omitted.
+func (h *AdminHandler) Announce(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Message string `json:"message"`
+		BoardID string `json:"boardId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+	boardIDs, message, err := h.adminService.Announce(r.Context(), currentUserID(r), payload.BoardID, payload.Message)
+	if err != nil {
+		respondAdminError(w, err)
+		return
+	}
+	announcement := map[string]interface{}{
+		"message": message,
+	}
+	for _, boardID := range boardIDs {
+		if err := h.publisher.Publish(r.Context(), boardID, ws.MsgTypeAnnouncement, announcement); err != nil {
+			log.Printf("Admin: publish announcement to board %s failed: %v", boardID, err)
+		}
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message": message,
+		"boards":  boardIDs,
+	})
+}
+
+// WSStats reports this instance's slow consumer counters and per-shard hub
+// load.
+func (h *AdminHandler) WSStats(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"slowConsumer": h.hub.SlowConsumerStats(),
+		"shards":       h.hub.ShardStats(),
+	})
+}
+
+func (h *AdminHandler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultAuditLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			respondError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+	var before int64
+	if value := query.Get("before"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			respondError(w, http.StatusBadRequest, "Invalid before")
+			return
+		}
+		before = parsed
+	}
+
+	entries, err := h.adminService.AuditLog(r.Context(), before, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load audit log")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+	})
+}
+
+func (h *AdminHandler) publishRegionReset(r *http.Request, boardID string, vp domain.Viewport, count int) {
+	payload := map[string]interface{}{
+		"x":     vp.X,
+		"y":     vp.Y,
+		"w":     vp.W,
+		"h":     vp.H,
+		"tiles": count,
+	}
+	if err := h.publisher.Publish(r.Context(), boardID, ws.MsgTypeRegionReset, payload); err != nil {
+		log.Printf("Admin: publish region reset failed: %v", err)
+	}
+}
+
+// disconnect closes userID's connections on every instance.
+func (h *AdminHandler) disconnect(r *http.Request, userID uuid.UUID, code int, reason string) {
+	if err := h.control.DisconnectUser(r.Context(), userID.String(), code, reason); err != nil {
+		log.Printf("Admin: disconnect %s failed: %v", userID, err)
+	}
+}
+
+func tileIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "tileId"))
+	if err != nil || id < 0 {
+		respondError(w, http.StatusBadRequest, "Invalid tile id")
+		return 0, false
+	}
+	return id, true
+}
+
+func userIDParam(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid user id")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func respondAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrBoardNotFound):
+		respondError(w, http.StatusNotFound, "Board not found")
+	case errors.Is(err, domain.ErrUserNotFound):
+		respondError(w, http.StatusNotFound, "User not found")
+	case errors.Is(err, domain.ErrTileInvalid):
+		respondError(w, http.StatusBadRequest, "Invalid tile")
+	case errors.Is(err, domain.ErrViewportInvalid):
+		respondError(w, http.StatusBadRequest, "Region must overlap the board and cover at most 65536 tiles")
+	case errors.Is(err, domain.ErrTileAlreadyClaimed):
+		respondJSON(w, http.StatusConflict, map[string]string{
+			"error": "User already owns this tile",
+			"code":  "ALREADY_OWNED",
+		})
+	case errors.Is(err, domain.ErrUserBanned):
+		respondJSON(w, http.StatusConflict, map[string]string{
+			"error": "User is banned",
+			"code":  "USER_BANNED",
+		})
+	case errors.Is(err, service.ErrBanSelf), errors.Is(err, service.ErrAnnouncementInvalid):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "Admin action failed")
+	}
+}
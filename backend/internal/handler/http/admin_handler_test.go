@@ -0,0 +1,52 @@
+package http
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+)
+
+func TestUserJSONPrivacy(t *testing.T) {
+	bannedAt := time.Now().UTC()
+	reason := "griefing"
+	user := &domain.User{
+		ID: uuid.New(), Username: "mallory", Color: "#FF6B6B",
+		Role: domain.RoleAdmin, BannedAt: &bannedAt, BanReason: &reason,
+	}
+
+	tests := []struct {
+		name        string
+		value       interface{}
+		wantPrivate bool
+	}{
+		{"public user", user, false},
+		{"admin user", newAdminUser(user), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]interface{}
+			if err := json.Unmarshal(raw, &fields); err != nil {
+				t.Fatal(err)
+			}
+			if fields["username"] != "mallory" {
+				t.Fatalf("username = %v in %s", fields["username"], raw)
+			}
+			for _, key := range []string{"role", "bannedAt", "banReason"} {
+				if _, ok := fields[key]; ok != tt.wantPrivate {
+					t.Errorf("%s present = %v in %s", key, ok, raw)
+				}
+			}
+			if tt.wantPrivate && (fields["role"] != domain.RoleAdmin || fields["banReason"] != reason) {
+				t.Fatalf("role %v, ban reason %v", fields["role"], fields["banReason"])
+			}
+		})
+	}
+}
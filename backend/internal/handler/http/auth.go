@@ -0,0 +1,142 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/service"
+)
+
+type contextKey string
+
+const claimsContextKey contextKey = "claims"
+
+func tokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if cookie, err := r.Cookie("otg_token"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func requireAuth(userService *service.UserService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := tokenFromRequest(r)
+			if token == "" {
+				respondError(w, http.StatusUnauthorized, "Missing token")
+				return
+			}
+			claims, err := userService.ValidateToken(r.Context(), token)
+			var rateErr *domain.RateLimitError
+			if errors.As(err, &rateErr) {
+				respondRateLimited(w, rateErr)
+				return
+			}
+			if err != nil {
+				respondError(w, http.StatusUnauthorized, "Invalid token")
+				return
+			}
+			userID, err := uuid.Parse(claims.UserID)
+			if err != nil {
+				respondError(w, http.StatusUnauthorized, "Invalid token")
+				return
+			}
+			user, err := userService.GetByID(r.Context(), userID)
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, "Failed to load user")
+				return
+			}
+			if user == nil {
+				respondError(w, http.StatusUnauthorized, "Invalid token")
+				return
+			}
+			if user.Banned() {
+				respondError(w, http.StatusForbidden, "Account banned")
+				return
+			}
+			ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// requireAdmin lets through requests whose token carries the admin role. It
+// runs after requireAuth, and the role is checked against the user's current
+// one as well so a demoted admin's outstanding tokens stop working.
+func requireAdmin(userService *service.UserService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := claimsFromRequest(r)
+			if claims == nil || claims.Role != domain.RoleAdmin || !claims.HasScope(domain.ScopeAdmin) {
+				respondError(w, http.StatusForbidden, "Admin only")
+				return
+			}
+			user, err := userService.GetByID(r.Context(), currentUserID(r))
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, "Failed to load user")
+				return
+			}
+			if user == nil || user.Role != domain.RoleAdmin {
+				respondError(w, http.StatusForbidden, "Admin only")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireScope lets through callers whose credentials carry scope. It runs
+// after requireAuth; user tokens carry every scope.
+func requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if claims := claimsFromRequest(r); claims == nil || !claims.HasScope(scope) {
+				respondJSON(w, http.StatusForbidden, map[string]string{
+					"error": "API key lacks the " + scope + " scope",
+					"code":  "SCOPE_DENIED",
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireUserToken keeps API keys off routes that manage the account
+// itself, such as its credentials and its keys. It runs after requireAuth.
+func requireUserToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims := claimsFromRequest(r); claims == nil || claims.APIKeyID != "" {
+			respondJSON(w, http.StatusForbidden, map[string]string{
+				"error": "Not available to API keys",
+				"code":  "SCOPE_DENIED",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func claimsFromRequest(r *http.Request) *service.Claims {
+	claims, _ := r.Context().Value(claimsContextKey).(*service.Claims)
+	return claims
+}
+
+func currentUserID(r *http.Request) uuid.UUID {
+	claims := claimsFromRequest(r)
+	if claims == nil {
+		return uuid.Nil
+	}
+	id, _ := uuid.Parse(claims.UserID)
+	return id
+}
@@ -0,0 +1,246 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/handler/ws"
+	"ownthegrid/internal/pubsub"
+	"ownthegrid/internal/service"
+)
+
+const refreshCookieName = "otg_refresh"
+
+type AuthHandler struct {
+	userService *service.UserService
+	control     *pubsub.ControlBus
+}
+
+func NewAuthHandler(userService *service.UserService, control *pubsub.ControlBus) *AuthHandler {
+	return &AuthHandler{userService: userService, control: control}
+}
+
+// Login signs a user in with the password they registered with.
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Username == "" || payload.Password == "" {
+		respondError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	user, err := h.userService.Login(r.Context(), payload.Username, payload.Password, clientIP(r))
+	if err != nil {
+		respondCredentialError(w, err)
+		return
+	}
+	setSessionCookies(w, r, user)
+	respondJSON(w, http.StatusOK, user)
+}
+
+// Recover signs a user in with one of their recovery codes, optionally
+// setting a new password, and revokes every other session of theirs.
+func (h *AuthHandler) Recover(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Username     string `json:"username"`
+		RecoveryCode string `json:"recoveryCode"`
+		NewPassword  string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Username == "" || payload.RecoveryCode == "" {
+		respondError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	user, revoked, err := h.userService.Recover(r.Context(), payload.Username, payload.RecoveryCode, payload.NewPassword, clientIP(r))
+	if err != nil {
+		respondCredentialError(w, err)
+		return
+	}
+	closeSessions(r, h.control, revoked)
+	setSessionCookies(w, r, user)
+	respondJSON(w, http.StatusOK, user)
+}
+
+// Refresh trades a refresh token, from the body or the otg_refresh cookie,
+// for a new access token and the session's next refresh token.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid payload")
+			return
+		}
+	}
+
+	user, err := h.userService.Refresh(r.Context(), refreshTokenFromRequest(r, payload.RefreshToken))
+	if err != nil {
+		var reuse *domain.TokenReuseError
+		switch {
+		case errors.As(err, &reuse):
+			closeSessions(r, h.control, []domain.Session{reuse.Session})
+			clearSessionCookies(w, r)
+			respondJSON(w, http.StatusUnauthorized, map[string]string{
+				"error": "Refresh token already used; the session has been revoked",
+				"code":  "REFRESH_TOKEN_REUSED",
+			})
+		case errors.Is(err, domain.ErrTokenInvalid):
+			clearSessionCookies(w, r)
+			respondJSON(w, http.StatusUnauthorized, map[string]string{
+				"error": "Invalid refresh token",
+				"code":  "INVALID_REFRESH_TOKEN",
+			})
+		case errors.Is(err, domain.ErrUserBanned):
+			respondError(w, http.StatusForbidden, "Account banned")
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to refresh token")
+		}
+		return
+	}
+
+	setSessionCookies(w, r, user)
+	respondJSON(w, http.StatusOK, user)
+}
+
+// Logout revokes the caller's session, identified by the refresh token or
+// failing that the access token, or every session of theirs when all is
+// set. The revoked sessions' WebSocket connections are closed.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		RefreshToken string `json:"refreshToken"`
+		All          bool   `json:"all"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid payload")
+			return
+		}
+	}
+	refreshToken := refreshTokenFromRequest(r, payload.RefreshToken)
+
+	// API keys have no session to end and must not end the user's.
+	var claims *service.Claims
+	if token := tokenFromRequest(r); token != "" && !service.IsAPIKey(token) {
+		claims, _ = h.userService.ValidateToken(r.Context(), token)
+	}
+	if claims == nil && (payload.All || refreshToken == "") {
+		respondError(w, http.StatusUnauthorized, "Missing token")
+		return
+	}
+
+	revoked, err := h.userService.Logout(r.Context(), claims, refreshToken, payload.All)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+	closeSessions(r, h.control, revoked)
+	clearSessionCookies(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WSTicket issues a one-time ticket for opening a WebSocket connection, to
+// pass as the ticket query parameter instead of the access token.
+func (h *AuthHandler) WSTicket(w http.ResponseWriter, r *http.Request) {
+	ticket, err := h.userService.IssueWSTicket(r.Context(), claimsFromRequest(r))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to issue ticket")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"ticket":    ticket,
+		"expiresIn": int(service.WSTicketTTL.Seconds()),
+	})
+}
+
+// JWKS publishes the public keys access tokens are signed with, so other
+// services can verify them.
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondJSON(w, http.StatusOK, h.userService.JWKS())
+}
+
+// closeSessions closes the WebSocket connections of revoked sessions on
+// every instance.
+func closeSessions(r *http.Request, control *pubsub.ControlBus, sessions []domain.Session) {
+	for _, session := range sessions {
+		err := control.DisconnectSession(r.Context(), session.UserID.String(), session.ID.String(), ws.CloseRevoked, "session revoked")
+		if err != nil {
+			log.Printf("Disconnect session %s failed: %v", session.ID, err)
+		}
+	}
+}
+
+func respondCredentialError(w http.ResponseWriter, err error) {
+	var rateErr *domain.RateLimitError
+	switch {
+	case errors.As(err, &rateErr):
+		respondRateLimited(w, rateErr)
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		respondJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "Invalid username or credentials",
+			"code":  "INVALID_CREDENTIALS",
+		})
+	case errors.Is(err, domain.ErrUserBanned):
+		respondError(w, http.StatusForbidden, "Account banned")
+	case errors.Is(err, service.ErrPasswordInvalid):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "Failed to sign in")
+	}
+}
+
+// refreshTokenFromRequest returns the refresh token sent in the body, or
+// else the one in the otg_refresh cookie.
+func refreshTokenFromRequest(r *http.Request, fromBody string) string {
+	if fromBody != "" {
+		return fromBody
+	}
+	if cookie, err := r.Cookie(refreshCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// setSessionCookies mirrors the tokens issued to user into cookies. The
+// refresh cookie is only ever sent to the auth routes.
+func setSessionCookies(w http.ResponseWriter, r *http.Request, user *domain.User) {
+	if user.Token != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     "otg_token",
+			Value:    user.Token,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+			Secure:   r.TLS != nil,
+		})
+	}
+	if user.RefreshToken != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     refreshCookieName,
+			Value:    user.RefreshToken,
+			Path:     "/api/auth",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+			Secure:   r.TLS != nil,
+		})
+	}
+}
+
+func clearSessionCookies(w http.ResponseWriter, r *http.Request) {
+	for name, path := range map[string]string{"otg_token": "/", refreshCookieName: "/api/auth"} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     path,
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/service"
+)
+
+type BoardHandler struct {
+	boardService *service.BoardService
+}
+
+func NewBoardHandler(boardService *service.BoardService) *BoardHandler {
+	return &BoardHandler{boardService: boardService}
+}
+
+func (h *BoardHandler) List(w http.ResponseWriter, r *http.Request) {
+	boards, err := h.boardService.List(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list boards")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"boards": boards,
+	})
+}
+
+func (h *BoardHandler) Get(w http.ResponseWriter, r *http.Request) {
+	board, err := h.boardService.Get(r.Context(), chi.URLParam(r, "boardId"))
+	if err != nil {
+		respondBoardError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, board)
+}
+
+func (h *BoardHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	board, err := h.boardService.Create(r.Context(), &domain.Board{
+		ID:     payload.ID,
+		Name:   payload.Name,
+		Width:  payload.Width,
+		Height: payload.Height,
+	}, currentUserID(r))
+	if err != nil {
+		respondBoardCreateError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, board)
+}
+
+func respondBoardCreateError(w http.ResponseWriter, err error) {
+	status, message, code := http.StatusBadRequest, "", ""
+	switch {
+	case errors.Is(err, domain.ErrBoardExists):
+		status, message, code = http.StatusConflict, "Board already exists", "BOARD_EXISTS"
+	case errors.Is(err, domain.ErrBoardIDInvalid):
+		message, code = "Board id must be 1-32 lowercase letters, digits or dashes", "INVALID_BOARD_ID"
+	case errors.Is(err, domain.ErrBoardNameInvalid):
+		message, code = "Board name must be at most 64 characters", "INVALID_BOARD_NAME"
+	case errors.Is(err, domain.ErrBoardSizeInvalid):
+		message = fmt.Sprintf("Board width and height must be between 1 and %d", domain.MaxBoardDimension)
+		code = "INVALID_BOARD_SIZE"
+	default:
+		log.Printf("Create board failed: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to create board")
+		return
+	}
+	respondJSON(w, status, map[string]string{"error": message, "code": code})
+}
+
+func respondBoardError(w http.ResponseWriter, err error) {
+	if errors.Is(err, domain.ErrBoardNotFound) {
+		respondError(w, http.StatusNotFound, "Board not found")
+		return
+	}
+	respondError(w, http.StatusInternalServerError, "Failed to load board")
+}
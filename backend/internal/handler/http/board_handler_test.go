@@ -0,0 +1,47 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ownthegrid/internal/domain"
+)
+
+func TestRespondBoardCreateError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"taken id", domain.ErrBoardExists, http.StatusConflict, "BOARD_EXISTS"},
+		{"bad id", domain.ErrBoardIDInvalid, http.StatusBadRequest, "INVALID_BOARD_ID"},
+		{"bad name", domain.ErrBoardNameInvalid, http.StatusBadRequest, "INVALID_BOARD_NAME"},
+		{"bad size", domain.ErrBoardSizeInvalid, http.StatusBadRequest, "INVALID_BOARD_SIZE"},
+		{"wrapped", fmt.Errorf("create: %w", domain.ErrBoardSizeInvalid), http.StatusBadRequest, "INVALID_BOARD_SIZE"},
+		{"database failure", errors.New(`Create: pq: relation "boards" does not exist`), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			respondBoardCreateError(w, tt.err)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["code"] != tt.wantCode {
+				t.Fatalf("code = %q, want %q", body["code"], tt.wantCode)
+			}
+			if body["error"] == "" || body["error"] == tt.err.Error() {
+				t.Fatalf("error = %q, want a fixed message", body["error"])
+			}
+		})
+	}
+}
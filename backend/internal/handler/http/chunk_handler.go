@@ -0,0 +1,151 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/service"
+)
+
+type ChunkHandler struct {
+	tileService  *service.TileService
+	boardService *service.BoardService
+}
+
+func NewChunkHandler(tileService *service.TileService, boardService *service.BoardService) *ChunkHandler {
+	return &ChunkHandler{tileService: tileService, boardService: boardService}
+}
+
+type chunkOwner struct {
+	UserID   uuid.UUID  `json:"userId"`
+	Username string     `json:"username"`
+	Color    string     `json:"color"`
+	TeamID   *uuid.UUID `json:"teamId,omitempty"`
+	TeamName *string    `json:"teamName,omitempty"`
+}
+
+// chunkResponse is the compact chunk encoding. cells holds one little-endian
+// uint16 per tile in row-major order, base64 encoded: 0 is unclaimed and n
+// refers to owners[n-1].
+type chunkResponse struct {
+	BoardID string       `json:"boardId"`
+	CX      int          `json:"cx"`
+	CY      int          `json:"cy"`
+	X       int          `json:"x"`
+	Y       int          `json:"y"`
+	Width   int          `json:"width"`
+	Height  int          `json:"height"`
+	Version int64        `json:"version"`
+	Owners  []chunkOwner `json:"owners"`
+	Cells   string       `json:"cells"`
+}
+
+func (h *ChunkHandler) Get(w http.ResponseWriter, r *http.Request) {
+	cx, errX := strconv.Atoi(chi.URLParam(r, "cx"))
+	cy, errY := strconv.Atoi(chi.URLParam(r, "cy"))
+	if errX != nil || errY != nil {
+		respondError(w, http.StatusBadRequest, "Invalid chunk coordinates")
+		return
+	}
+	board, err := h.boardService.Get(r.Context(), boardIDParam(r))
+	if err != nil {
+		respondBoardError(w, err)
+		return
+	}
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		version, err := h.tileService.GetChunkVersion(r.Context(), board, cx, cy)
+		if err != nil {
+			respondChunkError(w, err)
+			return
+		}
+		if etagMatches(match, chunkETag(version)) {
+			setChunkCacheHeaders(w, version)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	chunk, err := h.tileService.GetChunk(r.Context(), board, cx, cy)
+	if err != nil {
+		respondChunkError(w, err)
+		return
+	}
+	setChunkCacheHeaders(w, chunk.Version)
+	respondJSON(w, http.StatusOK, encodeChunk(chunk))
+}
+
+func encodeChunk(chunk *domain.Chunk) chunkResponse {
+	bounds := chunk.Bounds
+	cells := make([]byte, 2*bounds.W*bounds.H)
+	owners := []chunkOwner{}
+	ownerIndex := map[uuid.UUID]uint16{}
+	for _, tile := range chunk.Tiles {
+		if tile.OwnerID == nil || !bounds.Contains(tile.X, tile.Y) {
+			continue
+		}
+		index, ok := ownerIndex[*tile.OwnerID]
+		if !ok {
+			owner := chunkOwner{UserID: *tile.OwnerID}
+			if tile.OwnerUsername != nil {
+				owner.Username = *tile.OwnerUsername
+			}
+			if tile.OwnerColor != nil {
+				owner.Color = *tile.OwnerColor
+			}
+			owner.TeamID, owner.TeamName = tile.OwnerTeamID, tile.OwnerTeamName
+			owners = append(owners, owner)
+			index = uint16(len(owners))
+			ownerIndex[*tile.OwnerID] = index
+		}
+		offset := 2 * ((tile.Y-bounds.Y)*bounds.W + (tile.X - bounds.X))
+		binary.LittleEndian.PutUint16(cells[offset:], index)
+	}
+	return chunkResponse{
+		BoardID: chunk.BoardID,
+		CX:      chunk.CX,
+		CY:      chunk.CY,
+		X:       bounds.X,
+		Y:       bounds.Y,
+		Width:   bounds.W,
+		Height:  bounds.H,
+		Version: chunk.Version,
+		Owners:  owners,
+		Cells:   base64.StdEncoding.EncodeToString(cells),
+	}
+}
+
+func chunkETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+func setChunkCacheHeaders(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", chunkETag(version))
+	w.Header().Set("Cache-Control", "public, no-cache")
+}
+
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func respondChunkError(w http.ResponseWriter, err error) {
+	if errors.Is(err, domain.ErrChunkNotFound) {
+		respondError(w, http.StatusNotFound, "Chunk not found")
+		return
+	}
+	respondError(w, http.StatusInternalServerError, "Failed to load chunk")
+}
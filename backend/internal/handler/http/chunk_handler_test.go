@@ -0,0 +1,135 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+)
+
+func ownedTile(x, y int, owner uuid.UUID, username string) *domain.Tile {
+	color := "#" + username
+	return &domain.Tile{X: x, Y: y, OwnerID: &owner, OwnerUsername: &username, OwnerColor: &color}
+}
+
+// decodeCells returns the owner index of every cell in an encoded chunk.
+func decodeCells(t *testing.T, encoded string) []uint16 {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw)%2 != 0 {
+		t.Fatalf("cells are %d bytes, want an even number", len(raw))
+	}
+	cells := make([]uint16, len(raw)/2)
+	for i := range cells {
+		cells[i] = binary.LittleEndian.Uint16(raw[2*i:])
+	}
+	return cells
+}
+
+func TestEncodeChunk(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	bounds := domain.Viewport{X: 4, Y: 8, W: 3, H: 2}
+
+	tests := []struct {
+		name       string
+		tiles      []*domain.Tile
+		wantCells  []uint16
+		wantOwners []string
+	}{
+		{
+			name:       "empty",
+			wantCells:  []uint16{0, 0, 0, 0, 0, 0},
+			wantOwners: []string{},
+		},
+		{
+			name:       "unclaimed tiles",
+			tiles:      []*domain.Tile{{X: 4, Y: 8}, {X: 5, Y: 9}},
+			wantCells:  []uint16{0, 0, 0, 0, 0, 0},
+			wantOwners: []string{},
+		},
+		{
+			name:       "owners numbered from one in first-seen order",
+			tiles:      []*domain.Tile{ownedTile(5, 8, bob, "bob"), ownedTile(4, 9, alice, "alice"), ownedTile(6, 8, bob, "bob")},
+			wantCells:  []uint16{0, 1, 1, 2, 0, 0},
+			wantOwners: []string{"bob", "alice"},
+		},
+		{
+			name:       "corners",
+			tiles:      []*domain.Tile{ownedTile(4, 8, alice, "alice"), ownedTile(6, 9, alice, "alice")},
+			wantCells:  []uint16{1, 0, 0, 0, 0, 1},
+			wantOwners: []string{"alice"},
+		},
+		{
+			name:       "tiles outside the bounds",
+			tiles:      []*domain.Tile{ownedTile(3, 8, alice, "alice"), ownedTile(7, 8, alice, "alice"), ownedTile(4, 10, bob, "bob")},
+			wantCells:  []uint16{0, 0, 0, 0, 0, 0},
+			wantOwners: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunk := &domain.Chunk{BoardID: "main", CX: 1, CY: 2, Bounds: bounds, Version: 7, Tiles: tt.tiles}
+			got := encodeChunk(chunk)
+			if got.BoardID != "main" || got.CX != 1 || got.CY != 2 || got.Version != 7 {
+				t.Fatalf("encodeChunk() header = %+v", got)
+			}
+			if got.X != bounds.X || got.Y != bounds.Y || got.Width != bounds.W || got.Height != bounds.H {
+				t.Fatalf("encodeChunk() bounds = %d,%d %dx%d, want %+v", got.X, got.Y, got.Width, got.Height, bounds)
+			}
+			if cells := decodeCells(t, got.Cells); !reflect.DeepEqual(cells, tt.wantCells) {
+				t.Fatalf("cells = %v, want %v", cells, tt.wantCells)
+			}
+			owners := []string{}
+			for _, owner := range got.Owners {
+				owners = append(owners, owner.Username)
+				if owner.Color != "#"+owner.Username {
+					t.Errorf("owner %s color = %q", owner.Username, owner.Color)
+				}
+			}
+			if !reflect.DeepEqual(owners, tt.wantOwners) {
+				t.Fatalf("owners = %v, want %v", owners, tt.wantOwners)
+			}
+		})
+	}
+}
+
+func TestEncodeChunkTeam(t *testing.T) {
+	owner, team, teamName := uuid.New(), uuid.New(), "reds"
+	tile := ownedTile(0, 0, owner, "alice")
+	tile.OwnerTeamID, tile.OwnerTeamName = &team, &teamName
+	got := encodeChunk(&domain.Chunk{Bounds: domain.Viewport{W: 1, H: 1}, Tiles: []*domain.Tile{tile}})
+	if len(got.Owners) != 1 {
+		t.Fatalf("got %d owners, want 1", len(got.Owners))
+	}
+	o := got.Owners[0]
+	if o.UserID != owner || o.TeamID == nil || *o.TeamID != team || o.TeamName == nil || *o.TeamName != teamName {
+		t.Fatalf("owner = %+v, want user %s on team %s", o, owner, team)
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"7"`, true},
+		{`W/"7"`, true},
+		{`"6", "7"`, true},
+		{`*`, true},
+		{`"6"`, false},
+		{`7`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, chunkETag(7)); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
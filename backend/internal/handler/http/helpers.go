@@ -2,7 +2,12 @@ package http
 
 import (
 	"encoding/json"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+
+	"ownthegrid/internal/domain"
 )
 
 func respondJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -14,3 +19,28 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 func respondError(w http.ResponseWriter, status int, message string) {
 	respondJSON(w, status, map[string]string{"error": message})
 }
+
+func respondRateLimited(w http.ResponseWriter, err *domain.RateLimitError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	respondJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+		"error":        "Too many requests",
+		"code":         "RATE_LIMITED",
+		"retryAfterMs": err.RetryAfter.Milliseconds(),
+	})
+}
+
+func boardIDParam(r *http.Request) string {
+	if boardID := r.URL.Query().Get("boardId"); boardID != "" {
+		return boardID
+	}
+	return domain.DefaultBoardID
+}
+
+// clientIP returns the address the request came from, for rate limiting.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
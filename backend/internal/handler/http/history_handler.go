@@ -0,0 +1,176 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+	"ownthegrid/internal/service"
+)
+
+const maxReplaySpeed = 1000
+
+type HistoryHandler struct {
+	historyService *service.HistoryService
+}
+
+func NewHistoryHandler(historyService *service.HistoryService) *HistoryHandler {
+	return &HistoryHandler{historyService: historyService}
+}
+
+func (h *HistoryHandler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	boardID := chi.URLParam(r, "boardId")
+	query := r.URL.Query()
+
+	var snapshot *service.BoardSnapshot
+	var err error
+	switch {
+	case query.Get("eventId") != "":
+		eventID, parseErr := strconv.ParseInt(query.Get("eventId"), 10, 64)
+		if parseErr != nil || eventID < 0 {
+			respondError(w, http.StatusBadRequest, "Invalid eventId")
+			return
+		}
+		snapshot, err = h.historyService.SnapshotAtEvent(r.Context(), boardID, eventID)
+	case query.Get("at") != "":
+		at, parseErr := time.Parse(time.RFC3339, query.Get("at"))
+		if parseErr != nil {
+			respondError(w, http.StatusBadRequest, "Invalid at, expected RFC3339")
+			return
+		}
+		snapshot, err = h.historyService.SnapshotAtTime(r.Context(), boardID, at)
+	default:
+		respondError(w, http.StatusBadRequest, "Either at or eventId is required")
+		return
+	}
+	if err != nil {
+		respondBoardError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, snapshot)
+}
+
+func (h *HistoryHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseEventFilter(w, r)
+	if !ok {
+		return
+	}
+	events, err := h.historyService.ListEvents(r.Context(), chi.URLParam(r, "boardId"), filter)
+	if err != nil {
+		respondBoardError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"events": events,
+	})
+}
+
+func (h *HistoryHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid from, expected RFC3339")
+		return
+	}
+	to := time.Now()
+	if query.Get("to") != "" {
+		to, err = time.Parse(time.RFC3339, query.Get("to"))
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid to, expected RFC3339")
+			return
+		}
+	}
+	if !to.After(from) {
+		respondError(w, http.StatusBadRequest, "to must be after from")
+		return
+	}
+	speed := 1.0
+	if query.Get("speed") != "" {
+		speed, err = strconv.ParseFloat(query.Get("speed"), 64)
+		if err != nil || speed <= 0 || speed > maxReplaySpeed {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("speed must be between 0 and %d", maxReplaySpeed))
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	started := false
+	send := func(event string, data interface{}) error {
+		body, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if !started {
+			_ = rc.SetWriteDeadline(time.Time{})
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, body); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	err = h.historyService.Replay(r.Context(), chi.URLParam(r, "boardId"), from, to, speed,
+		func(snapshot *service.BoardSnapshot) error { return send("snapshot", snapshot) },
+		func(event *domain.TileEvent) error { return send("event", event) },
+	)
+	if err != nil {
+		if !started {
+			respondBoardError(w, err)
+		}
+		return
+	}
+	_ = send("end", map[string]interface{}{})
+}
+
+func parseEventFilter(w http.ResponseWriter, r *http.Request) (repository.EventFilter, bool) {
+	query := r.URL.Query()
+	filter := repository.EventFilter{}
+	for _, param := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if value := query.Get(param.name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid "+param.name+", expected RFC3339")
+				return filter, false
+			}
+			*param.target = &parsed
+		}
+	}
+	if value := query.Get("afterId"); value != "" {
+		afterID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid afterId")
+			return filter, false
+		}
+		filter.AfterID = afterID
+	}
+	if value := query.Get("tileId"); value != "" {
+		tileID, err := strconv.Atoi(value)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid tileId")
+			return filter, false
+		}
+		filter.TileID = &tileID
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid limit")
+			return filter, false
+		}
+		filter.Limit = limit
+	}
+	return filter, true
+}
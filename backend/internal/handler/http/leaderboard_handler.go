@@ -0,0 +1,98 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/service"
+)
+
+const defaultLeaderboardLimit = 10
+
+type LeaderboardHandler struct {
+	leaderboardService *service.LeaderboardService
+}
+
+func NewLeaderboardHandler(leaderboardService *service.LeaderboardService) *LeaderboardHandler {
+	return &LeaderboardHandler{leaderboardService: leaderboardService}
+}
+
+func (h *LeaderboardHandler) Get(w http.ResponseWriter, r *http.Request) {
+	limit, ok := leaderboardLimit(w, r)
+	if !ok {
+		return
+	}
+
+	leaderboard, err := h.leaderboardService.Top(r.Context(), boardIDParam(r), limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get leaderboard")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"leaderboard": leaderboard,
+	})
+}
+
+func (h *LeaderboardHandler) GetTeams(w http.ResponseWriter, r *http.Request) {
+	limit, ok := leaderboardLimit(w, r)
+	if !ok {
+		return
+	}
+
+	leaderboard, err := h.leaderboardService.TopTeams(r.Context(), boardIDParam(r), limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get team leaderboard")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"leaderboard": leaderboard,
+	})
+}
+
+func (h *LeaderboardHandler) GetRank(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid user id")
+		return
+	}
+	h.respondRank(w, r, id)
+}
+
+func (h *LeaderboardHandler) GetMyRank(w http.ResponseWriter, r *http.Request) {
+	h.respondRank(w, r, currentUserID(r))
+}
+
+func (h *LeaderboardHandler) respondRank(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	entry, err := h.leaderboardService.RankOf(r.Context(), boardIDParam(r), userID)
+	if errors.Is(err, domain.ErrBoardNotFound) {
+		respondError(w, http.StatusNotFound, "Board not found")
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get rank")
+		return
+	}
+	if entry == nil {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, entry)
+}
+
+func leaderboardLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultLeaderboardLimit, true
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		respondError(w, http.StatusBadRequest, "Invalid limit")
+		return 0, false
+	}
+	return limit, true
+}
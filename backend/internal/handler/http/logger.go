@@ -0,0 +1,47 @@
+package http
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// redactedParams are query parameters whose values never reach the access
+// log.
+var redactedParams = []string{"token", "ticket", "refreshToken"}
+
+// Logger is chi's request logger with credentials in the query string
+// masked.
+var Logger = middleware.RequestLogger(&redactingFormatter{
+	next: &middleware.DefaultLogFormatter{Logger: log.New(os.Stdout, "", log.LstdFlags), NoColor: true},
+})
+
+type redactingFormatter struct {
+	next middleware.LogFormatter
+}
+
+// NewLogEntry hands the wrapped formatter a copy of r with a redacted URI;
+// the request passed on to handlers is left alone.
+func (f *redactingFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	query := r.URL.Query()
+	redacted := false
+	for _, param := range redactedParams {
+		if query.Has(param) {
+			query.Set(param, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return f.next.NewLogEntry(r)
+	}
+
+	masked := r.Clone(r.Context())
+	u := *r.URL
+	u.RawQuery = query.Encode()
+	masked.URL = &u
+	masked.RequestURI = (&url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery}).RequestURI()
+	return f.next.NewLogEntry(masked)
+}
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// uriRecorder remembers the URI of the last request it was asked to log.
+type uriRecorder struct {
+	uri string
+}
+
+func (f *uriRecorder) NewLogEntry(r *http.Request) middleware.LogEntry {
+	f.uri = r.RequestURI
+	return nil
+}
+
+func TestRedactingFormatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		wantURI string
+	}{
+		{"no query", "/ws", "/ws"},
+		{"nothing secret", "/ws?board=main&lastSeq=4", "/ws?board=main&lastSeq=4"},
+		{"token", "/ws?token=eyJhbGciOi&board=main", "/ws?board=main&token=REDACTED"},
+		{"ticket", "/ws?ticket=abc123", "/ws?ticket=REDACTED"},
+		{"refresh token", "/api/auth/refresh?refreshToken=r1", "/api/auth/refresh?refreshToken=REDACTED"},
+		{"repeated token", "/ws?token=a&token=b", "/ws?token=REDACTED"},
+	}
+	for _, tt := range tests {
+		rec := &uriRecorder{}
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		(&redactingFormatter{next: rec}).NewLogEntry(r)
+		if rec.uri != tt.wantURI {
+			t.Errorf("%s: logged %q, want %q", tt.name, rec.uri, tt.wantURI)
+		}
+		if r.RequestURI != tt.target {
+			t.Errorf("%s: request URI changed to %q", tt.name, r.RequestURI)
+		}
+	}
+}
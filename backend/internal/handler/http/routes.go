@@ -3,24 +3,109 @@ package http
 import (
 	"github.com/go-chi/chi/v5"
 
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/handler/ws"
+	"ownthegrid/internal/pubsub"
 	"ownthegrid/internal/service"
 )
 
-func Mount(r chi.Router, tileService *service.TileService, userService *service.UserService) {
-	tileHandler := NewTileHandler(tileService, userService)
-	userHandler := NewUserHandler(userService)
+func Mount(
+	r chi.Router,
+	tileService *service.TileService,
+	userService *service.UserService,
+	boardService *service.BoardService,
+	historyService *service.HistoryService,
+	leaderboardService *service.LeaderboardService,
+	teamService *service.TeamService,
+	seasonService *service.SeasonService,
+	adminService *service.AdminService,
+	publisher pubsub.Publisher,
+	control *pubsub.ControlBus,
+	hub *ws.Hub,
+) {
+	tileHandler := NewTileHandler(tileService, userService, boardService)
+	userHandler := NewUserHandler(userService, control)
+	boardHandler := NewBoardHandler(boardService)
+	historyHandler := NewHistoryHandler(historyService)
+	leaderboardHandler := NewLeaderboardHandler(leaderboardService)
+	chunkHandler := NewChunkHandler(tileService, boardService)
+	teamHandler := NewTeamHandler(teamService)
+	seasonHandler := NewSeasonHandler(seasonService, boardService)
+	adminHandler := NewAdminHandler(adminService, publisher, control, hub)
+	authHandler := NewAuthHandler(userService, control)
+
+	r.Get("/.well-known/jwks.json", authHandler.JWKS)
 
 	r.Route("/api", func(api chi.Router) {
+		api.Route("/auth", func(auth chi.Router) {
+			auth.Post("/login", authHandler.Login)
+			auth.Post("/recover", authHandler.Recover)
+			auth.Post("/refresh", authHandler.Refresh)
+			auth.Post("/logout", authHandler.Logout)
+		})
+
+		api.With(requireAuth(userService), requireScope(domain.ScopeReadBoard)).Post("/ws/ticket", authHandler.WSTicket)
+
 		api.Route("/users", func(users chi.Router) {
 			users.Post("/register", userHandler.Register)
 			users.Get("/{id}", userHandler.GetByID)
+			users.Get("/{id}/rank", leaderboardHandler.GetRank)
 			users.Get("/online", userHandler.GetOnlineCount)
-			users.Get("/leaderboard", userHandler.GetLeaderboard)
+			users.Get("/leaderboard", leaderboardHandler.Get)
+			users.With(requireAuth(userService), requireScope(domain.ScopeReadBoard)).Get("/me/rank", leaderboardHandler.GetMyRank)
+			users.Group(func(me chi.Router) {
+				me.Use(requireAuth(userService), requireUserToken)
+				me.Post("/me/password", userHandler.SetPassword)
+				me.Get("/me/recovery-codes", userHandler.GetRecoveryCodes)
+				me.Post("/me/recovery-codes", userHandler.RegenerateRecoveryCodes)
+				me.Get("/me/keys", userHandler.ListAPIKeys)
+				me.Post("/me/keys", userHandler.CreateAPIKey)
+				me.Delete("/me/keys/{keyId}", userHandler.RevokeAPIKey)
+			})
+		})
+
+		api.Route("/teams", func(teams chi.Router) {
+			teams.Get("/", teamHandler.List)
+			teams.With(requireAuth(userService), requireScope(domain.ScopeClaim)).Post("/", teamHandler.Create)
+			teams.Get("/leaderboard", leaderboardHandler.GetTeams)
+			teams.With(requireAuth(userService), requireScope(domain.ScopeClaim)).Post("/leave", teamHandler.Leave)
+			teams.Get("/{id}", teamHandler.Get)
+			teams.With(requireAuth(userService), requireScope(domain.ScopeClaim)).Post("/{id}/join", teamHandler.Join)
+		})
+
+		api.Route("/seasons", func(seasons chi.Router) {
+			seasons.Get("/", seasonHandler.List)
+			seasons.Get("/current", seasonHandler.GetCurrent)
+			seasons.Get("/{id}", seasonHandler.Get)
+			seasons.Get("/{id}/board", seasonHandler.GetBoard)
+		})
+
+		api.Route("/admin", func(admin chi.Router) {
+			admin.Use(requireAuth(userService), requireAdmin(userService))
+			admin.Post("/tiles/{tileId}/unclaim", adminHandler.UnclaimTile)
+			admin.Post("/tiles/{tileId}/reassign", adminHandler.ReassignTile)
+			admin.Post("/users/{id}/ban", adminHandler.Ban)
+			admin.Post("/users/{id}/unban", adminHandler.Unban)
+			admin.Post("/users/{id}/disconnect", adminHandler.Disconnect)
+			admin.Post("/regions/reset", adminHandler.ResetRegion)
+			admin.Post("/announcements", adminHandler.Announce)
+			admin.Get("/audit", adminHandler.AuditLog)
+			admin.Get("/ws/stats", adminHandler.WSStats)
 		})
 
 		api.Route("/board", func(board chi.Router) {
 			board.Get("/", tileHandler.GetBoard)
 			board.Get("/stats", tileHandler.GetStats)
+			board.Get("/chunks/{cx}/{cy}", chunkHandler.Get)
+		})
+
+		api.Route("/boards", func(boards chi.Router) {
+			boards.Get("/", boardHandler.List)
+			boards.With(requireAuth(userService), requireAdmin(userService)).Post("/", boardHandler.Create)
+			boards.Get("/{boardId}", boardHandler.Get)
+			boards.Get("/{boardId}/snapshot", historyHandler.GetSnapshot)
+			boards.Get("/{boardId}/events", historyHandler.ListEvents)
+			boards.Get("/{boardId}/replay", historyHandler.Replay)
 		})
 	})
 }
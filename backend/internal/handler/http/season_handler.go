@@ -0,0 +1,105 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/service"
+)
+
+type SeasonHandler struct {
+	seasonService *service.SeasonService
+	boardService  *service.BoardService
+}
+
+func NewSeasonHandler(seasonService *service.SeasonService, boardService *service.BoardService) *SeasonHandler {
+	return &SeasonHandler{seasonService: seasonService, boardService: boardService}
+}
+
+func (h *SeasonHandler) List(w http.ResponseWriter, r *http.Request) {
+	seasons, err := h.seasonService.List(r.Context(), boardIDParam(r))
+	if err != nil {
+		respondSeasonError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"seasons": seasons,
+	})
+}
+
+func (h *SeasonHandler) GetCurrent(w http.ResponseWriter, r *http.Request) {
+	season, err := h.seasonService.Current(r.Context(), boardIDParam(r))
+	if err != nil {
+		respondSeasonError(w, err)
+		return
+	}
+	if season == nil {
+		respondError(w, http.StatusNotFound, "No season running")
+		return
+	}
+	respondJSON(w, http.StatusOK, season)
+}
+
+func (h *SeasonHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := seasonIDParam(w, r)
+	if !ok {
+		return
+	}
+	results, err := h.seasonService.Results(r.Context(), id)
+	if err != nil {
+		respondSeasonError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, results)
+}
+
+// GetBoard returns an ended season's final board. Only claimed tiles are
+// listed; every other tile was unclaimed.
+func (h *SeasonHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
+	id, ok := seasonIDParam(w, r)
+	if !ok {
+		return
+	}
+	season, tiles, err := h.seasonService.FinalBoard(r.Context(), id)
+	if err != nil {
+		respondSeasonError(w, err)
+		return
+	}
+	board, err := h.boardService.Get(r.Context(), season.BoardID)
+	if err != nil {
+		respondBoardError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"season":       season,
+		"tiles":        tiles,
+		"gridWidth":    board.Width,
+		"gridHeight":   board.Height,
+		"totalTiles":   board.TileCount(),
+		"claimedTiles": len(tiles),
+	})
+}
+
+func seasonIDParam(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		respondError(w, http.StatusBadRequest, "Invalid season id")
+		return 0, false
+	}
+	return id, true
+}
+
+func respondSeasonError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrSeasonNotFound):
+		respondError(w, http.StatusNotFound, "Season not found")
+	case errors.Is(err, domain.ErrBoardNotFound):
+		respondError(w, http.StatusNotFound, "Board not found")
+	default:
+		respondError(w, http.StatusInternalServerError, "Failed to load seasons")
+	}
+}
@@ -0,0 +1,107 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/service"
+)
+
+type TeamHandler struct {
+	teamService *service.TeamService
+}
+
+func NewTeamHandler(teamService *service.TeamService) *TeamHandler {
+	return &TeamHandler{teamService: teamService}
+}
+
+func (h *TeamHandler) List(w http.ResponseWriter, r *http.Request) {
+	teams, err := h.teamService.List(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list teams")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"teams": teams,
+	})
+}
+
+func (h *TeamHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid team id")
+		return
+	}
+	team, err := h.teamService.Get(r.Context(), id)
+	if err != nil {
+		respondTeamError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, team)
+}
+
+func (h *TeamHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	team, err := h.teamService.Create(r.Context(), payload.Name, payload.Color, currentUserID(r))
+	if err != nil {
+		if errors.Is(err, domain.ErrTeamExists) {
+			respondJSON(w, http.StatusConflict, map[string]string{
+				"error": "Team already exists",
+				"code":  "TEAM_EXISTS",
+			})
+			return
+		}
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusCreated, team)
+}
+
+func (h *TeamHandler) Join(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid team id")
+		return
+	}
+	team, err := h.teamService.Join(r.Context(), id, currentUserID(r))
+	if err != nil {
+		respondTeamError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, team)
+}
+
+func (h *TeamHandler) Leave(w http.ResponseWriter, r *http.Request) {
+	if err := h.teamService.Leave(r.Context(), currentUserID(r)); err != nil {
+		respondTeamError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondTeamError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, domain.ErrTeamNotFound):
+		respondError(w, http.StatusNotFound, "Team not found")
+	case errors.Is(err, domain.ErrNotInTeam):
+		respondJSON(w, http.StatusConflict, map[string]string{
+			"error": "Not in a team",
+			"code":  "NOT_IN_TEAM",
+		})
+	default:
+		respondError(w, http.StatusInternalServerError, "Failed to update team")
+	}
+}
@@ -7,21 +7,30 @@ import (
 )
 
 type TileHandler struct {
-	tileService *service.TileService
-	userService *service.UserService
+	tileService  *service.TileService
+	userService  *service.UserService
+	boardService *service.BoardService
 }
 
-func NewTileHandler(tileService *service.TileService, userService *service.UserService) *TileHandler {
-	return &TileHandler{tileService: tileService, userService: userService}
+func NewTileHandler(
+	tileService *service.TileService,
+	userService *service.UserService,
+	boardService *service.BoardService,
+) *TileHandler {
+	return &TileHandler{tileService: tileService, userService: userService, boardService: boardService}
 }
 
 func (h *TileHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
-	tiles, err := h.tileService.GetAllTiles(r.Context())
+	board, err := h.boardService.Get(r.Context(), boardIDParam(r))
+	if err != nil {
+		respondBoardError(w, err)
+		return
+	}
+	tiles, err := h.tileService.GetAllTiles(r.Context(), board.ID)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to load board")
 		return
 	}
-	gridWidth, gridHeight := h.tileService.GridSize()
 	total := len(tiles)
 	claimed := 0
 	for _, tile := range tiles {
@@ -30,18 +39,24 @@ func (h *TileHandler) GetBoard(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"boardId":      board.ID,
 		"tiles":        tiles,
-		"gridWidth":    gridWidth,
-		"gridHeight":   gridHeight,
+		"gridWidth":    board.Width,
+		"gridHeight":   board.Height,
 		"totalTiles":   total,
 		"claimedTiles": claimed,
 	})
 }
 
 func (h *TileHandler) GetStats(w http.ResponseWriter, r *http.Request) {
-	onlineCount, _ := h.userService.OnlineCount(r.Context())
+	board, err := h.boardService.Get(r.Context(), boardIDParam(r))
+	if err != nil {
+		respondBoardError(w, err)
+		return
+	}
+	onlineCount, _ := h.userService.OnlineCount(r.Context(), board.ID)
 	totalUsers, _ := h.userService.CountUsers(r.Context())
-	stats, err := h.tileService.GetBoardStats(r.Context(), onlineCount, totalUsers)
+	stats, err := h.tileService.GetBoardStats(r.Context(), board, onlineCount, totalUsers)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to get stats")
 		return
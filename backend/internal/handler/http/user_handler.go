@@ -2,33 +2,45 @@ package http
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/handler/ws"
+	"ownthegrid/internal/pubsub"
 	"ownthegrid/internal/service"
 )
 
 type UserHandler struct {
 	userService *service.UserService
+	control     *pubsub.ControlBus
 }
 
-func NewUserHandler(userService *service.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService *service.UserService, control *pubsub.ControlBus) *UserHandler {
+	return &UserHandler{userService: userService, control: control}
 }
 
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
 		Username string `json:"username"`
+		Password string `json:"password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid payload")
 		return
 	}
 
-	user, err := h.userService.Register(r.Context(), payload.Username)
+	user, err := h.userService.Register(r.Context(), payload.Username, payload.Password, clientIP(r))
 	if err != nil {
+		var rateErr *domain.RateLimitError
+		if errors.As(err, &rateErr) {
+			respondRateLimited(w, rateErr)
+			return
+		}
 		if err == service.ErrUsernameTaken {
 			respondJSON(w, http.StatusConflict, map[string]string{
 				"error": "Username already taken",
@@ -40,18 +52,127 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if user.Token != "" {
-		http.SetCookie(w, &http.Cookie{
-			Name:     "otg_token",
-			Value:    user.Token,
-			Path:     "/",
-			HttpOnly: true,
-			SameSite: http.SameSiteLaxMode,
-			Secure:   r.TLS != nil,
+	setSessionCookies(w, r, user)
+	respondJSON(w, http.StatusCreated, user)
+}
+
+// SetPassword sets the caller's password, or changes it given the current
+// one, and signs out their other sessions.
+func (h *UserHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		CurrentPassword string `json:"currentPassword"`
+		Password        string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	revoked, err := h.userService.SetPassword(r.Context(), claimsFromRequest(r), payload.CurrentPassword, payload.Password, clientIP(r))
+	if err != nil {
+		respondReauthError(w, err, "Failed to set password")
+		return
+	}
+	closeSessions(r, h.control, revoked)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *UserHandler) GetRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	remaining, err := h.userService.RemainingRecoveryCodes(r.Context(), currentUserID(r))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to count recovery codes")
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]int{"remaining": remaining})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes, given their
+// current password if they have one, and signs out their other sessions. The
+// new codes are only ever returned here.
+func (h *UserHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		CurrentPassword string `json:"currentPassword"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid payload")
+			return
+		}
+	}
+
+	codes, revoked, err := h.userService.RegenerateRecoveryCodes(r.Context(), claimsFromRequest(r), payload.CurrentPassword, clientIP(r))
+	if err != nil {
+		respondReauthError(w, err, "Failed to generate recovery codes")
+		return
+	}
+	closeSessions(r, h.control, revoked)
+	respondJSON(w, http.StatusOK, map[string][]string{"recoveryCodes": codes})
+}
+
+func (h *UserHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.userService.ListAPIKeys(r.Context(), currentUserID(r))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list API keys")
+		return
+	}
+	respondJSON(w, http.StatusOK, keys)
+}
+
+// CreateAPIKey creates a key for the caller. Its secret is only ever
+// returned here.
+func (h *UserHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		RatePerMinute int      `json:"ratePerMinute"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid payload")
+		return
+	}
+
+	key, err := h.userService.CreateAPIKey(r.Context(), currentUserID(r), payload.Name, payload.Scopes, payload.RatePerMinute)
+	switch {
+	case err == nil:
+		respondJSON(w, http.StatusCreated, key)
+	case errors.Is(err, service.ErrAPIKeyInvalid), errors.Is(err, service.ErrAPIKeyRate):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrAPIKeyLimit):
+		respondJSON(w, http.StatusConflict, map[string]string{
+			"error": err.Error(),
+			"code":  "API_KEY_LIMIT",
+		})
+	case errors.Is(err, domain.ErrScopeDenied):
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "Only admins can grant the admin scope",
+			"code":  "SCOPE_DENIED",
 		})
+	default:
+		respondError(w, http.StatusInternalServerError, "Failed to create API key")
 	}
+}
 
-	respondJSON(w, http.StatusCreated, user)
+func (h *UserHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "keyId"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid key id")
+		return
+	}
+
+	userID := currentUserID(r)
+	err = h.userService.RevokeAPIKey(r.Context(), userID, id)
+	switch {
+	case err == nil:
+		// Connections opened with the key are tracked under its id.
+		if err := h.control.DisconnectSession(r.Context(), userID.String(), id.String(), ws.CloseRevoked, "api key revoked"); err != nil {
+			log.Printf("Disconnect API key %s failed: %v", id, err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, domain.ErrAPIKeyNotFound):
+		respondError(w, http.StatusNotFound, "API key not found")
+	default:
+		respondError(w, http.StatusInternalServerError, "Failed to revoke API key")
+	}
 }
 
 func (h *UserHandler) GetByID(w http.ResponseWriter, r *http.Request) {
@@ -73,19 +194,8 @@ func (h *UserHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, user)
 }
 
-func (h *UserHandler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
-	leaderboard, err := h.userService.GetLeaderboard(r.Context(), 10)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to get leaderboard")
-		return
-	}
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"leaderboard": leaderboard,
-	})
-}
-
 func (h *UserHandler) GetOnlineCount(w http.ResponseWriter, r *http.Request) {
-	users, err := h.userService.ListOnlineUsers(r.Context())
+	users, err := h.userService.ListOnlineUsers(r.Context(), boardIDParam(r))
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to get online users")
 		return
@@ -95,3 +205,27 @@ func (h *UserHandler) GetOnlineCount(w http.ResponseWriter, r *http.Request) {
 		"onlineCount": len(users),
 	})
 }
+
+// respondReauthError answers a failed credential change, failing with
+// message on unexpected errors.
+func respondReauthError(w http.ResponseWriter, err error, message string) {
+	var rateErr *domain.RateLimitError
+	switch {
+	case errors.As(err, &rateErr):
+		respondRateLimited(w, rateErr)
+	case errors.Is(err, service.ErrPasswordInvalid):
+		respondError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, domain.ErrInvalidCredentials):
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": "Current password is wrong",
+			"code":  "INVALID_CREDENTIALS",
+		})
+	case errors.Is(err, service.ErrReauthRequired):
+		respondJSON(w, http.StatusForbidden, map[string]string{
+			"error": err.Error(),
+			"code":  "REAUTH_REQUIRED",
+		})
+	default:
+		respondError(w, http.StatusInternalServerError, message)
+	}
+}
@@ -0,0 +1,46 @@
+package ws
+
+import "bytes"
+
+// Clients that connect with batch=1 have messages that queued up while the
+// previous write was in flight coalesced into a single BATCH frame. Each
+// inner message keeps its own seq.
+const (
+	MsgTypeBatch = "BATCH"
+
+	// compressThreshold is the smallest frame worth running through
+	// permessage-deflate.
+	compressThreshold = 256
+	maxBatchBytes     = 64 * 1024
+)
+
+// encodeBatch wraps several messages in one BATCH envelope, or a frameBatch
+// holding length-prefixed frames for binary clients.
+func (c *Client) encodeBatch(batch [][]byte) []byte {
+	if len(batch) == 1 {
+		return batch[0]
+	}
+	if c.binary {
+		w := newFrame(frameBatch, 0)
+		w.int(len(batch))
+		for _, message := range batch {
+			w.bytes(message)
+		}
+		return w.buf
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`{"type":"` + MsgTypeBatch + `","payload":{"messages":[`)
+	for i, message := range batch {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(message)
+	}
+	buf.WriteString(`]}}`)
+	return buf.Bytes()
+}
+
+func (c *Client) writeFrame(messageType int, data []byte) error {
+	c.conn.EnableWriteCompression(len(data) >= compressThreshold)
+	return c.conn.WriteMessage(messageType, data)
+}
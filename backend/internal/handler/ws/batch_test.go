@@ -0,0 +1,63 @@
+package ws
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEncodeBatch(t *testing.T) {
+	messages := [][]byte{[]byte(`{"seq":1}`), []byte(`{"seq":2}`)}
+	tests := []struct {
+		name   string
+		binary bool
+		batch  [][]byte
+	}{
+		{"single JSON", false, messages[:1]},
+		{"single binary", true, messages[:1]},
+		{"JSON", false, messages},
+		{"binary", true, messages},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := (&Client{binary: tt.binary}).encodeBatch(tt.batch)
+			switch {
+			case len(tt.batch) == 1:
+				if string(got) != string(tt.batch[0]) {
+					t.Fatalf("encodeBatch() = %s, want the message unwrapped", got)
+				}
+			case tt.binary:
+				r, frameType, seq := readFrame(t, got)
+				if frameType != frameBatch || seq != 0 {
+					t.Fatalf("frame type %d seq %d", frameType, seq)
+				}
+				if n := r.uvarint(); n != uint64(len(tt.batch)) {
+					t.Fatalf("%d frames, want %d", n, len(tt.batch))
+				}
+				for _, message := range tt.batch {
+					if frame := r.bytes(); string(frame) != string(message) {
+						t.Fatalf("frame %s, want %s", frame, message)
+					}
+				}
+				r.done()
+			default:
+				var envelope struct {
+					Type    string `json:"type"`
+					Payload struct {
+						Messages []json.RawMessage `json:"messages"`
+					} `json:"payload"`
+				}
+				if err := json.Unmarshal(got, &envelope); err != nil {
+					t.Fatalf("encodeBatch() = %s: %v", got, err)
+				}
+				if envelope.Type != MsgTypeBatch || len(envelope.Payload.Messages) != len(tt.batch) {
+					t.Fatalf("encodeBatch() = %s", got)
+				}
+				for i, message := range tt.batch {
+					if string(envelope.Payload.Messages[i]) != string(message) {
+						t.Fatalf("message %d = %s, want %s", i, envelope.Payload.Messages[i], message)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package ws
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+)
+
+// Clients opt into the binary protocol by offering binarySubprotocol in
+// Sec-WebSocket-Protocol; everyone else gets JSON text frames. Client to
+// server messages stay JSON in both cases.
+//
+// Every binary frame starts with a frame type byte and the broadcast seq as
+// a uvarint (0 for direct messages). Integers are uvarints unless noted,
+// strings are a uvarint length followed by UTF-8 bytes, user ids are 16 raw
+// bytes and timestamps are varint unix milliseconds.
+//
+//	frameJSON          the JSON envelope, unchanged
+//	frameTileClaimed   tileId x y userId username color claimedAt
+//	                   chunkVersion hasPrevious(byte) [previousOwner]
+//	                   hasTeam(byte) [teamId teamName]
+//	frameInitBoard,    metaLen meta (the JSON payload without tiles)
+//	frameViewport      ownerCount {userId username color
+//	                   hasTeam(byte) [teamId teamName]}
+//	                   tileCount {id x y owner [claimedAt]}
+//	frameBatch         count {frameLen frame}
+//
+// A tile's owner is an index into the owner list, with 0 meaning unclaimed;
+// claimedAt is only present for claimed tiles.
+const (
+	jsonSubprotocol   = "otg.json"
+	binarySubprotocol = "otg.bin.v1"
+)
+
+const (
+	frameJSON byte = iota
+	frameTileClaimed
+	frameInitBoard
+	frameViewport
+	frameBatch
+)
+
+type frameWriter struct {
+	buf []byte
+}
+
+func (w *frameWriter) uvarint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *frameWriter) varint(v int64) {
+	w.buf = binary.AppendVarint(w.buf, v)
+}
+
+func (w *frameWriter) int(v int) {
+	w.uvarint(uint64(v))
+}
+
+func (w *frameWriter) string(s string) {
+	w.int(len(s))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *frameWriter) bytes(b []byte) {
+	w.int(len(b))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *frameWriter) uuid(id uuid.UUID) {
+	w.buf = append(w.buf, id[:]...)
+}
+
+func (w *frameWriter) time(t time.Time) {
+	w.varint(t.UnixMilli())
+}
+
+// team writes a presence byte followed by the team id and name when id is
+// set.
+func (w *frameWriter) team(id *uuid.UUID, name string) {
+	if id == nil {
+		w.buf = append(w.buf, 0)
+		return
+	}
+	w.buf = append(w.buf, 1)
+	w.uuid(*id)
+	w.string(name)
+}
+
+func newFrame(frameType byte, seq int64) *frameWriter {
+	w := &frameWriter{buf: make([]byte, 0, 64)}
+	w.buf = append(w.buf, frameType)
+	w.uvarint(uint64(seq))
+	return w
+}
+
+// toBinaryFrame converts a JSON envelope into a binary frame. Messages
+// without a dedicated layout are wrapped as frameJSON.
+func toBinaryFrame(message []byte) []byte {
+	var envelope struct {
+		Seq     int64           `json:"seq"`
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return jsonFrame(0, message)
+	}
+	if envelope.Type == MsgTypeTileClaimed {
+		if frame, ok := tileClaimedFrame(envelope.Seq, envelope.Payload); ok {
+			return frame
+		}
+	}
+	return jsonFrame(envelope.Seq, message)
+}
+
+func jsonFrame(seq int64, message []byte) []byte {
+	w := newFrame(frameJSON, seq)
+	w.buf = append(w.buf, message...)
+	return w.buf
+}
+
+func tileClaimedFrame(seq int64, payload json.RawMessage) ([]byte, bool) {
+	var claim struct {
+		TileID        int        `json:"tileId"`
+		X             int        `json:"x"`
+		Y             int        `json:"y"`
+		UserID        uuid.UUID  `json:"userId"`
+		Username      string     `json:"username"`
+		Color         string     `json:"color"`
+		ClaimedAt     *time.Time `json:"claimedAt"`
+		ChunkVersion  int64      `json:"chunkVersion"`
+		PreviousOwner *uuid.UUID `json:"previousOwner"`
+		TeamID        *uuid.UUID `json:"teamId"`
+		TeamName      string     `json:"teamName"`
+	}
+	if err := json.Unmarshal(payload, &claim); err != nil || claim.ClaimedAt == nil {
+		return nil, false
+	}
+	w := newFrame(frameTileClaimed, seq)
+	w.int(claim.TileID)
+	w.int(claim.X)
+	w.int(claim.Y)
+	w.uuid(claim.UserID)
+	w.string(claim.Username)
+	w.string(claim.Color)
+	w.time(*claim.ClaimedAt)
+	w.uvarint(uint64(claim.ChunkVersion))
+	if claim.PreviousOwner != nil {
+		w.buf = append(w.buf, 1)
+		w.uuid(*claim.PreviousOwner)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+	w.team(claim.TeamID, claim.TeamName)
+	return w.buf, true
+}
+
+// tilesFrame encodes an INIT_BOARD or VIEWPORT_SNAPSHOT directly from the
+// tiles, deduplicating owners.
+func tilesFrame(frameType byte, seq int64, meta map[string]interface{}, tiles []domain.Tile) ([]byte, error) {
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	type owner struct {
+		id       uuid.UUID
+		username string
+		color    string
+		teamID   *uuid.UUID
+		teamName string
+	}
+	owners := []owner{}
+	ownerIndex := map[uuid.UUID]int{}
+	for _, tile := range tiles {
+		if tile.OwnerID == nil {
+			continue
+		}
+		if _, ok := ownerIndex[*tile.OwnerID]; ok {
+			continue
+		}
+		o := owner{id: *tile.OwnerID}
+		if tile.OwnerUsername != nil {
+			o.username = *tile.OwnerUsername
+		}
+		if tile.OwnerColor != nil {
+			o.color = *tile.OwnerColor
+		}
+		o.teamID = tile.OwnerTeamID
+		if tile.OwnerTeamName != nil {
+			o.teamName = *tile.OwnerTeamName
+		}
+		owners = append(owners, o)
+		ownerIndex[o.id] = len(owners)
+	}
+
+	w := newFrame(frameType, seq)
+	w.bytes(metaBytes)
+	w.int(len(owners))
+	for _, o := range owners {
+		w.uuid(o.id)
+		w.string(o.username)
+		w.string(o.color)
+		w.team(o.teamID, o.teamName)
+	}
+	w.int(len(tiles))
+	for _, tile := range tiles {
+		w.int(tile.ID)
+		w.int(tile.X)
+		w.int(tile.Y)
+		if tile.OwnerID == nil {
+			w.int(0)
+			continue
+		}
+		w.int(ownerIndex[*tile.OwnerID])
+		if tile.ClaimedAt != nil {
+			w.time(*tile.ClaimedAt)
+		} else {
+			w.varint(0)
+		}
+	}
+	return w.buf, nil
+}
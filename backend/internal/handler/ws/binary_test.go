@@ -0,0 +1,267 @@
+package ws
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+)
+
+// frameReader decodes the fields frameWriter writes, failing the test on a
+// short frame.
+type frameReader struct {
+	t   *testing.T
+	buf []byte
+}
+
+func readFrame(t *testing.T, frame []byte) (*frameReader, byte, uint64) {
+	t.Helper()
+	if len(frame) == 0 {
+		t.Fatal("empty frame")
+	}
+	r := &frameReader{t: t, buf: frame[1:]}
+	return r, frame[0], r.uvarint()
+}
+
+func (r *frameReader) byte() byte {
+	r.t.Helper()
+	if len(r.buf) == 0 {
+		r.t.Fatal("frame ended early")
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *frameReader) uvarint() uint64 {
+	r.t.Helper()
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.t.Fatal("bad uvarint")
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *frameReader) varint() int64 {
+	r.t.Helper()
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.t.Fatal("bad varint")
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *frameReader) bytes() []byte {
+	r.t.Helper()
+	n := int(r.uvarint())
+	if len(r.buf) < n {
+		r.t.Fatalf("want %d bytes, %d left", n, len(r.buf))
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *frameReader) string() string {
+	r.t.Helper()
+	return string(r.bytes())
+}
+
+func (r *frameReader) uuid() uuid.UUID {
+	r.t.Helper()
+	if len(r.buf) < 16 {
+		r.t.Fatalf("want 16 bytes, %d left", len(r.buf))
+	}
+	id, _ := uuid.FromBytes(r.buf[:16])
+	r.buf = r.buf[16:]
+	return id
+}
+
+func (r *frameReader) done() {
+	r.t.Helper()
+	if len(r.buf) != 0 {
+		r.t.Fatalf("%d bytes left over", len(r.buf))
+	}
+}
+
+func TestFrameWriterVarints(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *frameWriter)
+		want  []byte
+	}{
+		{"zero", func(w *frameWriter) { w.int(0) }, []byte{0x00}},
+		{"one byte", func(w *frameWriter) { w.int(127) }, []byte{0x7f}},
+		{"two bytes", func(w *frameWriter) { w.int(300) }, []byte{0xac, 0x02}},
+		{"negative varint", func(w *frameWriter) { w.varint(-1) }, []byte{0x01}},
+		{"positive varint", func(w *frameWriter) { w.varint(1) }, []byte{0x02}},
+		{"string", func(w *frameWriter) { w.string("hi") }, []byte{0x02, 'h', 'i'}},
+		{"empty string", func(w *frameWriter) { w.string("") }, []byte{0x00}},
+		{"no team", func(w *frameWriter) { w.team(nil, "ignored") }, []byte{0x00}},
+		{"time", func(w *frameWriter) { w.time(time.UnixMilli(150)) }, []byte{0xac, 0x02}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &frameWriter{}
+			tt.write(w)
+			if string(w.buf) != string(tt.want) {
+				t.Fatalf("wrote % x, want % x", w.buf, tt.want)
+			}
+		})
+	}
+}
+
+func TestToBinaryFrame(t *testing.T) {
+	user, previous, team := uuid.New(), uuid.New(), uuid.New()
+	claimedAt := time.UnixMilli(1700000000123).UTC()
+	claim := func(payload map[string]interface{}) []byte {
+		message, err := json.Marshal(map[string]interface{}{"seq": 42, "type": MsgTypeTileClaimed, "payload": payload})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+	base := func() map[string]interface{} {
+		return map[string]interface{}{
+			"tileId": 1234, "x": 12, "y": 34, "userId": user, "username": "alice",
+			"color": "#ff0000", "claimedAt": claimedAt, "chunkVersion": 9,
+		}
+	}
+	withPrevious := base()
+	withPrevious["previousOwner"] = previous
+	withTeam := base()
+	withTeam["teamId"], withTeam["teamName"] = team, "reds"
+	withoutTime := base()
+	delete(withoutTime, "claimedAt")
+
+	tests := []struct {
+		name         string
+		message      []byte
+		wantType     byte
+		wantSeq      uint64
+		wantPrevious *uuid.UUID
+		wantTeam     *uuid.UUID
+	}{
+		{"claim", claim(base()), frameTileClaimed, 42, nil, nil},
+		{"claim over a previous owner", claim(withPrevious), frameTileClaimed, 42, &previous, nil},
+		{"claim by a team member", claim(withTeam), frameTileClaimed, 42, nil, &team},
+		{"claim without a time", claim(withoutTime), frameJSON, 42, nil, nil},
+		{"other message", []byte(`{"seq":7,"type":"LEADERBOARD_UPDATE","payload":{}}`), frameJSON, 7, nil, nil},
+		{"direct message", []byte(`{"type":"PONG"}`), frameJSON, 0, nil, nil},
+		{"not JSON", []byte(`nope`), frameJSON, 0, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, frameType, seq := readFrame(t, toBinaryFrame(tt.message))
+			if frameType != tt.wantType || seq != tt.wantSeq {
+				t.Fatalf("frame type %d seq %d, want type %d seq %d", frameType, seq, tt.wantType, tt.wantSeq)
+			}
+			if frameType == frameJSON {
+				if string(r.buf) != string(tt.message) {
+					t.Fatalf("wrapped %s, want %s", r.buf, tt.message)
+				}
+				return
+			}
+			if id, x, y := r.uvarint(), r.uvarint(), r.uvarint(); id != 1234 || x != 12 || y != 34 {
+				t.Fatalf("tile %d at %d,%d, want 1234 at 12,34", id, x, y)
+			}
+			if got := r.uuid(); got != user {
+				t.Fatalf("user = %s, want %s", got, user)
+			}
+			if username, color := r.string(), r.string(); username != "alice" || color != "#ff0000" {
+				t.Fatalf("owner %q %q", username, color)
+			}
+			if got := r.varint(); got != claimedAt.UnixMilli() {
+				t.Fatalf("claimedAt = %d, want %d", got, claimedAt.UnixMilli())
+			}
+			if got := r.uvarint(); got != 9 {
+				t.Fatalf("chunkVersion = %d, want 9", got)
+			}
+			if has := r.byte() == 1; has != (tt.wantPrevious != nil) {
+				t.Fatalf("hasPrevious = %v", has)
+			} else if has && r.uuid() != *tt.wantPrevious {
+				t.Fatal("wrong previous owner")
+			}
+			if has := r.byte() == 1; has != (tt.wantTeam != nil) {
+				t.Fatalf("hasTeam = %v", has)
+			} else if has && (r.uuid() != *tt.wantTeam || r.string() != "reds") {
+				t.Fatal("wrong team")
+			}
+			r.done()
+		})
+	}
+}
+
+func TestTilesFrame(t *testing.T) {
+	alice, bob, team := uuid.New(), uuid.New(), uuid.New()
+	aliceName, aliceColor := "alice", "#ff0000"
+	bobName, bobColor, teamName := "bob", "#00ff00", "greens"
+	claimedAt := time.UnixMilli(1700000000000)
+	tiles := []domain.Tile{
+		{ID: 1, X: 0, Y: 0},
+		{ID: 2, X: 1, Y: 0, OwnerID: &alice, OwnerUsername: &aliceName, OwnerColor: &aliceColor, ClaimedAt: &claimedAt},
+		{ID: 3, X: 0, Y: 1, OwnerID: &bob, OwnerUsername: &bobName, OwnerColor: &bobColor, OwnerTeamID: &team, OwnerTeamName: &teamName, ClaimedAt: &claimedAt},
+		{ID: 4, X: 1, Y: 1, OwnerID: &alice, OwnerUsername: &aliceName, OwnerColor: &aliceColor},
+	}
+	frame, err := tilesFrame(frameViewport, 0, map[string]interface{}{"x": 0}, tiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, frameType, seq := readFrame(t, frame)
+	if frameType != frameViewport || seq != 0 {
+		t.Fatalf("frame type %d seq %d", frameType, seq)
+	}
+	if meta := string(r.bytes()); meta != `{"x":0}` {
+		t.Fatalf("meta = %s", meta)
+	}
+	owners := []struct {
+		id    uuid.UUID
+		name  string
+		color string
+		team  *uuid.UUID
+	}{{alice, aliceName, aliceColor, nil}, {bob, bobName, bobColor, &team}}
+	if n := r.uvarint(); n != uint64(len(owners)) {
+		t.Fatalf("%d owners, want %d", n, len(owners))
+	}
+	for _, want := range owners {
+		if id, name, color := r.uuid(), r.string(), r.string(); id != want.id || name != want.name || color != want.color {
+			t.Fatalf("owner %s %q %q, want %s %q %q", id, name, color, want.id, want.name, want.color)
+		}
+		if has := r.byte() == 1; has != (want.team != nil) {
+			t.Fatalf("owner %s hasTeam = %v", want.name, has)
+		} else if has && (r.uuid() != *want.team || r.string() != teamName) {
+			t.Fatalf("owner %s has the wrong team", want.name)
+		}
+	}
+	want := []struct {
+		id, x, y, owner uint64
+		claimedAt       int64
+	}{
+		{1, 0, 0, 0, 0},
+		{2, 1, 0, 1, claimedAt.UnixMilli()},
+		{3, 0, 1, 2, claimedAt.UnixMilli()},
+		{4, 1, 1, 1, 0},
+	}
+	if n := r.uvarint(); n != uint64(len(want)) {
+		t.Fatalf("%d tiles, want %d", n, len(want))
+	}
+	for _, tile := range want {
+		if id, x, y, owner := r.uvarint(), r.uvarint(), r.uvarint(), r.uvarint(); id != tile.id || x != tile.x || y != tile.y || owner != tile.owner {
+			t.Fatalf("tile %d at %d,%d owner %d, want %+v", id, x, y, owner, tile)
+		}
+		if tile.owner == 0 {
+			continue
+		}
+		if got := r.varint(); got != tile.claimedAt {
+			t.Fatalf("tile %d claimedAt = %d, want %d", tile.id, got, tile.claimedAt)
+		}
+	}
+	r.done()
+}
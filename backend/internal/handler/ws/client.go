@@ -4,10 +4,14 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"ownthegrid/internal/domain"
 )
 
 const (
@@ -15,25 +19,233 @@ const (
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
 	maxMessageSize = 1024
+	sendBufferSize = 256
+	maxPending     = 1024
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+func newUpgrader(compression bool, allowedOrigins []string) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		Subprotocols:      []string{binarySubprotocol, jsonSubprotocol},
+		EnableCompression: compression,
+		CheckOrigin:       originChecker(allowedOrigins),
+	}
+}
+
+// originChecker accepts handshakes from the allowed origins. Browsers always
+// send Origin, so requests without one come from other clients, which can't
+// ride on a user's cookies and are let through to authenticate themselves.
+func originChecker(allowed []string) func(r *http.Request) bool {
+	origins := make(map[string]bool, len(allowed))
+	for _, origin := range allowed {
+		origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" || origins["*"] || origins[strings.ToLower(origin)] {
+			return true
+		}
+		log.Printf("WS: rejected origin %q", origin)
+		return false
+	}
 }
 
 type Client struct {
 	hub          *Hub
+	shard        *shard
 	conn         *websocket.Conn
-	send         chan []byte
+	out          *outbox
 	UserID       string
 	Username     string
+	BoardID      string
+	SessionID    string
+	CanClaim     bool
 	onDisconnect func()
 	lastPong     time.Time
 	lastPongMu   sync.Mutex
+	registered   chan struct{}
+	firstOnBoard bool
+	done         chan struct{}
+	closeOnce    sync.Once
+	closeCode    int
+	closeText    string
+
+	// binary clients negotiated binarySubprotocol and are sent binary frames.
+	binary bool
+	// maxBatch is how many queued messages may share one frame.
+	maxBatch int
+
+	// viewport limits which tile events the client receives; nil means the
+	// whole board. Guarded by the shard's mu once the client is registered.
+	viewport *domain.Viewport
+
+	// While resuming, broadcasts are parked in pending so they can't overtake
+	// the snapshot or replayed events. lastSeq drops anything already seen.
+	deliverMu       sync.Mutex
+	resuming        bool
+	pending         []sequenced
+	pendingOverflow bool
+	lastSeq         int64
+
+	resyncRequested atomic.Bool
+}
+
+type sequenced struct {
+	seq     int64
+	msgType string
+	message []byte
+}
+
+func newClient(hub *Hub, conn *websocket.Conn) *Client {
+	return &Client{
+		hub:        hub,
+		conn:       conn,
+		out:        newOutbox(sendBufferSize, hub.opts.SlowConsumer),
+		registered: make(chan struct{}),
+		done:       make(chan struct{}),
+		closeCode:  websocket.CloseNormalClosure,
+		resuming:   true,
+		binary:     conn.Subprotocol() == binarySubprotocol,
+		maxBatch:   1,
+	}
+}
+
+// frame converts a JSON envelope into the client's wire format.
+func (c *Client) frame(message []byte) []byte {
+	if c.binary {
+		return toBinaryFrame(message)
+	}
+	return message
+}
+
+func (c *Client) close() {
+	c.closeWith(websocket.CloseNormalClosure, "")
+}
+
+// closeWith closes the client, sending code and text in the close frame.
+func (c *Client) closeWith(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeCode, c.closeText = code, text
+		close(c.done)
+	})
+}
+
+func (c *Client) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendDirect queues a message meant for this client alone. It returns false
+// when the slow-consumer policy says the client must be disconnected.
+func (c *Client) sendDirect(msgType string, message []byte) bool {
+	if c.closed() {
+		return true
+	}
+	return c.push(outbound{msgType: msgType, data: message, direct: true}, false)
+}
+
+// enqueue queues message regardless of the outbox limit. It is used for
+// snapshots and replays, which are bounded and must not be dropped.
+func (c *Client) enqueue(message []byte) bool {
+	if c.closed() {
+		return false
+	}
+	return c.push(outbound{data: message, direct: true}, true)
+}
+
+func (c *Client) push(msg outbound, force bool) bool {
+	res := c.out.push(msg, force)
+	stats := &c.hub.stats
+	if res.collapsed > 0 {
+		stats.collapsed.Add(int64(res.collapsed))
+	}
+	if res.dropped > 0 {
+		stats.dropped.Add(int64(res.dropped))
+		c.requestResync()
+	}
+	return res.ok
+}
+
+// requestResync tells the client, once per connection, that it missed
+// messages and should reload the board.
+func (c *Client) requestResync() {
+	if !c.resyncRequested.CompareAndSwap(false, true) {
+		return
+	}
+	c.hub.stats.resyncs.Add(1)
+	message, err := encodeMessage(MsgTypeResyncRequired, map[string]interface{}{
+		"reason": "SLOW_CONSUMER",
+	})
+	if err != nil {
+		return
+	}
+	c.out.push(outbound{msgType: MsgTypeResyncRequired, data: c.frame(message)}, true)
+}
+
+// deliver queues a broadcast for the client. It returns false when the
+// slow-consumer policy says the client must be disconnected.
+func (c *Client) deliver(seq int64, msgType string, message []byte) bool {
+	c.deliverMu.Lock()
+	defer c.deliverMu.Unlock()
+	if c.resuming {
+		if len(c.pending) >= maxPending {
+			c.pendingOverflow = true
+			return true
+		}
+		c.pending = append(c.pending, sequenced{seq: seq, msgType: msgType, message: message})
+		return true
+	}
+	if seq != 0 && seq <= c.lastSeq {
+		return true
+	}
+	if c.closed() {
+		return true
+	}
+	if !c.push(outbound{msgType: msgType, data: message}, false) {
+		return false
+	}
+	if seq != 0 {
+		c.lastSeq = seq
+	}
+	return true
+}
+
+// beginResume parks broadcasts until the next finishResume, for when the
+// client is about to be sent a fresh snapshot.
+func (c *Client) beginResume() {
+	c.deliverMu.Lock()
+	defer c.deliverMu.Unlock()
+	c.resuming = true
+	c.pendingOverflow = false
+}
+
+// finishResume flushes broadcasts parked while resuming, skipping anything at
+// or below lastSeq. It returns false if broadcasts were lost along the way.
+func (c *Client) finishResume(lastSeq int64) bool {
+	c.deliverMu.Lock()
+	defer c.deliverMu.Unlock()
+	c.resuming = false
+	c.lastSeq = max(c.lastSeq, lastSeq)
+	ok := !c.pendingOverflow
+	for _, msg := range c.pending {
+		if msg.seq != 0 && msg.seq <= c.lastSeq {
+			continue
+		}
+		if !c.push(outbound{msgType: msg.msgType, data: msg.message}, false) {
+			ok = false
+			break
+		}
+		if msg.seq != 0 {
+			c.lastSeq = msg.seq
+		}
+	}
+	c.pending = nil
+	return ok
 }
 
 func (c *Client) LastPong() time.Time {
@@ -60,11 +272,8 @@ type MessageHandler func(c *Client, inbound InboundMessage)
 
 func (c *Client) readPump(handler MessageHandler) {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.unregisterClient(c)
 		_ = c.conn.Close()
-		if c.onDisconnect != nil {
-			c.onDisconnect()
-		}
 	}()
 
 	c.conn.SetReadLimit(maxMessageSize)
@@ -96,6 +305,10 @@ func (c *Client) readPump(handler MessageHandler) {
 }
 
 func (c *Client) writePump() {
+	messageType := websocket.TextMessage
+	if c.binary {
+		messageType = websocket.BinaryMessage
+	}
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
@@ -104,13 +317,18 @@ func (c *Client) writePump() {
 
 	for {
 		select {
-		case message, ok := <-c.send:
+		case <-c.done:
 			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
+			_ = c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(c.closeCode, c.closeText))
+			return
+
+		case <-c.out.notify:
+			batch := c.out.take(c.maxBatch, maxBatchBytes)
+			if len(batch) == 0 {
+				continue
 			}
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.writeFrame(messageType, c.encodeBatch(batch)); err != nil {
 				return
 			}
 
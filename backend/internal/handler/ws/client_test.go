@@ -0,0 +1,129 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// resumeStep is one call on a client: deliver a broadcast with seq, begin a
+// resume, or finish one at seq.
+type resumeStep struct {
+	op  string
+	seq int64
+}
+
+func deliverSeq(seq int64) resumeStep { return resumeStep{"deliver", seq} }
+func beginStep() resumeStep           { return resumeStep{"begin", 0} }
+func finishAt(seq int64) resumeStep   { return resumeStep{"finish", seq} }
+
+func TestClientResume(t *testing.T) {
+	overflow := []resumeStep{}
+	for seq := int64(1); seq <= maxPending+1; seq++ {
+		overflow = append(overflow, deliverSeq(seq))
+	}
+	overflow = append(overflow, finishAt(0))
+
+	tests := []struct {
+		name       string
+		steps      []resumeStep
+		wantFinish bool
+		wantSeqs   []string
+	}{
+		{
+			name:       "parked until the snapshot is sent",
+			steps:      []resumeStep{deliverSeq(5), deliverSeq(6), finishAt(4)},
+			wantFinish: true,
+			wantSeqs:   []string{"5", "6"},
+		},
+		{
+			name:       "replayed events are not repeated",
+			steps:      []resumeStep{deliverSeq(3), deliverSeq(4), deliverSeq(5), finishAt(4)},
+			wantFinish: true,
+			wantSeqs:   []string{"5"},
+		},
+		{
+			name:       "duplicates after resuming",
+			steps:      []resumeStep{finishAt(0), deliverSeq(1), deliverSeq(2), deliverSeq(2), deliverSeq(1), deliverSeq(3)},
+			wantFinish: true,
+			wantSeqs:   []string{"1", "2", "3"},
+		},
+		{
+			name:       "unsequenced messages always go out",
+			steps:      []resumeStep{deliverSeq(0), finishAt(5), deliverSeq(0)},
+			wantFinish: true,
+			wantSeqs:   []string{"0", "0"},
+		},
+		{
+			name:       "a fresh snapshot skips what it covers",
+			steps:      []resumeStep{finishAt(2), deliverSeq(3), beginStep(), deliverSeq(4), finishAt(6), deliverSeq(5), deliverSeq(7)},
+			wantFinish: true,
+			wantSeqs:   []string{"3", "7"},
+		},
+		{
+			name:       "too much parked",
+			steps:      overflow,
+			wantFinish: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				hub:      &Hub{},
+				out:      newOutbox(2*maxPending, PolicyDisconnect),
+				done:     make(chan struct{}),
+				resuming: true,
+			}
+			finished := true
+			for _, step := range tt.steps {
+				switch step.op {
+				case "deliver":
+					if !c.deliver(step.seq, MsgTypeTileClaimed, []byte(strconv.FormatInt(step.seq, 10))) {
+						t.Fatalf("deliver(%d) asked for a disconnect", step.seq)
+					}
+				case "begin":
+					c.beginResume()
+				case "finish":
+					finished = c.finishResume(step.seq)
+				}
+			}
+			if finished != tt.wantFinish {
+				t.Fatalf("finishResume() = %v, want %v", finished, tt.wantFinish)
+			}
+			if tt.wantSeqs != nil && !reflect.DeepEqual(queued(c.out), tt.wantSeqs) {
+				t.Fatalf("queued %v, want %v", queued(c.out), tt.wantSeqs)
+			}
+		})
+	}
+}
+
+func TestOriginChecker(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"no origin", []string{"https://grid.example"}, "", true},
+		{"exact match", []string{"https://grid.example"}, "https://grid.example", true},
+		{"case differs", []string{"https://Grid.Example"}, "https://grid.EXAMPLE", true},
+		{"trailing slash in config", []string{"https://grid.example/"}, "https://grid.example", true},
+		{"second entry", []string{"https://grid.example", "http://localhost:5173"}, "http://localhost:5173", true},
+		{"wildcard", []string{"*"}, "https://evil.example", true},
+		{"other origin", []string{"https://grid.example"}, "https://evil.example", false},
+		{"other scheme", []string{"https://grid.example"}, "http://grid.example", false},
+		{"other port", []string{"http://localhost:5173"}, "http://localhost:8080", false},
+		{"empty allowlist", nil, "https://grid.example", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := originChecker(tt.allowed)(r); got != tt.want {
+			t.Errorf("%s: originChecker(%q)(%q) = %v, want %v", tt.name, tt.allowed, tt.origin, got, tt.want)
+		}
+	}
+}
@@ -1,52 +1,93 @@
 package ws
 
 import (
+	"compress/flate"
 	"context"
 	"encoding/json"
 	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 
 	"ownthegrid/internal/domain"
 	"ownthegrid/internal/pubsub"
 	"ownthegrid/internal/service"
 )
 
+// Options tunes the WebSocket gateway.
+type Options struct {
+	// Compression negotiates permessage-deflate with clients that offer it.
+	Compression bool
+	// MaxBatch caps how many queued messages are coalesced into one BATCH
+	// frame for clients that opt in; 1 disables batching.
+	MaxBatch int
+	// SlowConsumer is applied when a client's outbox is full.
+	SlowConsumer SlowConsumerPolicy
+	// Shards is the number of hub shards; 0 uses one per CPU.
+	Shards int
+	// AllowedOrigins lists the browser origins that may open a connection;
+	// "*" allows any.
+	AllowedOrigins []string
+	// AllowQueryToken accepts access tokens and API keys in the token query
+	// parameter, for clients that can neither set headers nor fetch tickets.
+	// Off by default, since the URL ends up in proxy logs and browser
+	// history.
+	AllowQueryToken bool
+}
+
 type Handler struct {
 	hub       *Hub
 	tileSvc   *service.TileService
 	userSvc   *service.UserService
+	boardSvc  *service.BoardService
 	publisher pubsub.Publisher
+	events    pubsub.EventLog
+	upgrader  *websocket.Upgrader
+	opts      Options
 }
 
-func NewHandler(hub *Hub, tileSvc *service.TileService, userSvc *service.UserService, publisher pubsub.Publisher) *Handler {
+func NewHandler(
+	hub *Hub,
+	tileSvc *service.TileService,
+	userSvc *service.UserService,
+	boardSvc *service.BoardService,
+	publisher pubsub.Publisher,
+	events pubsub.EventLog,
+	opts Options,
+) *Handler {
 	return &Handler{
 		hub:       hub,
 		tileSvc:   tileSvc,
 		userSvc:   userSvc,
+		boardSvc:  boardSvc,
 		publisher: publisher,
+		events:    events,
+		upgrader:  newUpgrader(opts.Compression, opts.AllowedOrigins),
+		opts:      opts,
 	}
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	userIDParam := r.URL.Query().Get("userId")
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		if cookie, err := r.Cookie("otg_token"); err == nil {
-			token = cookie.Value
+	claims, err := h.authenticate(r)
+	if err != nil {
+		var rateErr *domain.RateLimitError
+		if errors.As(err, &rateErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(rateErr.RetryAfter.Seconds()))))
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
 		}
-	}
-	if token == "" {
-		http.Error(w, "missing token", http.StatusUnauthorized)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
 		return
 	}
-
-	claims, err := h.userSvc.ValidateToken(token)
-	if err != nil {
-		http.Error(w, "invalid token", http.StatusUnauthorized)
+	if !claims.HasScope(domain.ScopeReadBoard) {
+		http.Error(w, "API key lacks the read-board scope", http.StatusForbidden)
 		return
 	}
 
@@ -69,71 +110,198 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "user not found", http.StatusNotFound)
 		return
 	}
+	if user.Banned() {
+		http.Error(w, "account banned", http.StatusForbidden)
+		return
+	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	boardID := r.URL.Query().Get("boardId")
+	if boardID == "" {
+		boardID = domain.DefaultBoardID
+	}
+	board, err := h.boardSvc.Get(r.Context(), boardID)
+	if err != nil {
+		if errors.Is(err, domain.ErrBoardNotFound) {
+			http.Error(w, "board not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to load board", http.StatusInternalServerError)
+		return
+	}
+
+	var lastSeq *int64
+	if value := r.URL.Query().Get("lastSeq"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "invalid lastSeq", http.StatusBadRequest)
+			return
+		}
+		lastSeq = &parsed
+	}
+
+	var viewport *domain.Viewport
+	if value := r.URL.Query().Get("viewport"); value != "" {
+		vp, err := parseViewport(value, board)
+		if err != nil {
+			http.Error(w, "invalid viewport", http.StatusBadRequest)
+			return
+		}
+		viewport = &vp
+	}
+
+	batch := r.URL.Query().Get("batch") == "1"
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WS upgrade error: %v", err)
 		return
 	}
+	if h.opts.Compression {
+		_ = conn.SetCompressionLevel(flate.BestSpeed)
+	}
 
-	client := &Client{
-		hub:      h.hub,
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		UserID:   user.ID.String(),
-		Username: user.Username,
-		onDisconnect: func() {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			if err := h.userSvc.SetOffline(ctx, user.ID); err != nil {
-				log.Printf("Set offline error: %v", err)
-			}
-			onlineCount, _ := h.userSvc.OnlineCount(ctx)
-			payload := map[string]interface{}{
-				"userId":      user.ID.String(),
-				"username":    user.Username,
-				"onlineCount": onlineCount,
-			}
-			if err := h.publisher.Publish(ctx, MsgTypeUserLeft, payload); err != nil {
-				log.Printf("Publish user left failed: %v", err)
-			}
-		},
+	client := newClient(h.hub, conn)
+	if batch && h.opts.MaxBatch > 1 {
+		client.maxBatch = h.opts.MaxBatch
+	}
+	client.UserID = user.ID.String()
+	client.Username = user.Username
+	client.BoardID = board.ID
+	client.SessionID = claims.SessionID
+	if claims.APIKeyID != "" {
+		// Revoking the key closes the connection like revoking a session.
+		client.SessionID = claims.APIKeyID
+	}
+	client.CanClaim = claims.HasScope(domain.ScopeClaim)
+	client.viewport = viewport
+	client.onDisconnect = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if h.hub.IsConnected(board.ID, user.ID.String()) {
+			return
+		}
+		left, err := h.userSvc.SetOffline(ctx, board.ID, user.ID)
+		if err != nil {
+			log.Printf("Set offline error: %v", err)
+			return
+		}
+		if !left {
+			return
+		}
+		onlineCount, _ := h.userSvc.OnlineCount(ctx, board.ID)
+		payload := map[string]interface{}{
+			"userId":      user.ID.String(),
+			"username":    user.Username,
+			"onlineCount": onlineCount,
+		}
+		if err := h.publisher.Publish(ctx, board.ID, MsgTypeUserLeft, payload); err != nil {
+			log.Printf("Publish user left failed: %v", err)
+		}
 	}
-	h.hub.register <- client
 
-	if err := h.userSvc.SetOnline(r.Context(), user.ID); err != nil {
+	go client.writePump()
+	h.hub.registerClient(client)
+	<-client.registered
+
+	joined, err := h.userSvc.SetOnline(r.Context(), board.ID, user.ID)
+	if err != nil {
 		log.Printf("Set online error: %v", err)
+		joined = client.firstOnBoard
 	}
 	if err := h.userSvc.UpdateLastSeen(r.Context(), user.ID); err != nil {
 		log.Printf("Update last seen error: %v", err)
 	}
 
-	onlineCount, _ := h.userSvc.OnlineCount(r.Context())
-	tiles := h.getAllTiles(r.Context())
-	gridWidth, gridHeight := h.tileSvc.GridSize()
-	initPayload := map[string]interface{}{
-		"tiles":       tiles,
+	onlineCount, _ := h.userSvc.OnlineCount(r.Context(), board.ID)
+	h.syncClient(r.Context(), client, user, board, lastSeq, onlineCount)
+
+	if joined {
+		h.broadcastUserJoined(r, board.ID, user, onlineCount)
+	}
+
+	go client.readPump(h.handleMessage)
+}
+
+// syncClient brings a freshly registered client up to date. A client that
+// reports the last sequence it saw gets only the missed events when the
+// replay buffer still holds all of them, otherwise a full INIT_BOARD.
+func (h *Handler) syncClient(
+	ctx context.Context,
+	c *Client,
+	user *domain.User,
+	board *domain.Board,
+	lastSeq *int64,
+	onlineCount int,
+) {
+	currentSeq, err := h.events.CurrentSeq(ctx, board.ID)
+	if err != nil {
+		log.Printf("Load board seq failed: %v", err)
+	}
+
+	if lastSeq != nil && err == nil {
+		missed, ok, err := h.events.Since(ctx, board.ID, *lastSeq, currentSeq)
+		if err != nil {
+			log.Printf("Load replay failed: %v", err)
+		}
+		if ok && err == nil {
+			resumed, _ := encodeMessage(MsgTypeResumed, map[string]interface{}{
+				"boardId":     board.ID,
+				"fromSeq":     *lastSeq,
+				"toSeq":       currentSeq,
+				"missed":      len(missed),
+				"user":        user,
+				"onlineCount": onlineCount,
+			})
+			c.enqueue(c.frame(resumed))
+			for _, msg := range missed {
+				if c.viewport != nil {
+					if x, y, ok := tileCoords(msg.Data); ok && !c.viewport.Contains(x, y) {
+						continue
+					}
+				}
+				c.enqueue(c.frame(msg.Data))
+			}
+			h.completeSync(c, currentSeq)
+			return
+		}
+	}
+
+	payload := map[string]interface{}{
+		"boardId":     board.ID,
+		"seq":         currentSeq,
 		"user":        user,
 		"onlineCount": onlineCount,
-		"gridWidth":   gridWidth,
-		"gridHeight":  gridHeight,
+		"gridWidth":   board.Width,
+		"gridHeight":  board.Height,
 	}
-	h.hub.SendToUser(user.ID.String(), MsgTypeInitBoard, initPayload)
-
-	h.broadcastUserJoined(r, user, onlineCount)
+	var tiles []domain.Tile
+	if c.viewport != nil {
+		tiles = h.getViewportTiles(ctx, board.ID, *c.viewport)
+		payload["viewport"] = c.viewport
+	} else {
+		tiles = h.getAllTiles(ctx, board.ID)
+	}
+	c.enqueue(encodeSnapshot(c, MsgTypeInitBoard, payload, tiles))
+	h.completeSync(c, currentSeq)
+}
 
-	go client.writePump()
-	go client.readPump(h.handleMessage)
+func (h *Handler) completeSync(c *Client, seq int64) {
+	if !c.finishResume(seq) {
+		log.Printf("Client %s fell behind while syncing, disconnecting", c.UserID)
+		h.hub.dropSlowConsumer(c)
+	}
 }
 
 func (h *Handler) handleMessage(c *Client, inbound InboundMessage) {
 	switch inbound.Type {
 	case "PING":
-		h.hub.SendToUser(c.UserID, MsgTypePong, map[string]interface{}{})
+		h.hub.SendToClient(c, MsgTypePong, map[string]interface{}{})
 	case "CLAIM_TILE":
 		h.handleClaimTile(c, inbound.Payload)
+	case "SUBSCRIBE_VIEWPORT":
+		h.handleSubscribeViewport(c, inbound.Payload)
 	default:
-		h.hub.SendToUser(c.UserID, MsgTypeError, map[string]interface{}{
+		h.hub.SendToClient(c, MsgTypeError, map[string]interface{}{
 			"code":    "UNKNOWN_MESSAGE",
 			"message": "Unknown message type",
 		})
@@ -145,13 +313,18 @@ func (h *Handler) handleClaimTile(c *Client, payload json.RawMessage) {
 		TileID int `json:"tileId"`
 	}
 	if err := json.Unmarshal(payload, &request); err != nil {
-		h.hub.SendToUser(c.UserID, MsgTypeError, map[string]interface{}{
+		h.hub.SendToClient(c, MsgTypeError, map[string]interface{}{
 			"code":    "BAD_PAYLOAD",
 			"message": "Invalid payload",
 		})
 		return
 	}
 
+	if !c.CanClaim {
+		h.handleClaimError(c, request.TileID, domain.ErrScopeDenied)
+		return
+	}
+
 	userID, err := uuid.Parse(c.UserID)
 	if err != nil {
 		return
@@ -159,63 +332,239 @@ func (h *Handler) handleClaimTile(c *Client, payload json.RawMessage) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	tile, err := h.tileSvc.ClaimTile(ctx, request.TileID, userID)
+	result, err := h.tileSvc.ClaimTile(ctx, c.BoardID, request.TileID, userID)
 	if err != nil {
 		h.handleClaimError(c, request.TileID, err)
 		return
 	}
 
+	payloadOut := TileClaimedPayload(result, c.Username)
+	if err := h.publisher.Publish(ctx, c.BoardID, MsgTypeTileClaimed, payloadOut); err != nil {
+		log.Printf("Publish claim failed: %v", err)
+	}
+}
+
+// TileClaimedPayload builds the TILE_CLAIMED broadcast for a successful
+// claim by username.
+func TileClaimedPayload(result *domain.ClaimResult, username string) map[string]interface{} {
+	tile := result.Tile
+	var previousOwner interface{}
+	if result.PreviousOwnerID != nil {
+		previousOwner = result.PreviousOwnerID.String()
+	}
+
 	color := ""
 	if tile.OwnerColor != nil {
 		color = *tile.OwnerColor
 	}
-	payloadOut := map[string]interface{}{
+	var userID, teamID, teamName interface{}
+	if tile.OwnerID != nil {
+		userID = tile.OwnerID.String()
+	}
+	if tile.OwnerTeamID != nil {
+		teamID = tile.OwnerTeamID.String()
+		if tile.OwnerTeamName != nil {
+			teamName = *tile.OwnerTeamName
+		}
+	}
+	return map[string]interface{}{
 		"tileId":        tile.ID,
 		"x":             tile.X,
 		"y":             tile.Y,
-		"userId":        userID.String(),
-		"username":      c.Username,
+		"userId":        userID,
+		"username":      username,
 		"color":         color,
 		"claimedAt":     tile.ClaimedAt,
-		"previousOwner": nil,
+		"previousOwner": previousOwner,
+		"chunkVersion":  result.ChunkVersion,
+		"teamId":        teamID,
+		"teamName":      teamName,
 	}
-	if err := h.publisher.Publish(ctx, MsgTypeTileClaimed, payloadOut); err != nil {
-		log.Printf("Publish claim failed: %v", err)
+}
+
+// handleSubscribeViewport narrows the client to a new rectangle and sends the
+// tiles inside it. Broadcasts are parked meanwhile so claims in the new
+// rectangle can't be overtaken by the snapshot.
+func (h *Handler) handleSubscribeViewport(c *Client, payload json.RawMessage) {
+	var request domain.Viewport
+	if err := json.Unmarshal(payload, &request); err != nil {
+		h.hub.SendToClient(c, MsgTypeError, map[string]interface{}{
+			"code":    "BAD_PAYLOAD",
+			"message": "Invalid payload",
+		})
+		return
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	board, err := h.boardSvc.Get(ctx, c.BoardID)
+	if err != nil {
+		log.Printf("Load board failed: %v", err)
+		return
+	}
+	vp, err := request.ClampTo(board)
+	if err != nil {
+		h.hub.SendToClient(c, MsgTypeError, map[string]interface{}{
+			"code":    "INVALID_VIEWPORT",
+			"message": "Viewport must overlap the board and cover at most 65536 tiles",
+		})
+		return
+	}
+
+	c.beginResume()
+	if !h.hub.SetViewport(c, vp) {
+		return
+	}
+	seq, err := h.events.CurrentSeq(ctx, board.ID)
+	if err != nil {
+		log.Printf("Load board seq failed: %v", err)
+	}
+	meta := map[string]interface{}{
+		"boardId":  board.ID,
+		"seq":      seq,
+		"viewport": vp,
+	}
+	tiles := h.getViewportTiles(ctx, board.ID, vp)
+	c.enqueue(encodeSnapshot(c, MsgTypeViewportSnapshot, meta, tiles))
+	h.completeSync(c, seq)
+}
+
+// encodeSnapshot builds an INIT_BOARD or VIEWPORT_SNAPSHOT in the client's
+// wire format. Binary clients get the tiles in the compact frame layout
+// instead of as JSON.
+func encodeSnapshot(c *Client, msgType string, payload map[string]interface{}, tiles []domain.Tile) []byte {
+	if c.binary {
+		frameType := frameInitBoard
+		if msgType == MsgTypeViewportSnapshot {
+			frameType = frameViewport
+		}
+		frame, err := tilesFrame(frameType, 0, payload, tiles)
+		if err == nil {
+			return frame
+		}
+		log.Printf("Binary snapshot encode failed: %v", err)
+	}
+	payload["tiles"] = tiles
+	msg, _ := encodeMessage(msgType, payload)
+	return c.frame(msg)
 }
 
 func (h *Handler) handleClaimError(c *Client, tileID int, err error) {
+	payload := map[string]interface{}{
+		"tileId": tileID,
+	}
+
 	reason := "SERVER_ERROR"
-	if errors.Is(err, domain.ErrTileInvalid) {
+	var rateErr *domain.RateLimitError
+	if errors.As(err, &rateErr) {
+		reason = "RATE_LIMITED"
+		payload["retryAfterMs"] = rateErr.RetryAfter.Milliseconds()
+	} else if errors.Is(err, domain.ErrTileInvalid) {
 		reason = "INVALID_TILE"
 	} else if errors.Is(err, domain.ErrTileAlreadyClaimed) {
 		reason = "ALREADY_CLAIMED"
+	} else if errors.Is(err, domain.ErrTileProtected) {
+		reason = "TILE_PROTECTED"
+	} else if errors.Is(err, domain.ErrTileNotAdjacent) {
+		reason = "NOT_ADJACENT"
+	} else if errors.Is(err, domain.ErrScopeDenied) {
+		reason = "SCOPE_DENIED"
+	} else if errors.Is(err, domain.ErrUserBanned) {
+		reason = "USER_BANNED"
 	}
+	payload["reason"] = reason
 
-	h.hub.SendToUser(c.UserID, MsgTypeClaimRejected, map[string]interface{}{
-		"tileId": tileID,
-		"reason": reason,
-	})
+	h.hub.SendToClient(c, MsgTypeClaimRejected, payload)
+}
+
+// authenticate identifies the caller by a one-time ticket, or else by an
+// access token or API key in the Authorization header or the otg_token
+// cookie, or the token query parameter if allowed. Rate limit errors are
+// returned as is.
+func (h *Handler) authenticate(r *http.Request) (*service.Claims, error) {
+	if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+		claims, err := h.userSvc.RedeemWSTicket(r.Context(), ticket)
+		if err != nil {
+			return nil, errors.New("invalid ticket")
+		}
+		return claims, nil
+	}
+
+	var token string
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = strings.TrimSpace(bearer)
+	}
+	if token == "" && h.opts.AllowQueryToken {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		if cookie, err := r.Cookie("otg_token"); err == nil {
+			token = cookie.Value
+		}
+	}
+	if token == "" {
+		return nil, errors.New("missing token")
+	}
+	claims, err := h.userSvc.ValidateToken(r.Context(), token)
+	if err != nil {
+		var rateErr *domain.RateLimitError
+		if errors.As(err, &rateErr) {
+			return nil, err
+		}
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
 }
 
-func (h *Handler) broadcastUserJoined(r *http.Request, user *domain.User, onlineCount int) {
+func (h *Handler) broadcastUserJoined(r *http.Request, boardID string, user *domain.User, onlineCount int) {
 	payload := map[string]interface{}{
 		"userId":      user.ID.String(),
 		"username":    user.Username,
 		"color":       user.Color,
 		"onlineCount": onlineCount,
 	}
-	if err := h.publisher.Publish(r.Context(), MsgTypeUserJoined, payload); err != nil {
+	if err := h.publisher.Publish(r.Context(), boardID, MsgTypeUserJoined, payload); err != nil {
 		log.Printf("Publish user joined failed: %v", err)
 	}
 }
 
-func (h *Handler) getAllTiles(ctx context.Context) []domain.Tile {
-	tiles, err := h.tileSvc.GetAllTiles(ctx)
+func (h *Handler) getViewportTiles(ctx context.Context, boardID string, vp domain.Viewport) []domain.Tile {
+	tiles, err := h.tileSvc.GetTilesInViewport(ctx, boardID, vp)
 	if err != nil {
 		log.Printf("Failed to load tiles: %v", err)
 		return []domain.Tile{}
 	}
+	return derefTiles(tiles)
+}
+
+// parseViewport reads an "x,y,w,h" query value and clamps it to the board.
+func parseViewport(value string, board *domain.Board) (domain.Viewport, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return domain.Viewport{}, domain.ErrViewportInvalid
+	}
+	nums := make([]int, 4)
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return domain.Viewport{}, domain.ErrViewportInvalid
+		}
+		nums[i] = n
+	}
+	vp := domain.Viewport{X: nums[0], Y: nums[1], W: nums[2], H: nums[3]}
+	return vp.ClampTo(board)
+}
+
+func (h *Handler) getAllTiles(ctx context.Context, boardID string) []domain.Tile {
+	tiles, err := h.tileSvc.GetAllTiles(ctx, boardID)
+	if err != nil {
+		log.Printf("Failed to load tiles: %v", err)
+		return []domain.Tile{}
+	}
+	return derefTiles(tiles)
+}
+
+func derefTiles(tiles []*domain.Tile) []domain.Tile {
 	out := make([]domain.Tile, 0, len(tiles))
 	for _, tile := range tiles {
 		if tile != nil {
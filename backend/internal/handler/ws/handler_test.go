@@ -0,0 +1,56 @@
+package ws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+)
+
+func TestTileClaimedPayload(t *testing.T) {
+	owner, previous, team := uuid.New(), uuid.New(), uuid.New()
+	color, teamName := "#FF6B6B", "reds"
+	claimedAt := time.Now()
+	tile := func() *domain.Tile {
+		return &domain.Tile{ID: 7, X: 2, Y: 1, OwnerID: &owner, OwnerColor: &color, ClaimedAt: &claimedAt}
+	}
+	teamTile := tile()
+	teamTile.OwnerTeamID, teamTile.OwnerTeamName = &team, &teamName
+
+	tests := []struct {
+		name         string
+		result       *domain.ClaimResult
+		wantPrevious interface{}
+		wantTeam     interface{}
+	}{
+		{"claim", &domain.ClaimResult{Tile: tile(), ChunkVersion: 3}, nil, nil},
+		{"capture", &domain.ClaimResult{Tile: tile(), PreviousOwnerID: &previous, ChunkVersion: 3}, previous.String(), nil},
+		{"team claim", &domain.ClaimResult{Tile: teamTile, ChunkVersion: 3}, nil, team.String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TileClaimedPayload(tt.result, "alice")
+			want := map[string]interface{}{
+				"tileId":        7,
+				"x":             2,
+				"y":             1,
+				"userId":        owner.String(),
+				"username":      "alice",
+				"color":         color,
+				"previousOwner": tt.wantPrevious,
+				"chunkVersion":  int64(3),
+				"teamId":        tt.wantTeam,
+			}
+			for key, value := range want {
+				if got[key] != value {
+					t.Errorf("%s = %#v, want %#v", key, got[key], value)
+				}
+			}
+			if got["claimedAt"] != &claimedAt {
+				t.Errorf("claimedAt = %v, want %v", got["claimedAt"], claimedAt)
+			}
+		})
+	}
+}
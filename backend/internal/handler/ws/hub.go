@@ -2,7 +2,9 @@ package ws
 
 import (
 	"encoding/json"
+	"hash/fnv"
 	"log"
+	"runtime"
 	"sync"
 	"time"
 )
@@ -16,157 +18,229 @@ const (
 	MsgTypeLeaderboardUpdate = "LEADERBOARD_UPDATE"
 	MsgTypeError             = "ERROR"
 	MsgTypePong              = "PONG"
+	MsgTypeResumed           = "RESUMED"
+	MsgTypeViewportSnapshot  = "VIEWPORT_SNAPSHOT"
+	MsgTypeSeasonEnded       = "SEASON_ENDED"
+	MsgTypeSeasonStarted     = "SEASON_STARTED"
+	MsgTypeRegionReset       = "REGION_RESET"
+	MsgTypeAnnouncement      = "SYSTEM_ANNOUNCEMENT"
+
+	// CloseKicked is sent to connections an admin disconnected,
+	// CloseRevoked to those whose session was revoked and CloseBanned to
+	// those of a user who was banned.
+	CloseKicked  = 4001
+	CloseRevoked = 4002
+	CloseBanned  = 4003
 
 	pingTimeout     = 90 * time.Second
 	cleanupInterval = 30 * time.Second
 )
 
 type Message struct {
+	Seq     int64           `json:"seq,omitempty"`
 	Type    string          `json:"type"`
 	Payload json.RawMessage `json:"payload"`
 }
 
+// boardMessage is a broadcast on its way to every shard. It is parsed once
+// and shared, as is its binary frame.
+type boardMessage struct {
+	boardID string
+	seq     int64
+	message []byte
+	msgType string
+	x, y    int
+	spatial bool
+
+	binaryOnce sync.Once
+	binary     []byte
+}
+
+func newBoardMessage(boardID string, seq int64, message []byte) *boardMessage {
+	msg := &boardMessage{boardID: boardID, seq: seq, message: message}
+	msg.msgType, msg.x, msg.y, msg.spatial = messageInfo(message)
+	return msg
+}
+
+func (m *boardMessage) binaryFrame() []byte {
+	m.binaryOnce.Do(func() { m.binary = toBinaryFrame(m.message) })
+	return m.binary
+}
+
+// Hub spreads clients over shards by user id, so every connection a user
+// holds lands on the same shard. Each shard has its own lock, client set and
+// goroutines: one for register, unregister and cleanup, one for broadcasts.
+// Broadcasts go to all shards and fan out in parallel.
 type Hub struct {
-	clients    map[*Client]bool
-	userMap    map[string]*Client
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan []byte
-	cleanup    chan *Client
-	mu         sync.RWMutex
+	shards []*shard
+	opts   Options
+	stats  slowConsumerCounters
 }
 
-func NewHub() *Hub {
-	return &Hub{
-		clients:    make(map[*Client]bool),
-		userMap:    make(map[string]*Client),
-		register:   make(chan *Client, 256),
-		unregister: make(chan *Client, 256),
-		broadcast:  make(chan []byte, 1024),
-		cleanup:    make(chan *Client, 256),
+func NewHub(opts Options) *Hub {
+	n := opts.Shards
+	if n <= 0 {
+		n = runtime.NumCPU()
 	}
+	h := &Hub{opts: opts}
+	for i := 0; i < n; i++ {
+		h.shards = append(h.shards, newShard(h, i))
+	}
+	return h
 }
 
+// Run starts every shard and blocks for as long as they run.
 func (h *Hub) Run() {
-	cleanupTicker := time.NewTicker(cleanupInterval)
-	defer cleanupTicker.Stop()
-
-	for {
-		select {
-		case <-cleanupTicker.C:
-			h.cleanupStaleClients()
-
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.userMap[client.UserID] = client
-			h.mu.Unlock()
-			log.Printf("Client registered: %s (%s)", client.UserID, client.Username)
-
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				delete(h.userMap, client.UserID)
-				close(client.send)
-			}
-			h.mu.Unlock()
-			log.Printf("Client unregistered: %s", client.UserID)
-
-		case client := <-h.cleanup:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				delete(h.userMap, client.UserID)
-				close(client.send)
-				log.Printf("Cleaned up stale client: %s", client.UserID)
-			}
-			h.mu.Unlock()
-
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					go func(c *Client) { h.unregister <- c }(client)
-				}
-			}
-			h.mu.RUnlock()
-		}
+	var wg sync.WaitGroup
+	for _, s := range h.shards {
+		wg.Add(2)
+		go func(s *shard) {
+			defer wg.Done()
+			s.run()
+		}(s)
+		go func(s *shard) {
+			defer wg.Done()
+			s.runBroadcasts()
+		}(s)
 	}
+	wg.Wait()
 }
 
-func (h *Hub) cleanupStaleClients() {
-	h.mu.RLock()
-	var staleClients []*Client
-	for client := range h.clients {
-		if time.Since(client.LastPong()) > pingTimeout {
-			staleClients = append(staleClients, client)
-		}
+func (h *Hub) shardFor(userID string) *shard {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(userID))
+	return h.shards[hash.Sum32()%uint32(len(h.shards))]
+}
+
+// registerClient adds client to its user's shard. client.registered is
+// closed once it is in place.
+func (h *Hub) registerClient(client *Client) {
+	client.shard = h.shardFor(client.UserID)
+	client.shard.register <- client
+}
+
+func (h *Hub) unregisterClient(client *Client) {
+	if client.shard != nil {
+		client.shard.unregister <- client
 	}
-	h.mu.RUnlock()
+}
 
-	if len(staleClients) > 0 {
-		log.Printf("Cleanup: Found %d stale clients", len(staleClients))
+// dropSlowConsumer disconnects a client whose outbox overflowed.
+func (h *Hub) dropSlowConsumer(client *Client) {
+	if client.closed() {
+		return
 	}
+	h.stats.disconnects.Add(1)
+	log.Printf("Disconnecting slow consumer %s on board %s", client.UserID, client.BoardID)
+	client.closeWith(CloseSlowConsumer, "slow consumer")
+	go h.unregisterClient(client)
+}
 
-	for _, client := range staleClients {
-		log.Printf("Detected stale client: %s (last pong: %v)", client.UserID, client.LastPong())
-		if client.onDisconnect != nil {
-			client.onDisconnect()
+// DisconnectUser closes every connection userID has open on this instance
+// with the given close code. A non-empty sessionID limits this to the
+// connections opened with that session's tokens.
+func (h *Hub) DisconnectUser(userID string, sessionID string, code int, reason string) {
+	s := h.shardFor(userID)
+	s.mu.RLock()
+	conns := make([]*Client, 0, len(s.userMap[userID]))
+	for client := range s.userMap[userID] {
+		if sessionID == "" || client.SessionID == sessionID {
+			conns = append(conns, client)
 		}
-		h.cleanup <- client
 	}
+	s.mu.RUnlock()
+	for _, client := range conns {
+		log.Printf("Disconnecting %s from board %s: %s", userID, client.BoardID, reason)
+		client.closeWith(code, reason)
+		go h.unregisterClient(client)
+	}
+}
+
+// SlowConsumerStats reports what the slow-consumer policy has done so far.
+func (h *Hub) SlowConsumerStats() SlowConsumerStats {
+	return h.stats.snapshot()
 }
 
-func (h *Hub) GetConnectedUserIDs() []string {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	ids := make([]string, 0, len(h.userMap))
-	for userID := range h.userMap {
-		ids = append(ids, userID)
+// ShardStats reports the load on each shard.
+func (h *Hub) ShardStats() []ShardStats {
+	stats := make([]ShardStats, 0, len(h.shards))
+	for _, s := range h.shards {
+		stats = append(stats, s.stats())
 	}
-	return ids
+	return stats
 }
 
-func (h *Hub) Broadcast(msgType string, payload interface{}) {
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		log.Printf("Broadcast marshal error: %v", err)
-		return
+// IsConnected reports whether userID still has an open connection to boardID
+// on this instance.
+func (h *Hub) IsConnected(boardID string, userID string) bool {
+	s := h.shardFor(userID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.userConnectionsOnBoard(userID, boardID) > 0
+}
+
+// ConnectedUsersByBoard returns the distinct users connected to each board
+// on this instance.
+func (h *Hub) ConnectedUsersByBoard() map[string][]string {
+	out := make(map[string][]string)
+	for _, s := range h.shards {
+		s.connectedUsersByBoard(out)
 	}
-	msg := Message{Type: msgType, Payload: payloadBytes}
-	msgBytes, err := json.Marshal(msg)
+	return out
+}
+
+func (h *Hub) Broadcast(boardID string, msgType string, payload interface{}) {
+	msgBytes, err := encodeMessage(msgType, payload)
 	if err != nil {
-		log.Printf("Broadcast marshal message error: %v", err)
+		log.Printf("Broadcast marshal error: %v", err)
 		return
 	}
-	h.broadcast <- msgBytes
+	h.BroadcastRaw(boardID, 0, msgBytes)
 }
 
-func (h *Hub) BroadcastRaw(message []byte) {
-	h.broadcast <- message
+func (h *Hub) BroadcastRaw(boardID string, seq int64, message []byte) {
+	msg := newBoardMessage(boardID, seq, message)
+	for _, s := range h.shards {
+		s.broadcast <- msg
+	}
 }
 
+// SendToUser delivers a direct message to every connection userID has open on
+// this instance.
 func (h *Hub) SendToUser(userID string, msgType string, payload interface{}) {
-	h.mu.RLock()
-	client, ok := h.userMap[userID]
-	h.mu.RUnlock()
-	if !ok {
-		return
-	}
-	payloadBytes, err := json.Marshal(payload)
+	msgBytes, err := encodeMessage(msgType, payload)
 	if err != nil {
 		return
 	}
-	msg := Message{Type: msgType, Payload: payloadBytes}
-	msgBytes, err := json.Marshal(msg)
+	s := h.shardFor(userID)
+	s.mu.RLock()
+	conns := make([]*Client, 0, len(s.userMap[userID]))
+	for client := range s.userMap[userID] {
+		conns = append(conns, client)
+	}
+	s.mu.RUnlock()
+	for _, client := range conns {
+		if !client.sendDirect(msgType, client.frame(msgBytes)) {
+			h.dropSlowConsumer(client)
+		}
+	}
+}
+
+// SendToClient delivers a direct message to a single connection.
+func (h *Hub) SendToClient(client *Client, msgType string, payload interface{}) {
+	msgBytes, err := encodeMessage(msgType, payload)
 	if err != nil {
 		return
 	}
-	select {
-	case client.send <- msgBytes:
-	default:
+	if !client.sendDirect(msgType, client.frame(msgBytes)) {
+		h.dropSlowConsumer(client)
+	}
+}
+
+func encodeMessage(msgType string, payload interface{}) ([]byte, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
 	}
+	return json.Marshal(Message{Type: msgType, Payload: payloadBytes})
 }
@@ -0,0 +1,181 @@
+package ws
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client that isn't backed by a connection, with
+// left signalled each time its last connection to the board closes.
+func newTestClient(hub *Hub, userID string, boardID string, left chan<- string) *Client {
+	c := &Client{
+		hub:        hub,
+		UserID:     userID,
+		BoardID:    boardID,
+		out:        newOutbox(sendBufferSize, PolicyDisconnect),
+		registered: make(chan struct{}),
+		done:       make(chan struct{}),
+		maxBatch:   1,
+	}
+	c.onDisconnect = func() { left <- boardID }
+	return c
+}
+
+func TestHubConnectionsPerUser(t *testing.T) {
+	hub := NewHub(Options{Shards: 2, SlowConsumer: PolicyDisconnect})
+	go hub.Run()
+	left := make(chan string, 4)
+	tabs := map[string]*Client{}
+
+	steps := []struct {
+		name          string
+		open          string // tab opened, named user/board/n
+		close         string
+		wantFirst     bool
+		wantLeft      string
+		wantConnected map[string]bool
+	}{
+		{name: "first tab", open: "alice/main/1", wantFirst: true, wantConnected: map[string]bool{"main": true}},
+		{name: "second tab", open: "alice/main/2", wantConnected: map[string]bool{"main": true}},
+		{name: "tab on another board", open: "alice/other/1", wantFirst: true, wantConnected: map[string]bool{"main": true, "other": true}},
+		{name: "other user", open: "bob/main/1", wantFirst: true},
+		{name: "close one of two", close: "alice/main/1", wantConnected: map[string]bool{"main": true, "other": true}},
+		{name: "close the last", close: "alice/main/2", wantLeft: "main", wantConnected: map[string]bool{"main": false, "other": true}},
+		{name: "close the other board", close: "alice/other/1", wantLeft: "other", wantConnected: map[string]bool{"other": false}},
+	}
+	for _, step := range steps {
+		if step.open != "" {
+			parts := strings.Split(step.open, "/")
+			c := newTestClient(hub, parts[0], parts[1], left)
+			tabs[step.open] = c
+			hub.registerClient(c)
+			<-c.registered
+			if c.firstOnBoard != step.wantFirst {
+				t.Fatalf("%s: firstOnBoard = %v, want %v", step.name, c.firstOnBoard, step.wantFirst)
+			}
+		}
+		if step.close != "" {
+			c := tabs[step.close]
+			hub.unregisterClient(c)
+			<-c.done
+		}
+		select {
+		case board := <-left:
+			if board != step.wantLeft {
+				t.Fatalf("%s: left %q, want %q", step.name, board, step.wantLeft)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if step.wantLeft != "" {
+				t.Fatalf("%s: never left %q", step.name, step.wantLeft)
+			}
+		}
+		for board, want := range step.wantConnected {
+			if got := hub.IsConnected(board, "alice"); got != want {
+				t.Fatalf("%s: IsConnected(%s) = %v, want %v", step.name, board, got, want)
+			}
+		}
+	}
+}
+
+func TestHubSendToUser(t *testing.T) {
+	hub := NewHub(Options{Shards: 2, SlowConsumer: PolicyDisconnect})
+	go hub.Run()
+	left := make(chan string, 4)
+	alice := []*Client{
+		newTestClient(hub, "alice", "main", left),
+		newTestClient(hub, "alice", "main", left),
+		newTestClient(hub, "alice", "other", left),
+	}
+	bob := newTestClient(hub, "bob", "main", left)
+	for _, c := range append(alice, bob) {
+		hub.registerClient(c)
+		<-c.registered
+	}
+
+	hub.SendToUser("alice", MsgTypePong, map[string]string{})
+	for i, c := range alice {
+		if n := len(queued(c.out)); n != 1 {
+			t.Fatalf("alice's connection %d has %d messages queued, want 1", i, n)
+		}
+	}
+	if n := len(queued(bob.out)); n != 0 {
+		t.Fatalf("bob has %d messages queued, want 0", n)
+	}
+
+	online := hub.ConnectedUsersByBoard()
+	if len(online["main"]) != 2 || len(online["other"]) != 1 {
+		t.Fatalf("ConnectedUsersByBoard() = %v, want alice and bob on main and alice on other", online)
+	}
+}
+
+func TestHubShards(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards int
+	}{
+		{"one shard", 1},
+		{"several shards", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub(Options{Shards: tt.shards, SlowConsumer: PolicyDisconnect})
+			go hub.Run()
+			left := make(chan string, 64)
+			var onMain, onOther []*Client
+			for i := 0; i < 20; i++ {
+				user := fmt.Sprintf("user%d", i)
+				main := newTestClient(hub, user, "main", left)
+				other := newTestClient(hub, user, "other", left)
+				for _, c := range []*Client{main, other} {
+					hub.registerClient(c)
+					<-c.registered
+				}
+				if main.shard != other.shard {
+					t.Fatalf("%s has connections on two shards", user)
+				}
+				onMain = append(onMain, main)
+				if i < 5 {
+					onOther = append(onOther, other)
+				} else {
+					hub.unregisterClient(other)
+					<-other.done
+				}
+			}
+
+			hub.BroadcastRaw("main", 1, []byte(`{"seq":1,"type":"ANNOUNCEMENT","payload":{}}`))
+			deadline := time.Now().Add(5 * time.Second)
+			for _, c := range onMain {
+				for len(queued(c.out)) == 0 {
+					if time.Now().After(deadline) {
+						t.Fatalf("%s never got the broadcast", c.UserID)
+					}
+					time.Sleep(5 * time.Millisecond)
+				}
+			}
+			for _, c := range onOther {
+				if n := len(queued(c.out)); n != 0 {
+					t.Fatalf("%s on another board got %d messages", c.UserID, n)
+				}
+			}
+
+			stats := hub.ShardStats()
+			if len(stats) != tt.shards {
+				t.Fatalf("%d shard stats, want %d", len(stats), tt.shards)
+			}
+			var clients int
+			var deliveries int64
+			for _, s := range stats {
+				clients += s.Clients
+				deliveries += s.Deliveries
+				if s.Broadcasts != 1 {
+					t.Fatalf("shard %d handled %d broadcasts, want 1", s.Shard, s.Broadcasts)
+				}
+			}
+			if clients != len(onMain)+len(onOther) || deliveries != int64(len(onMain)) {
+				t.Fatalf("%d clients and %d deliveries, want %d and %d", clients, deliveries, len(onMain)+len(onOther), len(onMain))
+			}
+		})
+	}
+}
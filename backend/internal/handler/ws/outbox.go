@@ -0,0 +1,173 @@
+package ws
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// SlowConsumerPolicy decides what happens when a client's outbox is full.
+//
+//   - disconnect closes the connection with CloseSlowConsumer.
+//   - drop-oldest discards the oldest queued messages to make room and tells
+//     the client to resync with RESYNC_REQUIRED.
+//   - collapse keeps only the newest queued LEADERBOARD_UPDATE at all times
+//     and disconnects when nothing can be collapsed.
+type SlowConsumerPolicy string
+
+const (
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+	PolicyDropOldest SlowConsumerPolicy = "drop-oldest"
+	PolicyCollapse   SlowConsumerPolicy = "collapse"
+)
+
+// CloseSlowConsumer is the close code sent to clients disconnected for
+// falling behind.
+const CloseSlowConsumer = 4008
+
+const MsgTypeResyncRequired = "RESYNC_REQUIRED"
+
+// SlowConsumerStats counts what the slow-consumer policy has done since
+// startup.
+type SlowConsumerStats struct {
+	Dropped     int64 `json:"dropped"`
+	Collapsed   int64 `json:"collapsed"`
+	Resyncs     int64 `json:"resyncs"`
+	Disconnects int64 `json:"disconnects"`
+}
+
+type slowConsumerCounters struct {
+	dropped     atomic.Int64
+	collapsed   atomic.Int64
+	resyncs     atomic.Int64
+	disconnects atomic.Int64
+}
+
+func (s *slowConsumerCounters) snapshot() SlowConsumerStats {
+	return SlowConsumerStats{
+		Dropped:     s.dropped.Load(),
+		Collapsed:   s.collapsed.Load(),
+		Resyncs:     s.resyncs.Load(),
+		Disconnects: s.disconnects.Load(),
+	}
+}
+
+type outbound struct {
+	msgType string
+	data    []byte
+	// direct messages were sent to this client alone (replies, snapshots)
+	// and are only dropped once no broadcasts are left to drop.
+	direct bool
+}
+
+// outbox is a client's bounded send queue. Unlike a channel it lets the
+// slow-consumer policy drop or replace messages that are already queued.
+type outbox struct {
+	mu     sync.Mutex
+	items  []outbound
+	limit  int
+	policy SlowConsumerPolicy
+	notify chan struct{}
+}
+
+func newOutbox(limit int, policy SlowConsumerPolicy) *outbox {
+	return &outbox{limit: limit, policy: policy, notify: make(chan struct{}, 1)}
+}
+
+type pushResult struct {
+	ok        bool
+	dropped   int
+	collapsed int
+}
+
+// push queues msg, applying the policy when the outbox is full. force skips
+// the limit for messages the client must get, such as snapshots.
+func (o *outbox) push(msg outbound, force bool) pushResult {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var res pushResult
+	if o.policy == PolicyCollapse && msg.msgType == MsgTypeLeaderboardUpdate {
+		res.collapsed = o.removeType(MsgTypeLeaderboardUpdate)
+	}
+	if !force && len(o.items) >= o.limit {
+		switch o.policy {
+		case PolicyDropOldest:
+			for len(o.items) >= o.limit && o.evictOldest() {
+				res.dropped++
+			}
+			if len(o.items) >= o.limit {
+				return res
+			}
+		default:
+			return res
+		}
+	}
+	o.items = append(o.items, msg)
+	res.ok = true
+	o.signal()
+	return res
+}
+
+// evictOldest drops the oldest broadcast, or failing that the oldest direct
+// message. A queued RESYNC_REQUIRED is never dropped. Callers hold o.mu.
+func (o *outbox) evictOldest() bool {
+	victim := -1
+	for i, item := range o.items {
+		if item.msgType == MsgTypeResyncRequired {
+			continue
+		}
+		if !item.direct {
+			victim = i
+			break
+		}
+		if victim < 0 {
+			victim = i
+		}
+	}
+	if victim < 0 {
+		return false
+	}
+	o.items = append(o.items[:victim], o.items[victim+1:]...)
+	return true
+}
+
+// removeType drops every queued message of msgType. Callers hold o.mu.
+func (o *outbox) removeType(msgType string) int {
+	kept := o.items[:0]
+	for _, item := range o.items {
+		if item.msgType != msgType {
+			kept = append(kept, item)
+		}
+	}
+	removed := len(o.items) - len(kept)
+	o.items = kept
+	return removed
+}
+
+func (o *outbox) signal() {
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take removes up to max queued messages totalling roughly maxBytes. It
+// always returns at least one message when any are queued.
+func (o *outbox) take(max int, maxBytes int) [][]byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n, size := 0, 0
+	for n < len(o.items) && n < max && (n == 0 || size < maxBytes) {
+		size += len(o.items[n].data)
+		n++
+	}
+	batch := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		batch[i] = o.items[i].data
+	}
+	o.items = append(o.items[:0], o.items[n:]...)
+	if len(o.items) > 0 {
+		o.signal()
+	}
+	return batch
+}
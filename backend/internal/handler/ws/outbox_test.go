@@ -0,0 +1,196 @@
+package ws
+
+import (
+	"reflect"
+	"testing"
+)
+
+func broadcast(msgType string, data string) outbound {
+	return outbound{msgType: msgType, data: []byte(data)}
+}
+
+func direct(msgType string, data string) outbound {
+	return outbound{msgType: msgType, data: []byte(data), direct: true}
+}
+
+// queued returns the data of every message in o, oldest first.
+func queued(o *outbox) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := []string{}
+	for _, item := range o.items {
+		out = append(out, string(item.data))
+	}
+	return out
+}
+
+func TestOutboxPush(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy SlowConsumerPolicy
+		limit  int
+		queued []outbound
+		push   outbound
+		force  bool
+		want   pushResult
+		after  []string
+	}{
+		{
+			name:   "room left",
+			policy: PolicyDisconnect,
+			limit:  2,
+			queued: []outbound{broadcast(MsgTypeTileClaimed, "a")},
+			push:   broadcast(MsgTypeTileClaimed, "b"),
+			want:   pushResult{ok: true},
+			after:  []string{"a", "b"},
+		},
+		{
+			name:   "disconnect when full",
+			policy: PolicyDisconnect,
+			limit:  2,
+			queued: []outbound{broadcast(MsgTypeTileClaimed, "a"), broadcast(MsgTypeTileClaimed, "b")},
+			push:   broadcast(MsgTypeTileClaimed, "c"),
+			want:   pushResult{},
+			after:  []string{"a", "b"},
+		},
+		{
+			name:   "forced past the limit",
+			policy: PolicyDisconnect,
+			limit:  1,
+			queued: []outbound{broadcast(MsgTypeTileClaimed, "a")},
+			push:   direct(MsgTypeInitBoard, "init"),
+			force:  true,
+			want:   pushResult{ok: true},
+			after:  []string{"a", "init"},
+		},
+		{
+			name:   "drop oldest broadcast first",
+			policy: PolicyDropOldest,
+			limit:  3,
+			queued: []outbound{direct(MsgTypeClaimRejected, "reply"), broadcast(MsgTypeTileClaimed, "a"), broadcast(MsgTypeTileClaimed, "b")},
+			push:   broadcast(MsgTypeTileClaimed, "c"),
+			want:   pushResult{ok: true, dropped: 1},
+			after:  []string{"reply", "b", "c"},
+		},
+		{
+			name:   "drop direct once no broadcasts are left",
+			policy: PolicyDropOldest,
+			limit:  2,
+			queued: []outbound{direct(MsgTypeClaimRejected, "r1"), direct(MsgTypeClaimRejected, "r2")},
+			push:   broadcast(MsgTypeTileClaimed, "a"),
+			want:   pushResult{ok: true, dropped: 1},
+			after:  []string{"r2", "a"},
+		},
+		{
+			name:   "never drop RESYNC_REQUIRED",
+			policy: PolicyDropOldest,
+			limit:  1,
+			queued: []outbound{direct(MsgTypeResyncRequired, "resync")},
+			push:   broadcast(MsgTypeTileClaimed, "a"),
+			want:   pushResult{},
+			after:  []string{"resync"},
+		},
+		{
+			name:   "collapse leaderboard updates",
+			policy: PolicyCollapse,
+			limit:  3,
+			queued: []outbound{broadcast(MsgTypeLeaderboardUpdate, "lb1"), broadcast(MsgTypeTileClaimed, "a")},
+			push:   broadcast(MsgTypeLeaderboardUpdate, "lb2"),
+			want:   pushResult{ok: true, collapsed: 1},
+			after:  []string{"a", "lb2"},
+		},
+		{
+			name:   "collapse makes room",
+			policy: PolicyCollapse,
+			limit:  2,
+			queued: []outbound{broadcast(MsgTypeLeaderboardUpdate, "lb1"), broadcast(MsgTypeTileClaimed, "a")},
+			push:   broadcast(MsgTypeLeaderboardUpdate, "lb2"),
+			want:   pushResult{ok: true, collapsed: 1},
+			after:  []string{"a", "lb2"},
+		},
+		{
+			name:   "collapse disconnects when nothing collapses",
+			policy: PolicyCollapse,
+			limit:  2,
+			queued: []outbound{broadcast(MsgTypeTileClaimed, "a"), broadcast(MsgTypeTileClaimed, "b")},
+			push:   broadcast(MsgTypeTileClaimed, "c"),
+			want:   pushResult{},
+			after:  []string{"a", "b"},
+		},
+		{
+			name:   "leaderboard updates pile up outside collapse",
+			policy: PolicyDisconnect,
+			limit:  3,
+			queued: []outbound{broadcast(MsgTypeLeaderboardUpdate, "lb1")},
+			push:   broadcast(MsgTypeLeaderboardUpdate, "lb2"),
+			want:   pushResult{ok: true},
+			after:  []string{"lb1", "lb2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOutbox(tt.limit, tt.policy)
+			o.items = append(o.items, tt.queued...)
+			if got := o.push(tt.push, tt.force); got != tt.want {
+				t.Fatalf("push() = %+v, want %+v", got, tt.want)
+			}
+			if got := queued(o); !reflect.DeepEqual(got, tt.after) {
+				t.Fatalf("queued after push = %v, want %v", got, tt.after)
+			}
+		})
+	}
+}
+
+func TestOutboxPushSignals(t *testing.T) {
+	o := newOutbox(4, PolicyDisconnect)
+	o.push(broadcast(MsgTypeTileClaimed, "a"), false)
+	o.push(broadcast(MsgTypeTileClaimed, "b"), false)
+	select {
+	case <-o.notify:
+	default:
+		t.Fatal("push didn't signal")
+	}
+	select {
+	case <-o.notify:
+		t.Fatal("push signalled twice for one wakeup")
+	default:
+	}
+}
+
+func TestOutboxTake(t *testing.T) {
+	tests := []struct {
+		name     string
+		queued   []string
+		max      int
+		maxBytes int
+		want     []string
+		left     []string
+	}{
+		{"empty", nil, 4, 100, []string{}, []string{}},
+		{"all", []string{"a", "b"}, 4, 100, []string{"a", "b"}, []string{}},
+		{"up to max", []string{"a", "b", "c"}, 2, 100, []string{"a", "b"}, []string{"c"}},
+		{"up to max bytes", []string{"aaaa", "bbbb", "cccc"}, 4, 6, []string{"aaaa", "bbbb"}, []string{"cccc"}},
+		{"one over max bytes", []string{"aaaaaaaa", "b"}, 4, 4, []string{"aaaaaaaa"}, []string{"b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOutbox(10, PolicyDisconnect)
+			for _, data := range tt.queued {
+				o.items = append(o.items, broadcast(MsgTypeTileClaimed, data))
+			}
+			got := []string{}
+			for _, data := range o.take(tt.max, tt.maxBytes) {
+				got = append(got, string(data))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("take() = %v, want %v", got, tt.want)
+			}
+			if left := queued(o); !reflect.DeepEqual(left, tt.left) {
+				t.Fatalf("left after take = %v, want %v", left, tt.left)
+			}
+			if signalled := len(o.notify) == 1; signalled != (len(tt.left) > 0) {
+				t.Fatalf("signalled = %v with %d left", signalled, len(tt.left))
+			}
+		})
+	}
+}
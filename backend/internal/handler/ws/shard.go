@@ -0,0 +1,217 @@
+package ws
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShardStats is a point-in-time view of one hub shard.
+type ShardStats struct {
+	Shard            int   `json:"shard"`
+	Clients          int   `json:"clients"`
+	Boards           int   `json:"boards"`
+	Broadcasts       int64 `json:"broadcasts"`
+	Deliveries       int64 `json:"deliveries"`
+	QueuedBroadcasts int   `json:"queuedBroadcasts"`
+}
+
+type shard struct {
+	hub        *Hub
+	id         int
+	clients    map[*Client]bool
+	boards     map[string]map[*Client]bool
+	userMap    map[string]map[*Client]bool
+	fullView   map[string]map[*Client]bool
+	chunks     map[string]map[chunkKey]map[*Client]bool
+	register   chan *Client
+	unregister chan *Client
+	broadcast  chan *boardMessage
+	cleanup    chan *Client
+	mu         sync.RWMutex
+
+	broadcasts atomic.Int64
+	deliveries atomic.Int64
+}
+
+func newShard(hub *Hub, id int) *shard {
+	return &shard{
+		hub:        hub,
+		id:         id,
+		clients:    make(map[*Client]bool),
+		boards:     make(map[string]map[*Client]bool),
+		userMap:    make(map[string]map[*Client]bool),
+		fullView:   make(map[string]map[*Client]bool),
+		chunks:     make(map[string]map[chunkKey]map[*Client]bool),
+		register:   make(chan *Client, 256),
+		unregister: make(chan *Client, 256),
+		broadcast:  make(chan *boardMessage, 1024),
+		cleanup:    make(chan *Client, 256),
+	}
+}
+
+// run handles membership changes. Broadcasts have their own goroutine so a
+// large fan-out never holds up a register or unregister.
+func (s *shard) run() {
+	cleanupTicker := time.NewTicker(cleanupInterval)
+	defer cleanupTicker.Stop()
+
+	for {
+		select {
+		case <-cleanupTicker.C:
+			s.cleanupStaleClients()
+
+		case client := <-s.register:
+			s.mu.Lock()
+			s.clients[client] = true
+			if s.boards[client.BoardID] == nil {
+				s.boards[client.BoardID] = make(map[*Client]bool)
+			}
+			s.boards[client.BoardID][client] = true
+			if s.userMap[client.UserID] == nil {
+				s.userMap[client.UserID] = make(map[*Client]bool)
+			}
+			s.userMap[client.UserID][client] = true
+			s.indexClient(client)
+			client.firstOnBoard = s.userConnectionsOnBoard(client.UserID, client.BoardID) == 1
+			s.mu.Unlock()
+			close(client.registered)
+			log.Printf("Client registered: %s (%s) on board %s", client.UserID, client.Username, client.BoardID)
+
+		case client := <-s.unregister:
+			s.mu.Lock()
+			if _, ok := s.clients[client]; ok {
+				s.removeClient(client)
+			}
+			s.mu.Unlock()
+			log.Printf("Client unregistered: %s", client.UserID)
+
+		case client := <-s.cleanup:
+			s.mu.Lock()
+			if _, ok := s.clients[client]; ok {
+				s.removeClient(client)
+				log.Printf("Cleaned up stale client: %s", client.UserID)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *shard) runBroadcasts() {
+	for msg := range s.broadcast {
+		s.fanOut(msg)
+	}
+}
+
+// fanOut delivers a broadcast to the shard's clients on its board. Tile
+// events only go to clients whose viewport contains the tile. Recipients are
+// collected under the read lock and written to after releasing it.
+func (s *shard) fanOut(msg *boardMessage) {
+	s.broadcasts.Add(1)
+
+	s.mu.RLock()
+	var recipients []*Client
+	if msg.spatial {
+		recipients = s.tileRecipients(msg.boardID, msg.x, msg.y)
+	} else {
+		recipients = make([]*Client, 0, len(s.boards[msg.boardID]))
+		for client := range s.boards[msg.boardID] {
+			recipients = append(recipients, client)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, client := range recipients {
+		message := msg.message
+		if client.binary {
+			message = msg.binaryFrame()
+		}
+		if !client.deliver(msg.seq, msg.msgType, message) {
+			s.hub.dropSlowConsumer(client)
+		}
+	}
+	s.deliveries.Add(int64(len(recipients)))
+}
+
+func (s *shard) removeClient(client *Client) {
+	delete(s.clients, client)
+	s.unindexClient(client)
+	if members, ok := s.boards[client.BoardID]; ok {
+		delete(members, client)
+		if len(members) == 0 {
+			delete(s.boards, client.BoardID)
+		}
+	}
+	if conns, ok := s.userMap[client.UserID]; ok {
+		delete(conns, client)
+		if len(conns) == 0 {
+			delete(s.userMap, client.UserID)
+		}
+	}
+	client.close()
+
+	if client.onDisconnect != nil && s.userConnectionsOnBoard(client.UserID, client.BoardID) == 0 {
+		go client.onDisconnect()
+	}
+}
+
+func (s *shard) userConnectionsOnBoard(userID string, boardID string) int {
+	count := 0
+	for conn := range s.userMap[userID] {
+		if conn.BoardID == boardID {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *shard) cleanupStaleClients() {
+	s.mu.RLock()
+	var staleClients []*Client
+	for client := range s.clients {
+		if time.Since(client.LastPong()) > pingTimeout {
+			staleClients = append(staleClients, client)
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(staleClients) > 0 {
+		log.Printf("Cleanup: Found %d stale clients on shard %d", len(staleClients), s.id)
+	}
+
+	for _, client := range staleClients {
+		log.Printf("Detected stale client: %s (last pong: %v)", client.UserID, client.LastPong())
+		s.cleanup <- client
+	}
+}
+
+// connectedUsersByBoard adds the shard's users to out. A user's connections
+// all live on one shard, so no user is added twice.
+func (s *shard) connectedUsersByBoard(out map[string][]string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for boardID, clients := range s.boards {
+		seen := make(map[string]bool, len(clients))
+		for client := range clients {
+			if !seen[client.UserID] {
+				seen[client.UserID] = true
+				out[boardID] = append(out[boardID], client.UserID)
+			}
+		}
+	}
+}
+
+func (s *shard) stats() ShardStats {
+	s.mu.RLock()
+	clients, boards := len(s.clients), len(s.boards)
+	s.mu.RUnlock()
+	return ShardStats{
+		Shard:            s.id,
+		Clients:          clients,
+		Boards:           boards,
+		Broadcasts:       s.broadcasts.Load(),
+		Deliveries:       s.deliveries.Load(),
+		QueuedBroadcasts: len(s.broadcast),
+	}
+}
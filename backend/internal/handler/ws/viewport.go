@@ -0,0 +1,140 @@
+package ws
+
+import (
+	"encoding/json"
+
+	"ownthegrid/internal/domain"
+)
+
+// Clients that subscribe to a viewport are indexed by the board chunks their
+// rectangle overlaps, so a tile event only visits clients whose viewport
+// could contain it. Clients without a viewport get every tile event.
+type chunkKey struct {
+	cx, cy int
+}
+
+func chunkOf(x, y int) chunkKey {
+	cx, cy := domain.ChunkOf(x, y)
+	return chunkKey{cx: cx, cy: cy}
+}
+
+// viewportChunks returns every chunk vp overlaps.
+func viewportChunks(vp domain.Viewport) []chunkKey {
+	first := chunkOf(vp.X, vp.Y)
+	last := chunkOf(vp.X+vp.W-1, vp.Y+vp.H-1)
+	keys := make([]chunkKey, 0, (last.cx-first.cx+1)*(last.cy-first.cy+1))
+	for cy := first.cy; cy <= last.cy; cy++ {
+		for cx := first.cx; cx <= last.cx; cx++ {
+			keys = append(keys, chunkKey{cx: cx, cy: cy})
+		}
+	}
+	return keys
+}
+
+// messageInfo extracts a broadcast's type and, for tile events, the tile
+// coordinates. spatial is false for messages that aren't tied to a tile.
+func messageInfo(message []byte) (msgType string, x, y int, spatial bool) {
+	var envelope struct {
+		Type    string `json:"type"`
+		Payload struct {
+			X *int `json:"x"`
+			Y *int `json:"y"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil {
+		return "", 0, 0, false
+	}
+	if envelope.Type != MsgTypeTileClaimed || envelope.Payload.X == nil || envelope.Payload.Y == nil {
+		return envelope.Type, 0, 0, false
+	}
+	return envelope.Type, *envelope.Payload.X, *envelope.Payload.Y, true
+}
+
+// tileCoords extracts the coordinates of a tile event. ok is false for
+// messages that aren't tied to a tile.
+func tileCoords(message []byte) (x, y int, ok bool) {
+	_, x, y, ok = messageInfo(message)
+	return x, y, ok
+}
+
+// indexClient adds client to the board's viewport index, or to the set of
+// clients watching the whole board. Callers hold s.mu.
+func (s *shard) indexClient(client *Client) {
+	if client.viewport == nil {
+		if s.fullView[client.BoardID] == nil {
+			s.fullView[client.BoardID] = make(map[*Client]bool)
+		}
+		s.fullView[client.BoardID][client] = true
+		return
+	}
+	chunks := s.chunks[client.BoardID]
+	if chunks == nil {
+		chunks = make(map[chunkKey]map[*Client]bool)
+		s.chunks[client.BoardID] = chunks
+	}
+	for _, key := range viewportChunks(*client.viewport) {
+		if chunks[key] == nil {
+			chunks[key] = make(map[*Client]bool)
+		}
+		chunks[key][client] = true
+	}
+}
+
+// unindexClient reverses indexClient. Callers hold s.mu.
+func (s *shard) unindexClient(client *Client) {
+	if client.viewport == nil {
+		if members, ok := s.fullView[client.BoardID]; ok {
+			delete(members, client)
+			if len(members) == 0 {
+				delete(s.fullView, client.BoardID)
+			}
+		}
+		return
+	}
+	chunks := s.chunks[client.BoardID]
+	for _, key := range viewportChunks(*client.viewport) {
+		if members, ok := chunks[key]; ok {
+			delete(members, client)
+			if len(members) == 0 {
+				delete(chunks, key)
+			}
+		}
+	}
+	if len(chunks) == 0 {
+		delete(s.chunks, client.BoardID)
+	}
+}
+
+// SetViewport moves client to a new viewport. It returns false if the client
+// is no longer registered.
+func (h *Hub) SetViewport(client *Client, vp domain.Viewport) bool {
+	s := client.shard
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.clients[client] {
+		return false
+	}
+	s.unindexClient(client)
+	client.viewport = &vp
+	s.indexClient(client)
+	return true
+}
+
+// tileRecipients returns the clients on boardID that should see a tile event
+// at x, y. Callers hold s.mu for reading.
+func (s *shard) tileRecipients(boardID string, x, y int) []*Client {
+	chunk := s.chunks[boardID][chunkOf(x, y)]
+	recipients := make([]*Client, 0, len(s.fullView[boardID])+len(chunk))
+	for client := range s.fullView[boardID] {
+		recipients = append(recipients, client)
+	}
+	for client := range chunk {
+		if client.viewport.Contains(x, y) {
+			recipients = append(recipients, client)
+		}
+	}
+	return recipients
+}
@@ -0,0 +1,96 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ControlChannel carries instance-wide commands that aren't board events,
+// such as dropping every connection a user holds.
+const ControlChannel = "control:events"
+
+const controlDisconnect = "disconnect"
+
+// Disconnector closes a user's connections on this instance, or only those
+// of one session when sessionID is set.
+type Disconnector interface {
+	DisconnectUser(userID string, sessionID string, code int, reason string)
+}
+
+type controlMessage struct {
+	Type      string `json:"type"`
+	UserID    string `json:"userId"`
+	SessionID string `json:"sessionId,omitempty"`
+	Code      int    `json:"code"`
+	Reason    string `json:"reason"`
+}
+
+// ControlBus fans control commands out to every instance over Redis pub/sub.
+// Commands are fire-and-forget: an instance that is down when one is sent
+// has no connections to act on anyway.
+type ControlBus struct {
+	client *redis.Client
+}
+
+func NewControlBus(client *redis.Client) *ControlBus {
+	return &ControlBus{client: client}
+}
+
+// DisconnectUser asks every instance to close userID's connections with the
+// given WebSocket close code.
+func (b *ControlBus) DisconnectUser(ctx context.Context, userID string, code int, reason string) error {
+	return b.publish(ctx, controlMessage{Type: controlDisconnect, UserID: userID, Code: code, Reason: reason})
+}
+
+// DisconnectSession asks every instance to close the connections userID
+// opened with tokens from sessionID.
+func (b *ControlBus) DisconnectSession(ctx context.Context, userID string, sessionID string, code int, reason string) error {
+	return b.publish(ctx, controlMessage{
+		Type:      controlDisconnect,
+		UserID:    userID,
+		SessionID: sessionID,
+		Code:      code,
+		Reason:    reason,
+	})
+}
+
+func (b *ControlBus) publish(ctx context.Context, cmd controlMessage) error {
+	msg, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("control marshal: %w", err)
+	}
+	if err := b.client.Publish(ctx, ControlChannel, msg).Err(); err != nil {
+		return fmt.Errorf("control publish: %w", err)
+	}
+	return nil
+}
+
+// Subscribe applies control commands to target until ctx is done.
+func (b *ControlBus) Subscribe(ctx context.Context, target Disconnector) {
+	sub := b.client.Subscribe(ctx, ControlChannel)
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			_ = sub.Close()
+			return
+		case msg := <-ch:
+			if msg == nil {
+				continue
+			}
+			var cmd controlMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &cmd); err != nil {
+				log.Printf("Control: bad message: %v", err)
+				continue
+			}
+			switch cmd.Type {
+			case controlDisconnect:
+				target.DisconnectUser(cmd.UserID, cmd.SessionID, cmd.Code, cmd.Reason)
+			}
+		}
+	}
+}
@@ -4,62 +4,97 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/redis/go-redis/v9"
 )
 
-const BoardEventsChannel = "board:events"
+const (
+	boardChannelPrefix = "board:"
+	boardChannelSuffix = ":events"
+	BoardEventsPattern = boardChannelPrefix + "*" + boardChannelSuffix
+)
+
+func BoardChannel(boardID string) string {
+	return boardChannelPrefix + boardID + boardChannelSuffix
+}
+
+func boardIDFromChannel(channel string) (string, bool) {
+	if !strings.HasPrefix(channel, boardChannelPrefix) || !strings.HasSuffix(channel, boardChannelSuffix) {
+		return "", false
+	}
+	boardID := strings.TrimSuffix(strings.TrimPrefix(channel, boardChannelPrefix), boardChannelSuffix)
+	return boardID, boardID != ""
+}
 
 type MessageEnvelope struct {
+	Seq     int64           `json:"seq,omitempty"`
 	Type    string          `json:"type"`
 	Payload json.RawMessage `json:"payload"`
 }
 
+type SequencedMessage struct {
+	Seq  int64
+	Data []byte
+}
+
 type Publisher interface {
-	Publish(ctx context.Context, msgType string, payload interface{}) error
+	Publish(ctx context.Context, boardID string, msgType string, payload interface{}) error
+}
+
+type Subscriber interface {
+	Subscribe(ctx context.Context)
 }
 
 type Broadcaster interface {
-	BroadcastRaw(message []byte)
+	BroadcastRaw(boardID string, seq int64, message []byte)
+}
+
+// EventLog gives access to recently published board events so reconnecting
+// clients can catch up on what they missed.
+type EventLog interface {
+	CurrentSeq(ctx context.Context, boardID string) (int64, error)
+	// Since returns the events after afterSeq up to and including upTo. ok is
+	// false when some of them are no longer retained.
+	Since(ctx context.Context, boardID string, afterSeq int64, upTo int64) (msgs []SequencedMessage, ok bool, err error)
 }
 
+var publishScript = redis.NewScript(sequenceLua + `
+redis.call("PUBLISH", ARGV[1], msg)
+return seq
+`)
+
 type RedisPublisher struct {
-	client  *redis.Client
-	channel string
+	replayLog
 }
 
-func NewRedisPublisher(client *redis.Client, channel string) *RedisPublisher {
-	return &RedisPublisher{client: client, channel: channel}
+func NewRedisPublisher(client *redis.Client, bufferSize int) *RedisPublisher {
+	return &RedisPublisher{replayLog: replayLog{client: client, bufferSize: bufferSize}}
 }
 
-func (p *RedisPublisher) Publish(ctx context.Context, msgType string, payload interface{}) error {
-	payloadBytes, err := json.Marshal(payload)
+func (p *RedisPublisher) Publish(ctx context.Context, boardID string, msgType string, payload interface{}) error {
+	messageBytes, err := encodeEnvelope(msgType, payload)
 	if err != nil {
-		return fmt.Errorf("publish marshal payload: %w", err)
+		return err
 	}
-	envelope := MessageEnvelope{Type: msgType, Payload: payloadBytes}
-	messageBytes, err := json.Marshal(envelope)
-	if err != nil {
-		return fmt.Errorf("publish marshal envelope: %w", err)
-	}
-	if err := p.client.Publish(ctx, p.channel, messageBytes).Err(); err != nil {
+	keys := []string{seqKey(boardID), replayKey(boardID)}
+	if err := publishScript.Run(ctx, p.client, keys, BoardChannel(boardID), messageBytes, p.bufferSize).Err(); err != nil {
 		return fmt.Errorf("publish redis: %w", err)
 	}
 	return nil
 }
 
 type RedisSubscriber struct {
-	client  *redis.Client
-	hub     Broadcaster
-	channel string
+	client *redis.Client
+	hub    Broadcaster
 }
 
-func NewRedisSubscriber(client *redis.Client, hub Broadcaster, channel string) *RedisSubscriber {
-	return &RedisSubscriber{client: client, hub: hub, channel: channel}
+func NewRedisSubscriber(client *redis.Client, hub Broadcaster) *RedisSubscriber {
+	return &RedisSubscriber{client: client, hub: hub}
 }
 
 func (s *RedisSubscriber) Subscribe(ctx context.Context) {
-	pubsub := s.client.Subscribe(ctx, s.channel)
+	pubsub := s.client.PSubscribe(ctx, BoardEventsPattern)
 	ch := pubsub.Channel()
 	for {
 		select {
@@ -70,7 +105,12 @@ func (s *RedisSubscriber) Subscribe(ctx context.Context) {
 			if msg == nil {
 				continue
 			}
-			s.hub.BroadcastRaw([]byte(msg.Payload))
+			boardID, ok := boardIDFromChannel(msg.Channel)
+			if !ok {
+				continue
+			}
+			payload := []byte(msg.Payload)
+			s.hub.BroadcastRaw(boardID, envelopeSeq(payload), payload)
 		}
 	}
 }
@@ -0,0 +1,126 @@
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	BoardEventsStream = "board:events:stream"
+
+	streamReadCount    = 100
+	streamReadBlock    = 5 * time.Second
+	streamRetryBackoff = time.Second
+)
+
+var streamPublishScript = redis.NewScript(sequenceLua + `
+redis.call("XADD", KEYS[3], "MAXLEN", "~", ARGV[4], "*", "board", ARGV[1], "seq", seq, "msg", msg)
+return seq
+`)
+
+// StreamPublisher appends board events to a single Redis stream so that
+// subscribers can resume from the last entry they delivered.
+type StreamPublisher struct {
+	replayLog
+	maxLen int
+}
+
+func NewStreamPublisher(client *redis.Client, bufferSize int, maxLen int) *StreamPublisher {
+	return &StreamPublisher{
+		replayLog: replayLog{client: client, bufferSize: bufferSize},
+		maxLen:    maxLen,
+	}
+}
+
+func (p *StreamPublisher) Publish(ctx context.Context, boardID string, msgType string, payload interface{}) error {
+	messageBytes, err := encodeEnvelope(msgType, payload)
+	if err != nil {
+		return err
+	}
+	keys := []string{seqKey(boardID), replayKey(boardID), BoardEventsStream}
+	err = streamPublishScript.Run(ctx, p.client, keys, boardID, messageBytes, p.bufferSize, p.maxLen).Err()
+	if err != nil {
+		return fmt.Errorf("publish stream: %w", err)
+	}
+	return nil
+}
+
+type StreamSubscriber struct {
+	client *redis.Client
+	hub    Broadcaster
+}
+
+func NewStreamSubscriber(client *redis.Client, hub Broadcaster) *StreamSubscriber {
+	return &StreamSubscriber{client: client, hub: hub}
+}
+
+// Subscribe delivers stream entries to the hub in order. After a Redis error
+// it keeps reading from the last delivered ID, so entries written during the
+// outage are caught up rather than lost.
+func (s *StreamSubscriber) Subscribe(ctx context.Context) {
+	lastID := s.startID(ctx)
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		streams, err := s.client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{BoardEventsStream, lastID},
+			Count:   streamReadCount,
+			Block:   streamReadBlock,
+		}).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Stream read failed, retrying from %s: %v", lastID, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(streamRetryBackoff):
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, entry := range stream.Messages {
+				lastID = entry.ID
+				boardID, _ := entry.Values["board"].(string)
+				msg, _ := entry.Values["msg"].(string)
+				if boardID == "" || msg == "" {
+					continue
+				}
+				seqValue, _ := entry.Values["seq"].(string)
+				seq, _ := strconv.ParseInt(seqValue, 10, 64)
+				s.hub.BroadcastRaw(boardID, seq, []byte(msg))
+			}
+		}
+	}
+}
+
+// startID pins "$" to a concrete entry ID so that a failure before the first
+// read still resumes from the right place.
+func (s *StreamSubscriber) startID(ctx context.Context) string {
+	for {
+		entries, err := s.client.XRevRangeN(ctx, BoardEventsStream, "+", "-", 1).Result()
+		if err == nil {
+			if len(entries) == 0 {
+				return "0-0"
+			}
+			return entries[0].ID
+		}
+		log.Printf("Stream start lookup failed: %v", err)
+		select {
+		case <-ctx.Done():
+			return "$"
+		case <-time.After(streamRetryBackoff):
+		}
+	}
+}
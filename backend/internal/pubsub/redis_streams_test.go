@@ -0,0 +1,123 @@
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"ownthegrid/internal/testenv"
+)
+
+type broadcast struct {
+	boardID string
+	seq     int64
+}
+
+// recorder is a Broadcaster that keeps everything it is handed, recording
+// seq as -1 when the message's envelope disagrees with it.
+type recorder struct {
+	mu   sync.Mutex
+	got  []broadcast
+	seen chan struct{}
+}
+
+func newRecorder() *recorder {
+	return &recorder{seen: make(chan struct{}, 1)}
+}
+
+func (r *recorder) BroadcastRaw(boardID string, seq int64, message []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if envelopeSeq(message) != seq {
+		seq = -1
+	}
+	r.got = append(r.got, broadcast{boardID: boardID, seq: seq})
+	select {
+	case r.seen <- struct{}{}:
+	default:
+	}
+}
+
+// board returns the sequence numbers broadcast for boardID so far.
+func (r *recorder) board(boardID string) []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seqs := []int64{}
+	for _, b := range r.got {
+		if b.boardID == boardID {
+			seqs = append(seqs, b.seq)
+		}
+	}
+	return seqs
+}
+
+func TestStreamSubscriber(t *testing.T) {
+	client := testenv.Redis(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	publisher := NewStreamPublisher(client, 10, 1000)
+	publish := func(boardID string) {
+		t.Helper()
+		if err := publisher.Publish(ctx, boardID, "TILE_CLAIMED", map[string]string{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Events from before the subscriber started are not delivered.
+	publish("main")
+	publish("main")
+
+	hub := newRecorder()
+	stopped := make(chan struct{})
+	go func() {
+		NewStreamSubscriber(client, hub).Subscribe(ctx)
+		close(stopped)
+	}()
+
+	// Probe until the subscriber is reading, so nothing below can land
+	// before its start position.
+	deadline := time.After(10 * time.Second)
+	for len(hub.board("probe")) == 0 {
+		publish("probe")
+		select {
+		case <-hub.seen:
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("subscriber never delivered a probe")
+		}
+	}
+
+	for _, boardID := range []string{"main", "other", "main", "main", "other"} {
+		publish(boardID)
+	}
+	want := map[string][]int64{"main": {3, 4, 5}, "other": {1, 2}}
+	for {
+		if len(hub.board("main")) >= 3 && len(hub.board("other")) >= 2 {
+			break
+		}
+		select {
+		case <-hub.seen:
+		case <-deadline:
+			t.Fatalf("delivered main %v and other %v", hub.board("main"), hub.board("other"))
+		}
+	}
+	for boardID, seqs := range want {
+		got := hub.board(boardID)
+		if len(got) != len(seqs) {
+			t.Fatalf("board %s got seqs %v, want %v", boardID, got, seqs)
+		}
+		for i := range seqs {
+			if got[i] != seqs[i] {
+				t.Fatalf("board %s got seqs %v, want %v", boardID, got, seqs)
+			}
+		}
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(2 * streamReadBlock):
+		t.Fatal("Subscribe kept running after its context ended")
+	}
+}
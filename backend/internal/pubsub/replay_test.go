@@ -0,0 +1,98 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"ownthegrid/internal/testenv"
+)
+
+func TestEnvelopeSeq(t *testing.T) {
+	tests := []struct {
+		message string
+		want    int64
+	}{
+		{`{"seq":42,"type":"TILE_CLAIMED","payload":{}}`, 42},
+		{`{"type":"PONG"}`, 0},
+		{`{"seq":"x"}`, 0},
+		{`nope`, 0},
+	}
+	for _, tt := range tests {
+		if got := envelopeSeq([]byte(tt.message)); got != tt.want {
+			t.Errorf("envelopeSeq(%s) = %d, want %d", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestReplaySince(t *testing.T) {
+	client := testenv.Redis(t)
+	ctx := context.Background()
+	// The buffer keeps the last three of five events.
+	publisher := NewRedisPublisher(client, 3)
+	for i := 1; i <= 5; i++ {
+		if err := publisher.Publish(ctx, "main", "TILE_CLAIMED", map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if seq, err := publisher.CurrentSeq(ctx, "main"); err != nil || seq != 5 {
+		t.Fatalf("CurrentSeq() = %d, %v, want 5", seq, err)
+	}
+	if seq, err := publisher.CurrentSeq(ctx, "other"); err != nil || seq != 0 {
+		t.Fatalf("CurrentSeq() of a quiet board = %d, %v, want 0", seq, err)
+	}
+
+	tests := []struct {
+		name     string
+		afterSeq int64
+		upTo     int64
+		wantOK   bool
+		wantSeqs []int64
+	}{
+		{"up to date", 5, 5, true, []int64{}},
+		{"one behind", 4, 5, true, []int64{5}},
+		{"whole buffer", 2, 5, true, []int64{3, 4, 5}},
+		{"part of the buffer", 2, 4, true, []int64{3, 4}},
+		{"older than the buffer", 1, 5, false, nil},
+		{"from scratch", 0, 5, false, nil},
+		{"ahead of the board", 6, 5, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs, ok, err := publisher.Since(ctx, "main", tt.afterSeq, tt.upTo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("Since() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if len(msgs) != len(tt.wantSeqs) {
+				t.Fatalf("Since() returned %d messages, want %d", len(msgs), len(tt.wantSeqs))
+			}
+			for i, msg := range msgs {
+				if msg.Seq != tt.wantSeqs[i] || envelopeSeq(msg.Data) != msg.Seq {
+					t.Fatalf("message %d has seq %d and envelope seq %d, want %d", i, msg.Seq, envelopeSeq(msg.Data), tt.wantSeqs[i])
+				}
+				var envelope MessageEnvelope
+				if err := json.Unmarshal(msg.Data, &envelope); err != nil || envelope.Type != "TILE_CLAIMED" {
+					t.Fatalf("message %d = %s", i, msg.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestReplaySinceWithoutBuffer(t *testing.T) {
+	client := testenv.Redis(t)
+	ctx := context.Background()
+	publisher := NewRedisPublisher(client, 0)
+	if err := publisher.Publish(ctx, "main", "TILE_CLAIMED", map[string]int{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := publisher.Since(ctx, "main", 0, 1); err != nil || ok {
+		t.Fatalf("Since() = %v, %v, want a gap", ok, err)
+	}
+	if msgs, ok, err := publisher.Since(ctx, "main", 1, 1); err != nil || !ok || len(msgs) != 0 {
+		t.Fatalf("Since() when up to date = %v, %v, %v", msgs, ok, err)
+	}
+}
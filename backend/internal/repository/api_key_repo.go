@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"ownthegrid/internal/domain"
+)
+
+const apiKeyColumns = "id, user_id, name, prefix, scopes, rate_per_minute, created_at, last_used_at, revoked_at"
+
+type APIKeyRepo struct {
+	db *sqlx.DB
+}
+
+func NewAPIKeyRepo(db *sqlx.DB) *APIKeyRepo {
+	return &APIKeyRepo{db: db}
+}
+
+// Create stores key with its secret hashed as hash, unless its user already
+// has limit live keys, in which case it returns nil. The user's row is
+// locked so concurrent creates can't both squeeze under the limit.
+func (r *APIKeyRepo) Create(ctx context.Context, key *domain.APIKey, hash string, limit int) (*domain.APIKey, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Create: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, key.UserID); err != nil {
+		return nil, fmt.Errorf("Create lock: %w", err)
+	}
+	created := &domain.APIKey{}
+	query := `
+        INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, rate_per_minute)
+        SELECT $1, $2, $3, $4, $5, $6
+        WHERE (SELECT COUNT(*) FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL) < $7
+        RETURNING ` + apiKeyColumns
+	err = tx.QueryRowxContext(ctx, query,
+		key.UserID, key.Name, key.Prefix, hash, key.Scopes, key.RatePerMinute, limit,
+	).StructScan(created)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Create: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("Create commit: %w", err)
+	}
+	return created, nil
+}
+
+// IsLive reports whether key id exists and hasn't been revoked.
+func (r *APIKeyRepo) IsLive(ctx context.Context, id uuid.UUID) (bool, error) {
+	var live bool
+	query := `SELECT EXISTS (SELECT 1 FROM api_keys WHERE id = $1 AND revoked_at IS NULL)`
+	if err := r.db.GetContext(ctx, &live, query, id); err != nil {
+		return false, fmt.Errorf("IsLive: %w", err)
+	}
+	return live, nil
+}
+
+// GetByHash returns the live key whose secret hashes to hash, or nil.
+func (r *APIKeyRepo) GetByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	key := &domain.APIKey{}
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`
+	err := r.db.QueryRowxContext(ctx, query, hash).StructScan(key)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetByHash: %w", err)
+	}
+	return key, nil
+}
+
+// ListByUser returns the live keys of userID, newest first.
+func (r *APIKeyRepo) ListByUser(ctx context.Context, userID uuid.UUID) ([]domain.APIKey, error) {
+	keys := []domain.APIKey{}
+	query := `
+        SELECT ` + apiKeyColumns + ` FROM api_keys
+        WHERE user_id = $1 AND revoked_at IS NULL
+        ORDER BY created_at DESC
+    `
+	if err := r.db.SelectContext(ctx, &keys, query, userID); err != nil {
+		return nil, fmt.Errorf("ListByUser: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke revokes key id of userID and reports whether there was such a live
+// key.
+func (r *APIKeyRepo) Revoke(ctx context.Context, userID uuid.UUID, id uuid.UUID) (bool, error) {
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	res, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("Revoke: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("Revoke: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Touch records that key id was just used, at most once a minute.
+func (r *APIKeyRepo) Touch(ctx context.Context, id uuid.UUID) error {
+	query := `
+        UPDATE api_keys SET last_used_at = NOW()
+        WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+    `
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("Touch: %w", err)
+	}
+	return nil
+}
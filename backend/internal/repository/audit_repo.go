@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"ownthegrid/internal/domain"
+)
+
+type AuditRepo struct {
+	db *sqlx.DB
+}
+
+func NewAuditRepo(db *sqlx.DB) *AuditRepo {
+	return &AuditRepo{db: db}
+}
+
+// Record writes entry on its own, for actions that change nothing in
+// Postgres.
+func (r *AuditRepo) Record(ctx context.Context, entry *domain.AuditEntry) error {
+	return recordAudit(ctx, r.db, entry, nil)
+}
+
+// recordAudit writes entry through db, normally the transaction of the
+// action it records so the two commit or fail together. extra is merged into
+// the entry's details, for what is only known once the action has run.
+func recordAudit(ctx context.Context, db sqlx.QueryerContext, entry *domain.AuditEntry, extra map[string]interface{}) error {
+	details := entry.Details
+	if len(extra) > 0 {
+		merged := map[string]interface{}{}
+		if len(details) > 0 {
+			if err := json.Unmarshal(details, &merged); err != nil {
+				return fmt.Errorf("recordAudit: %w", err)
+			}
+		}
+		for key, value := range extra {
+			merged[key] = value
+		}
+		raw, err := json.Marshal(merged)
+		if err != nil {
+			return fmt.Errorf("recordAudit: %w", err)
+		}
+		details = raw
+	}
+	if len(details) == 0 {
+		details = []byte(`{}`)
+	}
+	query := `
+        INSERT INTO admin_audit_log (admin_id, action, board_id, target, details)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, created_at
+    `
+	err := db.QueryRowxContext(ctx, query, entry.AdminID, entry.Action, entry.BoardID, entry.Target, []byte(details)).
+		Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("recordAudit: %w", err)
+	}
+	entry.Details = details
+	return nil
+}
+
+// List returns up to limit entries older than beforeID, newest first. A
+// beforeID of 0 starts from the newest entry.
+func (r *AuditRepo) List(ctx context.Context, beforeID int64, limit int) ([]*domain.AuditEntry, error) {
+	entries := []*domain.AuditEntry{}
+	query := `
+        SELECT id, admin_id, action, board_id, target, details, created_at
+        FROM admin_audit_log
+        WHERE $1 = 0 OR id < $1
+        ORDER BY id DESC
+        LIMIT $2
+    `
+	if err := r.db.SelectContext(ctx, &entries, query, beforeID, limit); err != nil {
+		return nil, fmt.Errorf("List: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+
+	"ownthegrid/internal/domain"
+)
+
+type BoardRepo struct {
+	db *sqlx.DB
+}
+
+func NewBoardRepo(db *sqlx.DB) *BoardRepo {
+	return &BoardRepo{db: db}
+}
+
+func (r *BoardRepo) GetByID(ctx context.Context, id string) (*domain.Board, error) {
+	board := &domain.Board{}
+	query := `SELECT id, name, width, height, created_by, created_at FROM boards WHERE id = $1`
+	err := r.db.QueryRowxContext(ctx, query, id).StructScan(board)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetByID: %w", err)
+	}
+	return board, nil
+}
+
+func (r *BoardRepo) List(ctx context.Context) ([]*domain.Board, error) {
+	boards := []*domain.Board{}
+	query := `SELECT id, name, width, height, created_by, created_at FROM boards ORDER BY created_at, id`
+	if err := r.db.SelectContext(ctx, &boards, query); err != nil {
+		return nil, fmt.Errorf("List: %w", err)
+	}
+	return boards, nil
+}
+
+func (r *BoardRepo) Create(ctx context.Context, board *domain.Board) (*domain.Board, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Create: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	created := &domain.Board{}
+	query := `
+        INSERT INTO boards (id, name, width, height, created_by)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, name, width, height, created_by, created_at
+    `
+	err = tx.QueryRowxContext(ctx, query,
+		board.ID, board.Name, board.Width, board.Height, board.CreatedBy,
+	).StructScan(created)
+	if err != nil {
+		return nil, fmt.Errorf("Create: %w", err)
+	}
+
+	if err := seedTiles(ctx, tx, created); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("Create commit: %w", err)
+	}
+	return created, nil
+}
+
+func (r *BoardRepo) SeedTiles(ctx context.Context, board *domain.Board) error {
+	return seedTiles(ctx, r.db, board)
+}
+
+func (r *BoardRepo) TileCount(ctx context.Context, boardID string) (int, error) {
+	var count int
+	if err := r.db.QueryRowxContext(ctx, "SELECT COUNT(*) FROM tiles WHERE board_id = $1", boardID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("TileCount: %w", err)
+	}
+	return count, nil
+}
+
+func seedTiles(ctx context.Context, db sqlx.ExecerContext, board *domain.Board) error {
+	query := `
+		INSERT INTO tiles (board_id, id, x, y)
+		SELECT
+			$1,
+			y * $2 + x AS id,
+			x,
+			y
+		FROM generate_series(0, $3 - 1) AS x,
+		     generate_series(0, $4 - 1) AS y
+		ON CONFLICT (board_id, id) DO NOTHING
+	`
+	_, err := db.ExecContext(ctx, query, board.ID, board.Width, board.Width, board.Height)
+	if err != nil {
+		return fmt.Errorf("SeedTiles: %w", err)
+	}
+	return nil
+}
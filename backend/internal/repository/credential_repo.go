@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// CredentialRepo stores what a returning user can prove themselves with: an
+// optional password hash and single-use recovery codes, kept as SHA-256
+// hashes.
+type CredentialRepo struct {
+	db *sqlx.DB
+}
+
+func NewCredentialRepo(db *sqlx.DB) *CredentialRepo {
+	return &CredentialRepo{db: db}
+}
+
+// PasswordHash returns the password hash of userID, or nil if they have no
+// password.
+func (r *CredentialRepo) PasswordHash(ctx context.Context, userID uuid.UUID) (*string, error) {
+	var hash *string
+	query := `SELECT password_hash FROM users WHERE id = $1`
+	err := r.db.QueryRowxContext(ctx, query, userID).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("PasswordHash: %w", err)
+	}
+	return hash, nil
+}
+
+func (r *CredentialRepo) SetPassword(ctx context.Context, userID uuid.UUID, hash string) error {
+	query := `UPDATE users SET password_hash = $2 WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, userID, hash); err != nil {
+		return fmt.Errorf("SetPassword: %w", err)
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes drops every recovery code of userID, used or not, and
+// stores hashes in their place.
+func (r *CredentialRepo) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, hashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ReplaceRecoveryCodes: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("ReplaceRecoveryCodes delete: %w", err)
+	}
+	if err := insertRecoveryCodes(ctx, tx, userID, hashes); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ReplaceRecoveryCodes commit: %w", err)
+	}
+	return nil
+}
+
+// UseRecoveryCode spends the unused recovery code of userID hashed as hash
+// and reports whether there was one.
+func (r *CredentialRepo) UseRecoveryCode(ctx context.Context, userID uuid.UUID, hash string) (bool, error) {
+	query := `
+        UPDATE recovery_codes SET used_at = NOW()
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+    `
+	res, err := r.db.ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return false, fmt.Errorf("UseRecoveryCode: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("UseRecoveryCode: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RemainingRecoveryCodes counts the unused recovery codes of userID.
+func (r *CredentialRepo) RemainingRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	var total int
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	if err := r.db.QueryRowxContext(ctx, query, userID).Scan(&total); err != nil {
+		return 0, fmt.Errorf("RemainingRecoveryCodes: %w", err)
+	}
+	return total, nil
+}
+
+func insertRecoveryCodes(ctx context.Context, tx *sqlx.Tx, userID uuid.UUID, hashes []string) error {
+	for _, hash := range hashes {
+		query := `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+		if _, err := tx.ExecContext(ctx, query, userID, hash); err != nil {
+			return fmt.Errorf("insertRecoveryCodes: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"ownthegrid/internal/domain"
+)
+
+type EventRepo struct {
+	db *sqlx.DB
+}
+
+func NewEventRepo(db *sqlx.DB) *EventRepo {
+	return &EventRepo{db: db}
+}
+
+type EventFilter struct {
+	From    *time.Time
+	To      *time.Time
+	AfterID int64
+	TileID  *int
+	Limit   int
+}
+
+func (r *EventRepo) List(ctx context.Context, boardID string, filter EventFilter) ([]*domain.TileEvent, error) {
+	events := []*domain.TileEvent{}
+	query := `
+        SELECT
+            e.id, e.board_id, e.tile_id, t.x, t.y, e.user_id,
+            u.username, u.color, e.event_type, e.created_at
+        FROM tile_events e
+        JOIN tiles t ON t.board_id = e.board_id AND t.id = e.tile_id
+        JOIN users u ON u.id = e.user_id
+        WHERE e.board_id = $1
+          AND e.id > $2
+          AND ($3::timestamptz IS NULL OR e.created_at >= $3)
+          AND ($4::timestamptz IS NULL OR e.created_at <= $4)
+          AND ($5::integer IS NULL OR e.tile_id = $5)
+        ORDER BY e.id
+        LIMIT $6
+    `
+	err := r.db.SelectContext(ctx, &events, query,
+		boardID, filter.AfterID, filter.From, filter.To, filter.TileID, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("List: %w", err)
+	}
+	return events, nil
+}
+
+func (r *EventRepo) LastEventAt(ctx context.Context, boardID string, at time.Time) (int64, error) {
+	var id int64
+	query := `SELECT COALESCE(MAX(id), 0) FROM tile_events WHERE board_id = $1 AND created_at <= $2`
+	if err := r.db.QueryRowxContext(ctx, query, boardID, at).Scan(&id); err != nil {
+		return 0, fmt.Errorf("LastEventAt: %w", err)
+	}
+	return id, nil
+}
+
+// SnapshotAt rebuilds the board from the latest event per tile up to and
+// including eventID. A tile whose latest event is a season reset is
+// unclaimed.
+func (r *EventRepo) SnapshotAt(ctx context.Context, boardID string, eventID int64) ([]*domain.Tile, error) {
+	tiles := []*domain.Tile{}
+	query := `
+        WITH latest AS (
+            SELECT DISTINCT ON (tile_id) tile_id, user_id, event_type, created_at
+            FROM tile_events
+            WHERE board_id = $1 AND id <= $2
+            ORDER BY tile_id, id DESC
+        )
+        SELECT
+            t.id, t.x, t.y,
+            l.user_id    AS owner_id,
+            l.created_at AS claimed_at,
+            u.username   AS owner_username,
+            u.color      AS owner_color
+        FROM tiles t
+        LEFT JOIN latest l ON l.tile_id = t.id AND l.event_type <> 'reset'
+        LEFT JOIN users u ON u.id = l.user_id
+        WHERE t.board_id = $1
+        ORDER BY t.id
+    `
+	if err := r.db.SelectContext(ctx, &tiles, query, boardID, eventID); err != nil {
+		return nil, fmt.Errorf("SnapshotAt: %w", err)
+	}
+	return tiles, nil
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/testenv"
+)
+
+func TestSnapshotAt(t *testing.T) {
+	db := testenv.Postgres(t)
+	board := newBoard(t, db, "history", 2, 2)
+	alice, bob := newUser(t, db, "alice"), newUser(t, db, "bob")
+	tiles, events := NewTileRepo(db), NewEventRepo(db)
+	ctx := context.Background()
+	capture := domain.CaptureRules{Enabled: true}
+
+	// Four events: alice claims 0, bob claims 1, bob captures 0, then an
+	// admin resets 1.
+	for _, claim := range []struct {
+		tile int
+		user uuid.UUID
+	}{{0, alice.ID}, {1, bob.ID}, {0, bob.ID}} {
+		if _, err := tiles.ClaimTile(ctx, board.ID, claim.tile, claim.user, capture, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tiles.ResetRegion(ctx, board.ID, domain.Viewport{X: 1, Y: 0, W: 1, H: 1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	logged, err := events.List(ctx, board.ID, EventFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 4 {
+		t.Fatalf("%d events, want 4", len(logged))
+	}
+	wantTypes := []string{"claim", "claim", "capture", "reset"}
+	for i, event := range logged {
+		if event.EventType != wantTypes[i] {
+			t.Fatalf("event %d is %q, want %q", i, event.EventType, wantTypes[i])
+		}
+	}
+
+	tests := []struct {
+		name    string
+		eventID int64
+		want    [4]*uuid.UUID
+	}{
+		{"before any event", 0, [4]*uuid.UUID{}},
+		{"first claim", logged[0].ID, [4]*uuid.UUID{&alice.ID}},
+		{"second claim", logged[1].ID, [4]*uuid.UUID{&alice.ID, &bob.ID}},
+		{"capture", logged[2].ID, [4]*uuid.UUID{&bob.ID, &bob.ID}},
+		{"reset", logged[3].ID, [4]*uuid.UUID{&bob.ID}},
+		{"past the last event", logged[3].ID + 100, [4]*uuid.UUID{&bob.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := events.SnapshotAt(ctx, board.ID, tt.eventID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(snapshot) != 4 {
+				t.Fatalf("%d tiles, want 4", len(snapshot))
+			}
+			for i, tile := range snapshot {
+				want := tt.want[i]
+				if (tile.OwnerID == nil) != (want == nil) || (want != nil && *tile.OwnerID != *want) {
+					t.Fatalf("tile %d owner = %v, want %v", tile.ID, tile.OwnerID, want)
+				}
+				if want != nil && (tile.OwnerUsername == nil || tile.ClaimedAt == nil) {
+					t.Fatalf("tile %d is missing its owner's details", tile.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestListEvents(t *testing.T) {
+	db := testenv.Postgres(t)
+	board := newBoard(t, db, "events", 2, 2)
+	other := newBoard(t, db, "other", 2, 2)
+	alice := newUser(t, db, "alice")
+	tiles, events := NewTileRepo(db), NewEventRepo(db)
+	ctx := context.Background()
+	for _, claim := range []struct {
+		board string
+		tile  int
+	}{{board.ID, 0}, {board.ID, 1}, {other.ID, 0}, {board.ID, 3}} {
+		if _, err := tiles.ClaimTile(ctx, claim.board, claim.tile, alice.ID, domain.CaptureRules{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all, err := events.List(ctx, board.ID, EventFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tile := 1
+
+	tests := []struct {
+		name      string
+		filter    EventFilter
+		wantTiles []int
+	}{
+		{"board only", EventFilter{Limit: 10}, []int{0, 1, 3}},
+		{"limit", EventFilter{Limit: 2}, []int{0, 1}},
+		{"after an event", EventFilter{AfterID: all[0].ID, Limit: 10}, []int{1, 3}},
+		{"one tile", EventFilter{TileID: &tile, Limit: 10}, []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := events.List(ctx, board.ID, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []int{}
+			for _, event := range got {
+				ids = append(ids, event.TileID)
+				if event.Username != "alice" || event.BoardID != board.ID {
+					t.Fatalf("event = %+v", event)
+				}
+			}
+			if len(ids) != len(tt.wantTiles) {
+				t.Fatalf("tiles %v, want %v", ids, tt.wantTiles)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantTiles[i] {
+					t.Fatalf("tiles %v, want %v", ids, tt.wantTiles)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"ownthegrid/internal/domain"
+)
+
+func newUser(t *testing.T, db *sqlx.DB, username string) *domain.User {
+	t.Helper()
+	user, err := NewUserRepo(db).Create(context.Background(), &domain.User{Username: username, Color: domain.ColorPalette[0]}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func newBoard(t *testing.T, db *sqlx.DB, id string, width, height int) *domain.Board {
+	t.Helper()
+	board, err := NewBoardRepo(db).Create(context.Background(), &domain.Board{ID: id, Name: id, Width: width, Height: height})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return board
+}
+
+// setOwner hands tileID to owner as if they had claimed it age ago, or
+// unclaims it when owner is nil.
+func setOwner(t *testing.T, db *sqlx.DB, boardID string, tileID int, owner *uuid.UUID, age time.Duration) {
+	t.Helper()
+	query := `
+        UPDATE tiles
+        SET owner_id = $3, claimed_at = CASE WHEN $3::uuid IS NULL THEN NULL ELSE NOW() - make_interval(secs => $4) END
+        WHERE board_id = $1 AND id = $2
+    `
+	if _, err := db.Exec(query, boardID, tileID, owner, age.Seconds()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lastEventType returns the type of the newest tile event on boardID.
+func lastEventType(t *testing.T, db *sqlx.DB, boardID string) string {
+	t.Helper()
+	var eventType string
+	if err := db.Get(&eventType, `SELECT event_type FROM tile_events WHERE board_id = $1 ORDER BY id DESC LIMIT 1`, boardID); err != nil {
+		t.Fatal(err)
+	}
+	return eventType
+}
@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"ownthegrid/internal/domain"
+)
+
+const seasonColumns = `id, board_id, number, starts_at, ends_at, ended_at`
+
+type SeasonRepo struct {
+	db *sqlx.DB
+}
+
+func NewSeasonRepo(db *sqlx.DB) *SeasonRepo {
+	return &SeasonRepo{db: db}
+}
+
+// Current returns the running season on boardID, or nil if there is none.
+func (r *SeasonRepo) Current(ctx context.Context, boardID string) (*domain.Season, error) {
+	season := &domain.Season{}
+	query := `SELECT ` + seasonColumns + ` FROM seasons WHERE board_id = $1 AND ended_at IS NULL`
+	err := r.db.QueryRowxContext(ctx, query, boardID).StructScan(season)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Current: %w", err)
+	}
+	return season, nil
+}
+
+func (r *SeasonRepo) GetByID(ctx context.Context, id int64) (*domain.Season, error) {
+	season := &domain.Season{}
+	query := `SELECT ` + seasonColumns + ` FROM seasons WHERE id = $1`
+	err := r.db.QueryRowxContext(ctx, query, id).StructScan(season)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetByID: %w", err)
+	}
+	return season, nil
+}
+
+// List returns boardID's seasons, newest first.
+func (r *SeasonRepo) List(ctx context.Context, boardID string) ([]*domain.Season, error) {
+	seasons := []*domain.Season{}
+	query := `SELECT ` + seasonColumns + ` FROM seasons WHERE board_id = $1 ORDER BY number DESC`
+	if err := r.db.SelectContext(ctx, &seasons, query, boardID); err != nil {
+		return nil, fmt.Errorf("List: %w", err)
+	}
+	return seasons, nil
+}
+
+// Start begins the first season on boardID. It fails with a unique
+// violation if a season is already running.
+func (r *SeasonRepo) Start(ctx context.Context, boardID string, endsAt time.Time) (*domain.Season, error) {
+	return startSeason(ctx, r.db, boardID, endsAt)
+}
+
+// End archives the final board and standings of season, resets every tile
+// on its board and bumps the board's chunk versions, all in one
+// transaction. When nextEndsAt is set the next season starts straight away
+// and is returned. It returns domain.ErrSeasonEnded if season was already
+// ended, for example by another instance.
+func (r *SeasonRepo) End(ctx context.Context, season *domain.Season, nextEndsAt *time.Time) (*domain.Season, *domain.Season, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("End: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	ended := &domain.Season{}
+	query := `
+        UPDATE seasons SET ended_at = NOW()
+        WHERE id = $1 AND ended_at IS NULL
+        RETURNING ` + seasonColumns
+	err = tx.QueryRowxContext(ctx, query, season.ID).StructScan(ended)
+	if err == sql.ErrNoRows {
+		return nil, nil, domain.ErrSeasonEnded
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("End: %w", err)
+	}
+
+	// Claims lock their tile row, so locking the whole board first means the
+	// archive sees every committed claim and none can land before the reset.
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM tiles WHERE board_id = $1 FOR UPDATE`, ended.BoardID); err != nil {
+		return nil, nil, fmt.Errorf("End lock: %w", err)
+	}
+
+	steps := []struct {
+		name  string
+		query string
+		args  []interface{}
+	}{
+		{"archive tiles", `
+            INSERT INTO season_tiles (
+                season_id, tile_id, x, y, owner_id, owner_username, owner_color,
+                owner_team_id, owner_team_name, claimed_at
+            )
+            SELECT
+                $2, t.id, t.x, t.y, t.owner_id, u.username, COALESCE(tm.color, u.color),
+                u.team_id, tm.name, t.claimed_at
+            FROM tiles t
+            JOIN users u ON u.id = t.owner_id
+            LEFT JOIN teams tm ON tm.id = u.team_id
+            WHERE t.board_id = $1
+        `, []interface{}{ended.BoardID, ended.ID}},
+		{"archive standings", `
+            INSERT INTO season_standings (season_id, user_id, username, color, tile_count, rank)
+            SELECT $1, u.id, u.username, u.color, c.tile_count, RANK() OVER (ORDER BY c.tile_count DESC)
+            FROM (
+                SELECT owner_id, COUNT(*) AS tile_count
+                FROM season_tiles
+                WHERE season_id = $1
+                GROUP BY owner_id
+            ) c
+            JOIN users u ON u.id = c.owner_id
+        `, []interface{}{ended.ID}},
+		{"archive team standings", `
+            INSERT INTO season_team_standings (season_id, team_id, name, color, tile_count, rank)
+            SELECT $1, tm.id, tm.name, tm.color, c.tile_count, RANK() OVER (ORDER BY c.tile_count DESC)
+            FROM (
+                SELECT owner_team_id, COUNT(*) AS tile_count
+                FROM season_tiles
+                WHERE season_id = $1 AND owner_team_id IS NOT NULL
+                GROUP BY owner_team_id
+            ) c
+            JOIN teams tm ON tm.id = c.owner_team_id
+        `, []interface{}{ended.ID}},
+		{"record resets", `
+            INSERT INTO tile_events (board_id, tile_id, user_id, event_type)
+            SELECT board_id, id, owner_id, 'reset'
+            FROM tiles
+            WHERE board_id = $1 AND owner_id IS NOT NULL
+        `, []interface{}{ended.BoardID}},
+		{"reset tiles", `
+            UPDATE tiles SET owner_id = NULL, claimed_at = NULL
+            WHERE board_id = $1 AND owner_id IS NOT NULL
+        `, []interface{}{ended.BoardID}},
+		{"bump chunks", `
+            UPDATE board_chunks SET version = version + 1
+            WHERE board_id = $1
+        `, []interface{}{ended.BoardID}},
+	}
+	for _, step := range steps {
+		if _, err := tx.ExecContext(ctx, step.query, step.args...); err != nil {
+			return nil, nil, fmt.Errorf("End %s: %w", step.name, err)
+		}
+	}
+
+	var next *domain.Season
+	if nextEndsAt != nil {
+		next, err = startSeason(ctx, tx, ended.BoardID, *nextEndsAt)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("End commit: %w", err)
+	}
+	return ended, next, nil
+}
+
+func startSeason(ctx context.Context, db sqlx.QueryerContext, boardID string, endsAt time.Time) (*domain.Season, error) {
+	season := &domain.Season{}
+	query := `
+        INSERT INTO seasons (board_id, number, starts_at, ends_at)
+        SELECT $1, COALESCE(MAX(number), 0) + 1, NOW(), $2
+        FROM seasons
+        WHERE board_id = $1
+        RETURNING ` + seasonColumns
+	if err := db.QueryRowxContext(ctx, query, boardID, endsAt).StructScan(season); err != nil {
+		return nil, fmt.Errorf("startSeason: %w", err)
+	}
+	return season, nil
+}
+
+// Standings returns the archived user standings of seasonID, best first.
+func (r *SeasonRepo) Standings(ctx context.Context, seasonID int64) ([]domain.LeaderboardEntry, error) {
+	entries := []domain.LeaderboardEntry{}
+	query := `
+        SELECT user_id, username, color, tile_count, rank
+        FROM season_standings
+        WHERE season_id = $1
+        ORDER BY rank, username
+    `
+	if err := r.db.SelectContext(ctx, &entries, query, seasonID); err != nil {
+		return nil, fmt.Errorf("Standings: %w", err)
+	}
+	return entries, nil
+}
+
+// TeamStandings returns the archived team standings of seasonID, best first.
+func (r *SeasonRepo) TeamStandings(ctx context.Context, seasonID int64) ([]domain.TeamLeaderboardEntry, error) {
+	entries := []domain.TeamLeaderboardEntry{}
+	query := `
+        SELECT team_id, name, color, tile_count, rank
+        FROM season_team_standings
+        WHERE season_id = $1
+        ORDER BY rank, name
+    `
+	if err := r.db.SelectContext(ctx, &entries, query, seasonID); err != nil {
+		return nil, fmt.Errorf("TeamStandings: %w", err)
+	}
+	return entries, nil
+}
+
+// Winners returns everyone ranked first in each of seasonIDs, keyed by
+// season.
+func (r *SeasonRepo) Winners(ctx context.Context, seasonIDs []int64) (map[int64][]domain.LeaderboardEntry, map[int64][]domain.TeamLeaderboardEntry, error) {
+	users := map[int64][]domain.LeaderboardEntry{}
+	teams := map[int64][]domain.TeamLeaderboardEntry{}
+	if len(seasonIDs) == 0 {
+		return users, teams, nil
+	}
+
+	userRows := []struct {
+		SeasonID int64 `db:"season_id"`
+		domain.LeaderboardEntry
+	}{}
+	query, args, err := sqlx.In(`
+        SELECT season_id, user_id, username, color, tile_count, rank
+        FROM season_standings
+        WHERE season_id IN (?) AND rank = 1
+        ORDER BY username
+    `, seasonIDs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Winners: %w", err)
+	}
+	if err := r.db.SelectContext(ctx, &userRows, r.db.Rebind(query), args...); err != nil {
+		return nil, nil, fmt.Errorf("Winners: %w", err)
+	}
+	for _, row := range userRows {
+		users[row.SeasonID] = append(users[row.SeasonID], row.LeaderboardEntry)
+	}
+
+	teamRows := []struct {
+		SeasonID int64 `db:"season_id"`
+		domain.TeamLeaderboardEntry
+	}{}
+	query, args, err = sqlx.In(`
+        SELECT season_id, team_id, name, color, tile_count, rank
+        FROM season_team_standings
+        WHERE season_id IN (?) AND rank = 1
+        ORDER BY name
+    `, seasonIDs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Winners: %w", err)
+	}
+	if err := r.db.SelectContext(ctx, &teamRows, r.db.Rebind(query), args...); err != nil {
+		return nil, nil, fmt.Errorf("Winners: %w", err)
+	}
+	for _, row := range teamRows {
+		teams[row.SeasonID] = append(teams[row.SeasonID], row.TeamLeaderboardEntry)
+	}
+	return users, teams, nil
+}
+
+// Tiles returns the claimed tiles of seasonID's final board.
+func (r *SeasonRepo) Tiles(ctx context.Context, seasonID int64) ([]*domain.Tile, error) {
+	tiles := []*domain.Tile{}
+	query := `
+        SELECT
+            tile_id AS id, x, y, owner_id, claimed_at, owner_username, owner_color,
+            owner_team_id, owner_team_name
+        FROM season_tiles
+        WHERE season_id = $1
+        ORDER BY tile_id
+    `
+	if err := r.db.SelectContext(ctx, &tiles, query, seasonID); err != nil {
+		return nil, fmt.Errorf("Tiles: %w", err)
+	}
+	return tiles, nil
+}
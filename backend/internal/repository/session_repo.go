@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"ownthegrid/internal/domain"
+)
+
+// SessionRepo stores refresh tokens. Only a SHA-256 hash of each token is
+// kept; every token belongs to a session and is used at most once.
+type SessionRepo struct {
+	db *sqlx.DB
+}
+
+func NewSessionRepo(db *sqlx.DB) *SessionRepo {
+	return &SessionRepo{db: db}
+}
+
+// Create stores the refresh token hashed as hash in session.
+func (r *SessionRepo) Create(ctx context.Context, session domain.Session, hash string, expiresAt time.Time) error {
+	query := `
+        INSERT INTO refresh_tokens (session_id, user_id, token_hash, expires_at)
+        VALUES ($1, $2, $3, $4)
+    `
+	if _, err := r.db.ExecContext(ctx, query, session.ID, session.UserID, hash, expiresAt); err != nil {
+		return fmt.Errorf("Create: %w", err)
+	}
+	return nil
+}
+
+// Rotate spends the refresh token hashed as hash and stores its successor,
+// hashed as nextHash, in the same session. It returns domain.ErrTokenInvalid
+// for unknown or expired tokens and tokens of a revoked session. A token
+// that was already spent revokes its session and yields a
+// *domain.TokenReuseError.
+func (r *SessionRepo) Rotate(ctx context.Context, hash string, nextHash string, expiresAt time.Time) (*domain.Session, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Rotate: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var current struct {
+		domain.Session
+		Expired bool `db:"expired"`
+		Used    bool `db:"used"`
+		Revoked bool `db:"revoked"`
+	}
+	query := `
+        SELECT
+            session_id, user_id,
+            expires_at <= NOW()    AS expired,
+            used_at IS NOT NULL    AS used,
+            revoked_at IS NOT NULL AS revoked
+        FROM refresh_tokens
+        WHERE token_hash = $1
+        FOR UPDATE
+    `
+	err = tx.QueryRowxContext(ctx, query, hash).StructScan(&current)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrTokenInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Rotate: %w", err)
+	}
+	if current.Revoked || current.Expired {
+		return nil, domain.ErrTokenInvalid
+	}
+	if current.Used {
+		if err := revokeSession(ctx, tx, current.ID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("Rotate commit: %w", err)
+		}
+		return nil, &domain.TokenReuseError{Session: current.Session}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET used_at = NOW() WHERE token_hash = $1`, hash); err != nil {
+		return nil, fmt.Errorf("Rotate spend: %w", err)
+	}
+	insert := `
+        INSERT INTO refresh_tokens (session_id, user_id, token_hash, expires_at)
+        VALUES ($1, $2, $3, $4)
+    `
+	if _, err := tx.ExecContext(ctx, insert, current.ID, current.UserID, nextHash, expiresAt); err != nil {
+		return nil, fmt.Errorf("Rotate insert: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("Rotate commit: %w", err)
+	}
+	return &current.Session, nil
+}
+
+// RevokeSession revokes every refresh token in sessionID.
+func (r *SessionRepo) RevokeSession(ctx context.Context, sessionID uuid.UUID) error {
+	return revokeSession(ctx, r.db, sessionID)
+}
+
+// RevokeByHash revokes the session the refresh token hashed as hash belongs
+// to and returns it, or nil if there is no such token.
+func (r *SessionRepo) RevokeByHash(ctx context.Context, hash string) (*domain.Session, error) {
+	session := &domain.Session{}
+	query := `SELECT session_id, user_id FROM refresh_tokens WHERE token_hash = $1`
+	err := r.db.QueryRowxContext(ctx, query, hash).StructScan(session)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("RevokeByHash: %w", err)
+	}
+	if err := revokeSession(ctx, r.db, session.ID); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// StartedAt returns when sessionID was started, or nil if it is revoked or
+// unknown.
+func (r *SessionRepo) StartedAt(ctx context.Context, sessionID uuid.UUID) (*time.Time, error) {
+	var started sql.NullTime
+	query := `SELECT MIN(created_at) FROM refresh_tokens WHERE session_id = $1 AND revoked_at IS NULL`
+	if err := r.db.GetContext(ctx, &started, query, sessionID); err != nil {
+		return nil, fmt.Errorf("StartedAt: %w", err)
+	}
+	if !started.Valid {
+		return nil, nil
+	}
+	return &started.Time, nil
+}
+
+// RevokeUser revokes every live session of userID and returns them.
+func (r *SessionRepo) RevokeUser(ctx context.Context, userID uuid.UUID) ([]domain.Session, error) {
+	return r.revokeUser(ctx, userID, uuid.Nil)
+}
+
+// RevokeOthers revokes every live session of userID but keep and returns
+// them.
+func (r *SessionRepo) RevokeOthers(ctx context.Context, userID uuid.UUID, keep uuid.UUID) ([]domain.Session, error) {
+	return r.revokeUser(ctx, userID, keep)
+}
+
+func (r *SessionRepo) revokeUser(ctx context.Context, userID uuid.UUID, keep uuid.UUID) ([]domain.Session, error) {
+	sessions := []domain.Session{}
+	query := `
+        UPDATE refresh_tokens SET revoked_at = NOW()
+        WHERE user_id = $1 AND session_id <> $2 AND revoked_at IS NULL AND expires_at > NOW()
+        RETURNING session_id, user_id
+    `
+	if err := r.db.SelectContext(ctx, &sessions, query, userID, keep); err != nil {
+		return nil, fmt.Errorf("revokeUser: %w", err)
+	}
+	seen := make(map[uuid.UUID]bool, len(sessions))
+	unique := sessions[:0]
+	for _, session := range sessions {
+		if !seen[session.ID] {
+			seen[session.ID] = true
+			unique = append(unique, session)
+		}
+	}
+	return unique, nil
+}
+
+func revokeSession(ctx context.Context, db sqlx.ExecerContext, sessionID uuid.UUID) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE session_id = $1 AND revoked_at IS NULL`
+	if _, err := db.ExecContext(ctx, query, sessionID); err != nil {
+		return fmt.Errorf("revokeSession: %w", err)
+	}
+	return nil
+}
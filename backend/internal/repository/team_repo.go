@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"ownthegrid/internal/domain"
+)
+
+const teamColumns = `
+            tm.id, tm.name, tm.color, tm.created_by, tm.created_at,
+            (SELECT COUNT(*) FROM users u WHERE u.team_id = tm.id) AS member_count
+    `
+
+type TeamRepo struct {
+	db *sqlx.DB
+}
+
+func NewTeamRepo(db *sqlx.DB) *TeamRepo {
+	return &TeamRepo{db: db}
+}
+
+func (r *TeamRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Team, error) {
+	team := &domain.Team{}
+	query := `SELECT ` + teamColumns + ` FROM teams tm WHERE tm.id = $1`
+	err := r.db.QueryRowxContext(ctx, query, id).StructScan(team)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetByID: %w", err)
+	}
+	return team, nil
+}
+
+func (r *TeamRepo) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]*domain.Team, error) {
+	if len(ids) == 0 {
+		return []*domain.Team{}, nil
+	}
+	query, args, err := sqlx.In(`SELECT `+teamColumns+` FROM teams tm WHERE tm.id IN (?)`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("GetByIDs: %w", err)
+	}
+	query = r.db.Rebind(query)
+	teams := []*domain.Team{}
+	if err := r.db.SelectContext(ctx, &teams, query, args...); err != nil {
+		return nil, fmt.Errorf("GetByIDs: %w", err)
+	}
+	return teams, nil
+}
+
+func (r *TeamRepo) List(ctx context.Context) ([]*domain.Team, error) {
+	teams := []*domain.Team{}
+	query := `SELECT ` + teamColumns + ` FROM teams tm ORDER BY tm.name`
+	if err := r.db.SelectContext(ctx, &teams, query); err != nil {
+		return nil, fmt.Errorf("List: %w", err)
+	}
+	return teams, nil
+}
+
+func (r *TeamRepo) Members(ctx context.Context, teamID uuid.UUID) ([]*domain.User, error) {
+	users := []*domain.User{}
+	query := `SELECT ` + userColumns + ` FROM users WHERE team_id = $1 ORDER BY username`
+	if err := r.db.SelectContext(ctx, &users, query, teamID); err != nil {
+		return nil, fmt.Errorf("Members: %w", err)
+	}
+	return users, nil
+}
+
+// Create inserts team and moves its creator into it. It returns the new team
+// and the team the creator left, if any.
+func (r *TeamRepo) Create(ctx context.Context, team *domain.Team, createdBy uuid.UUID) (*domain.Team, *uuid.UUID, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Create: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	created := &domain.Team{}
+	query := `
+        INSERT INTO teams (name, color, created_by)
+        VALUES ($1, $2, $3)
+        RETURNING id, name, color, created_by, created_at
+    `
+	if err := tx.QueryRowxContext(ctx, query, team.Name, team.Color, createdBy).StructScan(created); err != nil {
+		return nil, nil, fmt.Errorf("Create: %w", err)
+	}
+
+	previous, err := setTeam(ctx, tx, createdBy, &created.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("Create commit: %w", err)
+	}
+	created.MemberCount = 1
+	return created, previous, nil
+}
+
+// SetMembership moves userID into teamID, or out of any team when teamID is
+// nil, and returns the team they were in before. A team left without
+// members is deleted.
+func (r *TeamRepo) SetMembership(ctx context.Context, userID uuid.UUID, teamID *uuid.UUID) (*uuid.UUID, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("SetMembership: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	previous, err := setTeam(ctx, tx, userID, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("SetMembership commit: %w", err)
+	}
+	return previous, nil
+}
+
+func setTeam(ctx context.Context, tx *sqlx.Tx, userID uuid.UUID, teamID *uuid.UUID) (*uuid.UUID, error) {
+	var previous *uuid.UUID
+	err := tx.QueryRowxContext(ctx, `SELECT team_id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("setTeam: user %s not found", userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("setTeam: %w", err)
+	}
+
+	if teamID != nil {
+		var found int
+		err := tx.QueryRowxContext(ctx, `SELECT 1 FROM teams WHERE id = $1 FOR SHARE`, *teamID).Scan(&found)
+		if err == sql.ErrNoRows {
+			return nil, domain.ErrTeamNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("setTeam: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE users SET team_id = $2 WHERE id = $1`, userID, teamID); err != nil {
+		return nil, fmt.Errorf("setTeam: %w", err)
+	}
+
+	if !sameTeam(previous, teamID) {
+		// The user's tiles now show another team and color, so chunks
+		// holding them must not be served from caches any more. Nobody
+		// else's tiles change: a team's color is fixed when it is created.
+		// Chunk rows are locked in key order so concurrent bumps can't
+		// deadlock.
+		query := `
+            INSERT INTO board_chunks (board_id, cx, cy, version)
+            SELECT DISTINCT board_id, x / $2, y / $2, 1
+            FROM tiles
+            WHERE owner_id = $1
+            ORDER BY 1, 2, 3
+            ON CONFLICT (board_id, cx, cy) DO UPDATE SET version = board_chunks.version + 1
+        `
+		if _, err := tx.ExecContext(ctx, query, userID, domain.ChunkSize); err != nil {
+			return nil, fmt.Errorf("setTeam chunks: %w", err)
+		}
+	}
+
+	if previous != nil && !sameTeam(previous, teamID) {
+		query := `
+            DELETE FROM teams
+            WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM users WHERE team_id = $1)
+        `
+		if _, err := tx.ExecContext(ctx, query, *previous); err != nil {
+			return nil, fmt.Errorf("setTeam: %w", err)
+		}
+	}
+	return previous, nil
+}
+
+func sameTeam(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -1,9 +1,11 @@
 package repository
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,96 +22,432 @@ func NewTileRepo(db *sqlx.DB) *TileRepo {
 	return &TileRepo{db: db}
 }
 
-func (r *TileRepo) GetAllTilesWithOwners(ctx context.Context) ([]*domain.Tile, error) {
+func (r *TileRepo) GetAllTilesWithOwners(ctx context.Context, boardID string) ([]*domain.Tile, error) {
 	tiles := []*domain.Tile{}
 	query := `
         SELECT
             t.id, t.x, t.y, t.owner_id, t.claimed_at,
             u.username AS owner_username,
-            u.color    AS owner_color
+            COALESCE(tm.color, u.color) AS owner_color,
+            u.team_id  AS owner_team_id,
+            tm.name    AS owner_team_name
         FROM tiles t
         LEFT JOIN users u ON u.id = t.owner_id
+        LEFT JOIN teams tm ON tm.id = u.team_id
+        WHERE t.board_id = $1
         ORDER BY t.id
     `
-	if err := r.db.SelectContext(ctx, &tiles, query); err != nil {
+	if err := r.db.SelectContext(ctx, &tiles, query, boardID); err != nil {
 		return nil, fmt.Errorf("GetAllTilesWithOwners: %w", err)
 	}
 	return tiles, nil
 }
 
-func (r *TileRepo) ClaimTile(ctx context.Context, tileID int, userID uuid.UUID) (*domain.Tile, error) {
+const tilesInRectQuery = `
+        SELECT
+            t.id, t.x, t.y, t.owner_id, t.claimed_at,
+            u.username AS owner_username,
+            COALESCE(tm.color, u.color) AS owner_color,
+            u.team_id  AS owner_team_id,
+            tm.name    AS owner_team_name
+        FROM tiles t
+        LEFT JOIN users u ON u.id = t.owner_id
+        LEFT JOIN teams tm ON tm.id = u.team_id
+        WHERE t.board_id = $1
+          AND t.x >= $2 AND t.x < $3
+          AND t.y >= $4 AND t.y < $5
+        ORDER BY t.id
+    `
+
+func (r *TileRepo) GetTilesInViewport(ctx context.Context, boardID string, vp domain.Viewport) ([]*domain.Tile, error) {
+	tiles := []*domain.Tile{}
+	err := r.db.SelectContext(ctx, &tiles, tilesInRectQuery, boardID, vp.X, vp.X+vp.W, vp.Y, vp.Y+vp.H)
+	if err != nil {
+		return nil, fmt.Errorf("GetTilesInViewport: %w", err)
+	}
+	return tiles, nil
+}
+
+// TileOwner returns who owns tileID on boardID, or nil if nobody does.
+func (r *TileRepo) TileOwner(ctx context.Context, boardID string, tileID int) (*uuid.UUID, error) {
+	var owner *uuid.UUID
+	err := r.db.QueryRowxContext(ctx, `SELECT owner_id FROM tiles WHERE board_id = $1 AND id = $2`, boardID, tileID).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrTileInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("TileOwner: %w", err)
+	}
+	return owner, nil
+}
+
+func (r *TileRepo) ClaimTile(
+	ctx context.Context,
+	boardID string,
+	tileID int,
+	userID uuid.UUID,
+	rules domain.CaptureRules,
+	audit *domain.AuditEntry,
+) (*domain.ClaimResult, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ClaimTile: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var current struct {
+		OwnerID       *uuid.UUID `db:"owner_id"`
+		OwnerTeamID   *uuid.UUID `db:"owner_team_id"`
+		Protected     bool       `db:"protected"`
+		ClaimerBanned bool       `db:"claimer_banned"`
+	}
+	// The claimer's ban is checked here too, so a banned user whose
+	// connection outlived the ban still can't claim.
+	lockQuery := `
+        SELECT
+            t.owner_id,
+            u.team_id AS owner_team_id,
+            COALESCE(t.claimed_at > NOW() - make_interval(secs => $3), FALSE) AS protected,
+            COALESCE((SELECT banned_at IS NOT NULL FROM users WHERE id = $4), FALSE) AS claimer_banned
+        FROM tiles t
+        LEFT JOIN users u ON u.id = t.owner_id
+        WHERE t.board_id = $1 AND t.id = $2
+        FOR UPDATE OF t
+    `
+	err = tx.QueryRowxContext(ctx, lockQuery, boardID, tileID, rules.ProtectionWindow.Seconds(), userID).StructScan(&current)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrTileInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ClaimTile: %w", err)
+	}
+	if current.ClaimerBanned {
+		return nil, domain.ErrUserBanned
+	}
+
+	eventType := "claim"
+	if current.OwnerID != nil {
+		if !rules.Enabled || *current.OwnerID == userID {
+			return nil, domain.ErrTileAlreadyClaimed
+		}
+		if current.Protected {
+			return nil, domain.ErrTileProtected
+		}
+		if rules.RequireAdjacent {
+			adjacent, err := r.hasAdjacentTile(ctx, tx, boardID, tileID, userID)
+			if err != nil {
+				return nil, err
+			}
+			if !adjacent {
+				return nil, domain.ErrTileNotAdjacent
+			}
+		}
+		eventType = "capture"
+	}
+
 	tile := &domain.Tile{}
+	// The claimer's row is share-locked so a concurrent team change can't
+	// slip in between reading their team and committing the claim.
 	query := `
-        UPDATE tiles
+        WITH owner AS (
+            SELECT u.username, COALESCE(tm.color, u.color) AS color, u.team_id, tm.name AS team_name
+            FROM users u
+            LEFT JOIN teams tm ON tm.id = u.team_id
+            WHERE u.id = $1
+            FOR SHARE OF u
+        )
+        UPDATE tiles t
         SET owner_id = $1, claimed_at = NOW()
-        WHERE id = $2
-          AND owner_id IS NULL
+        FROM owner
+        WHERE t.board_id = $2 AND t.id = $3
         RETURNING
-            id, x, y, owner_id, claimed_at,
-            (SELECT username FROM users WHERE id = $1) AS owner_username,
-            (SELECT color FROM users WHERE id = $1) AS owner_color
+            t.id, t.x, t.y, t.owner_id, t.claimed_at,
+            owner.username  AS owner_username,
+            owner.color     AS owner_color,
+            owner.team_id   AS owner_team_id,
+            owner.team_name AS owner_team_name
+    `
+	if err := tx.QueryRowxContext(ctx, query, userID, boardID, tileID).StructScan(tile); err != nil {
+		return nil, fmt.Errorf("ClaimTile: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO tile_events (board_id, tile_id, user_id, event_type) VALUES ($1, $2, $3, $4)`,
+		boardID, tileID, userID, eventType,
+	); err != nil {
+		return nil, fmt.Errorf("ClaimTile event: %w", err)
+	}
+
+	cx, cy := domain.ChunkOf(tile.X, tile.Y)
+	var chunkVersion int64
+	chunkQuery := `
+        INSERT INTO board_chunks (board_id, cx, cy, version)
+        VALUES ($1, $2, $3, 1)
+        ON CONFLICT (board_id, cx, cy) DO UPDATE SET version = board_chunks.version + 1
+        RETURNING version
+    `
+	if err := tx.QueryRowxContext(ctx, chunkQuery, boardID, cx, cy).Scan(&chunkVersion); err != nil {
+		return nil, fmt.Errorf("ClaimTile chunk: %w", err)
+	}
+
+	if audit != nil {
+		var extra map[string]interface{}
+		if current.OwnerID != nil {
+			extra = map[string]interface{}{"previousOwner": current.OwnerID}
+		}
+		if err := recordAudit(ctx, tx, audit, extra); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ClaimTile commit: %w", err)
+	}
+
+	return &domain.ClaimResult{
+		Tile:            tile,
+		PreviousOwnerID: current.OwnerID,
+		PreviousTeamID:  current.OwnerTeamID,
+		ChunkVersion:    chunkVersion,
+	}, nil
+}
+
+// ResetRegion unclaims every tile inside vp, records a reset event for each
+// and bumps the versions of the chunks it touched, all in one transaction.
+// It returns how many tiles were reset. audit, if not nil, is recorded in the
+// same transaction with the region and the count added to its details.
+func (r *TileRepo) ResetRegion(ctx context.Context, boardID string, vp domain.Viewport, audit *domain.AuditEntry) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("ResetRegion: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var reset []struct {
+		ID int `db:"id"`
+		X  int `db:"x"`
+		Y  int `db:"y"`
+	}
+	query := `
+        SELECT id, x, y
+        FROM tiles
+        WHERE board_id = $1
+          AND x >= $2 AND x < $3
+          AND y >= $4 AND y < $5
+          AND owner_id IS NOT NULL
+        ORDER BY id
+        FOR UPDATE
+    `
+	if err := tx.SelectContext(ctx, &reset, query, boardID, vp.X, vp.X+vp.W, vp.Y, vp.Y+vp.H); err != nil {
+		return 0, fmt.Errorf("ResetRegion lock: %w", err)
+	}
+	if len(reset) == 0 {
+		return 0, r.commitAudit(ctx, tx, audit, vp, 0)
+	}
+
+	ids := make([]int, 0, len(reset))
+	seen := map[[2]int]bool{}
+	var chunks [][2]int
+	for _, tile := range reset {
+		ids = append(ids, tile.ID)
+		cx, cy := domain.ChunkOf(tile.X, tile.Y)
+		if chunk := [2]int{cx, cy}; !seen[chunk] {
+			seen[chunk] = true
+			chunks = append(chunks, chunk)
+		}
+	}
+	// Chunk rows are locked in key order so overlapping resets and claims
+	// can't deadlock on them.
+	slices.SortFunc(chunks, func(a, b [2]int) int {
+		if a[0] != b[0] {
+			return cmp.Compare(a[0], b[0])
+		}
+		return cmp.Compare(a[1], b[1])
+	})
+
+	steps := []struct {
+		name  string
+		query string
+	}{
+		{"record resets", `
+            INSERT INTO tile_events (board_id, tile_id, user_id, event_type)
+            SELECT board_id, id, owner_id, 'reset'
+            FROM tiles
+            WHERE board_id = ? AND id IN (?)
+        `},
+		{"reset tiles", `
+            UPDATE tiles SET owner_id = NULL, claimed_at = NULL
+            WHERE board_id = ? AND id IN (?)
+        `},
+	}
+	for _, step := range steps {
+		q, args, err := sqlx.In(step.query, boardID, ids)
+		if err != nil {
+			return 0, fmt.Errorf("ResetRegion %s: %w", step.name, err)
+		}
+		if _, err := tx.ExecContext(ctx, tx.Rebind(q), args...); err != nil {
+			return 0, fmt.Errorf("ResetRegion %s: %w", step.name, err)
+		}
+	}
+
+	chunkQuery := `
+        INSERT INTO board_chunks (board_id, cx, cy, version)
+        VALUES ($1, $2, $3, 1)
+        ON CONFLICT (board_id, cx, cy) DO UPDATE SET version = board_chunks.version + 1
     `
-	err := r.db.QueryRowxContext(ctx, query, userID, tileID).StructScan(tile)
+	for _, chunk := range chunks {
+		if _, err := tx.ExecContext(ctx, chunkQuery, boardID, chunk[0], chunk[1]); err != nil {
+			return 0, fmt.Errorf("ResetRegion chunk: %w", err)
+		}
+	}
+
+	if err := r.commitAudit(ctx, tx, audit, vp, len(reset)); err != nil {
+		return 0, err
+	}
+	return len(reset), nil
+}
+
+// commitAudit records the audit entry of a region reset, if any, and
+// commits tx.
+func (r *TileRepo) commitAudit(ctx context.Context, tx *sqlx.Tx, audit *domain.AuditEntry, vp domain.Viewport, count int) error {
+	if audit != nil {
+		extra := map[string]interface{}{"x": vp.X, "y": vp.Y, "w": vp.W, "h": vp.H, "reset": count}
+		if err := recordAudit(ctx, tx, audit, extra); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("ResetRegion commit: %w", err)
+	}
+	return nil
+}
+
+// ChunkVersion returns the current version of chunk cx, cy; chunks nobody
+// has claimed in yet are at version 0.
+func (r *TileRepo) ChunkVersion(ctx context.Context, boardID string, cx, cy int) (int64, error) {
+	var version int64
+	query := `SELECT version FROM board_chunks WHERE board_id = $1 AND cx = $2 AND cy = $3`
+	err := r.db.QueryRowxContext(ctx, query, boardID, cx, cy).Scan(&version)
 	if err == sql.ErrNoRows {
-		return nil, domain.ErrTileAlreadyClaimed
+		return 0, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("ClaimTile: %w", err)
+		return 0, fmt.Errorf("ChunkVersion: %w", err)
+	}
+	return version, nil
+}
+
+// GetChunk loads the tiles in bounds together with the chunk's version from
+// one snapshot, so the version always matches the tiles returned.
+func (r *TileRepo) GetChunk(ctx context.Context, boardID string, cx, cy int, bounds domain.Viewport) (*domain.Chunk, error) {
+	tx, err := r.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("GetChunk: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	chunk := &domain.Chunk{BoardID: boardID, CX: cx, CY: cy, Bounds: bounds}
+	err = tx.QueryRowxContext(ctx,
+		`SELECT version FROM board_chunks WHERE board_id = $1 AND cx = $2 AND cy = $3`,
+		boardID, cx, cy,
+	).Scan(&chunk.Version)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("GetChunk: %w", err)
 	}
 
-	_, _ = r.db.ExecContext(ctx,
-		`INSERT INTO tile_events (tile_id, user_id, event_type) VALUES ($1, $2, 'claim')`,
-		tileID, userID,
-	)
+	chunk.Tiles = []*domain.Tile{}
+	err = tx.SelectContext(ctx, &chunk.Tiles, tilesInRectQuery, boardID, bounds.X, bounds.X+bounds.W, bounds.Y, bounds.Y+bounds.H)
+	if err != nil {
+		return nil, fmt.Errorf("GetChunk: %w", err)
+	}
+	return chunk, tx.Commit()
+}
 
-	return tile, nil
+func (r *TileRepo) hasAdjacentTile(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	boardID string,
+	tileID int,
+	userID uuid.UUID,
+) (bool, error) {
+	var exists bool
+	query := `
+        SELECT EXISTS (
+            SELECT 1
+            FROM tiles t
+            JOIN tiles n ON n.board_id = t.board_id
+                        AND ABS(n.x - t.x) + ABS(n.y - t.y) = 1
+            WHERE t.board_id = $1
+              AND t.id = $2
+              AND n.owner_id = $3
+        )
+    `
+	if err := tx.QueryRowxContext(ctx, query, boardID, tileID, userID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("hasAdjacentTile: %w", err)
+	}
+	return exists, nil
 }
 
-func (r *TileRepo) CountTiles(ctx context.Context) (int, int, error) {
+func (r *TileRepo) CountTiles(ctx context.Context, boardID string) (int, int, error) {
 	var total int
 	var claimed int
-	query := `SELECT COUNT(*) AS total, COUNT(owner_id) AS claimed FROM tiles`
-	row := r.db.QueryRowxContext(ctx, query)
+	query := `SELECT COUNT(*) AS total, COUNT(owner_id) AS claimed FROM tiles WHERE board_id = $1`
+	row := r.db.QueryRowxContext(ctx, query, boardID)
 	if err := row.Scan(&total, &claimed); err != nil {
 		return 0, 0, fmt.Errorf("CountTiles: %w", err)
 	}
 	return total, claimed, nil
 }
 
-func (r *TileRepo) LastActivity(ctx context.Context) (*time.Time, error) {
-	var last sql.NullTime
-	query := `SELECT MAX(created_at) FROM tile_events`
-	if err := r.db.QueryRowxContext(ctx, query).Scan(&last); err != nil {
-		return nil, fmt.Errorf("LastActivity: %w", err)
+// OwnerCounts returns the number of tiles each user owns on boardID.
+func (r *TileRepo) OwnerCounts(ctx context.Context, boardID string) (map[uuid.UUID]int, error) {
+	rows := []struct {
+		OwnerID uuid.UUID `db:"owner_id"`
+		Count   int       `db:"tile_count"`
+	}{}
+	query := `
+        SELECT owner_id, COUNT(*) AS tile_count
+        FROM tiles
+        WHERE board_id = $1 AND owner_id IS NOT NULL
+        GROUP BY owner_id
+    `
+	if err := r.db.SelectContext(ctx, &rows, query, boardID); err != nil {
+		return nil, fmt.Errorf("OwnerCounts: %w", err)
 	}
-	if !last.Valid {
-		return nil, nil
+	counts := make(map[uuid.UUID]int, len(rows))
+	for _, row := range rows {
+		counts[row.OwnerID] = row.Count
 	}
-	return &last.Time, nil
+	return counts, nil
 }
 
-func (r *TileRepo) SeedTiles(ctx context.Context, gridWidth, gridHeight int) error {
+// TeamTerritory returns the number of tiles each team's members own on
+// boardID, most first. Ranks are left for the caller to fill in.
+func (r *TileRepo) TeamTerritory(ctx context.Context, boardID string) ([]domain.TeamLeaderboardEntry, error) {
+	entries := []domain.TeamLeaderboardEntry{}
 	query := `
-		INSERT INTO tiles (id, x, y)
-		SELECT
-			y * $1 + x AS id,
-			x,
-			y
-		FROM generate_series(0, $2 - 1) AS x,
-		     generate_series(0, $3 - 1) AS y
-		ON CONFLICT (id) DO NOTHING
-	`
-	_, err := r.db.ExecContext(ctx, query, gridWidth, gridWidth, gridHeight)
-	if err != nil {
-		return fmt.Errorf("SeedTiles: %w", err)
+        SELECT tm.id AS team_id, tm.name, tm.color, COUNT(*) AS tile_count
+        FROM tiles t
+        JOIN users u ON u.id = t.owner_id
+        JOIN teams tm ON tm.id = u.team_id
+        WHERE t.board_id = $1
+        GROUP BY tm.id, tm.name, tm.color
+        ORDER BY tile_count DESC, tm.name
+    `
+	if err := r.db.SelectContext(ctx, &entries, query, boardID); err != nil {
+		return nil, fmt.Errorf("TeamTerritory: %w", err)
 	}
-	return nil
+	return entries, nil
 }
 
-func (r *TileRepo) TileCount(ctx context.Context) (int, error) {
-	var count int
-	if err := r.db.QueryRowxContext(ctx, "SELECT COUNT(*) FROM tiles").Scan(&count); err != nil {
-		return 0, fmt.Errorf("TileCount: %w", err)
+func (r *TileRepo) LastActivity(ctx context.Context, boardID string) (*time.Time, error) {
+	var last sql.NullTime
+	query := `SELECT MAX(created_at) FROM tile_events WHERE board_id = $1`
+	if err := r.db.QueryRowxContext(ctx, query, boardID).Scan(&last); err != nil {
+		return nil, fmt.Errorf("LastActivity: %w", err)
+	}
+	if !last.Valid {
+		return nil, nil
 	}
-	return count, nil
+	return &last.Time, nil
 }
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/testenv"
+)
+
+func TestClaimTileCaptureRules(t *testing.T) {
+	db := testenv.Postgres(t)
+	repo := NewTileRepo(db)
+	// 3x3 board; tile ids are y*3+x, so 4 is the centre and 1 is above it.
+	board := newBoard(t, db, "capture", 3, 3)
+	alice, bob := newUser(t, db, "alice"), newUser(t, db, "bob")
+
+	capture := domain.CaptureRules{Enabled: true, ProtectionWindow: time.Minute}
+	adjacent := domain.CaptureRules{Enabled: true, RequireAdjacent: true}
+
+	type owned struct {
+		tile  int
+		owner *domain.User
+		age   time.Duration
+	}
+	tests := []struct {
+		name         string
+		rules        domain.CaptureRules
+		owned        []owned
+		claimer      *domain.User
+		tile         int
+		wantErr      error
+		wantPrevious *domain.User
+		wantEvent    string
+	}{
+		{"unclaimed tile", domain.CaptureRules{}, nil, bob, 4, nil, nil, "claim"},
+		{"owned tile without capture", domain.CaptureRules{}, []owned{{4, alice, time.Hour}}, bob, 4, domain.ErrTileAlreadyClaimed, nil, ""},
+		{"capture", capture, []owned{{4, alice, time.Hour}}, bob, 4, nil, alice, "capture"},
+		{"owner recaptures own tile", capture, []owned{{4, alice, time.Hour}}, alice, 4, domain.ErrTileAlreadyClaimed, nil, ""},
+		{"inside the protection window", capture, []owned{{4, alice, 10 * time.Second}}, bob, 4, domain.ErrTileProtected, nil, ""},
+		{"unclaimed tile with capture on", capture, nil, bob, 4, nil, nil, "claim"},
+		{"no adjacent tile", adjacent, []owned{{4, alice, time.Hour}, {0, bob, time.Hour}}, bob, 4, domain.ErrTileNotAdjacent, nil, ""},
+		{"adjacent tile", adjacent, []owned{{4, alice, time.Hour}, {1, bob, time.Hour}}, bob, 4, nil, alice, "capture"},
+		{"adjacent tile owned by someone else", adjacent, []owned{{4, alice, time.Hour}, {1, alice, time.Hour}}, bob, 4, domain.ErrTileNotAdjacent, nil, ""},
+		{"adjacency ignored for unclaimed tiles", adjacent, nil, bob, 4, nil, nil, "claim"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for id := 0; id < board.TileCount(); id++ {
+				setOwner(t, db, board.ID, id, nil, 0)
+			}
+			for _, o := range tt.owned {
+				setOwner(t, db, board.ID, o.tile, &o.owner.ID, o.age)
+			}
+
+			result, err := repo.ClaimTile(context.Background(), board.ID, tt.tile, tt.claimer.ID, tt.rules, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ClaimTile() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				owner, err := repo.TileOwner(context.Background(), board.ID, tt.tile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var want *uuid.UUID
+				for _, o := range tt.owned {
+					if o.tile == tt.tile {
+						want = &o.owner.ID
+					}
+				}
+				if (owner == nil) != (want == nil) || (owner != nil && *owner != *want) {
+					t.Fatalf("rejected claim changed the owner to %v", owner)
+				}
+				return
+			}
+
+			if result.Tile.OwnerID == nil || *result.Tile.OwnerID != tt.claimer.ID {
+				t.Fatalf("tile owner = %v, want %s", result.Tile.OwnerID, tt.claimer.ID)
+			}
+			if tt.wantPrevious == nil {
+				if result.PreviousOwnerID != nil || result.Captured() {
+					t.Fatalf("previous owner = %v, want none", result.PreviousOwnerID)
+				}
+			} else if result.PreviousOwnerID == nil || *result.PreviousOwnerID != tt.wantPrevious.ID {
+				t.Fatalf("previous owner = %v, want %s", result.PreviousOwnerID, tt.wantPrevious.ID)
+			}
+			if got := lastEventType(t, db, board.ID); got != tt.wantEvent {
+				t.Fatalf("event type = %q, want %q", got, tt.wantEvent)
+			}
+			if result.ChunkVersion < 1 {
+				t.Fatalf("chunk version = %d, want it bumped", result.ChunkVersion)
+			}
+		})
+	}
+}
+
+func TestTileOwner(t *testing.T) {
+	db := testenv.Postgres(t)
+	repo := NewTileRepo(db)
+	board := newBoard(t, db, "owner", 2, 2)
+	alice := newUser(t, db, "alice")
+	setOwner(t, db, board.ID, 3, &alice.ID, time.Hour)
+
+	if owner, err := repo.TileOwner(context.Background(), board.ID, 0); err != nil || owner != nil {
+		t.Fatalf("TileOwner(unclaimed) = %v, %v, want nil, nil", owner, err)
+	}
+	if owner, err := repo.TileOwner(context.Background(), board.ID, 3); err != nil || owner == nil || *owner != alice.ID {
+		t.Fatalf("TileOwner(claimed) = %v, %v, want %s", owner, err, alice.ID)
+	}
+	if _, err := repo.TileOwner(context.Background(), board.ID, 4); !errors.Is(err, domain.ErrTileInvalid) {
+		t.Fatalf("TileOwner(missing) error = %v, want %v", err, domain.ErrTileInvalid)
+	}
+}
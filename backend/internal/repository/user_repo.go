@@ -11,6 +11,8 @@ import (
 	"ownthegrid/internal/domain"
 )
 
+const userColumns = `id, username, color, team_id, role, banned_at, ban_reason, created_at, last_seen`
+
 type UserRepo struct {
 	db *sqlx.DB
 }
@@ -21,7 +23,7 @@ func NewUserRepo(db *sqlx.DB) *UserRepo {
 
 func (r *UserRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
 	user := &domain.User{}
-	query := `SELECT id, username, color, created_at, last_seen FROM users WHERE id = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
 	err := r.db.QueryRowxContext(ctx, query, id).StructScan(user)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -34,7 +36,7 @@ func (r *UserRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, err
 
 func (r *UserRepo) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
 	user := &domain.User{}
-	query := `SELECT id, username, color, created_at, last_seen FROM users WHERE username = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = $1`
 	err := r.db.QueryRowxContext(ctx, query, username).StructScan(user)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -45,16 +47,29 @@ func (r *UserRepo) GetByUsername(ctx context.Context, username string) (*domain.
 	return user, nil
 }
 
-func (r *UserRepo) Create(ctx context.Context, user *domain.User) (*domain.User, error) {
+// Create inserts user with an optional password hash and their recovery
+// codes, hashed, in one transaction.
+func (r *UserRepo) Create(ctx context.Context, user *domain.User, passwordHash *string, recoveryHashes []string) (*domain.User, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Create: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
 	created := &domain.User{}
 	query := `
-        INSERT INTO users (username, color)
-        VALUES ($1, $2)
-        RETURNING id, username, color, created_at, last_seen
-    `
-	if err := r.db.QueryRowxContext(ctx, query, user.Username, user.Color).StructScan(created); err != nil {
+        INSERT INTO users (username, color, password_hash)
+        VALUES ($1, $2, $3)
+        RETURNING ` + userColumns
+	if err := tx.QueryRowxContext(ctx, query, user.Username, user.Color, passwordHash).StructScan(created); err != nil {
 		return nil, fmt.Errorf("Create: %w", err)
 	}
+	if err := insertRecoveryCodes(ctx, tx, created.ID, recoveryHashes); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("Create commit: %w", err)
+	}
 	return created, nil
 }
 
@@ -70,7 +85,7 @@ func (r *UserRepo) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]*domain.Use
 	if len(ids) == 0 {
 		return []*domain.User{}, nil
 	}
-	query, args, err := sqlx.In(`SELECT id, username, color, created_at, last_seen FROM users WHERE id IN (?)`, ids)
+	query, args, err := sqlx.In(`SELECT `+userColumns+` FROM users WHERE id IN (?)`, ids)
 	if err != nil {
 		return nil, fmt.Errorf("GetByIDs: %w", err)
 	}
@@ -82,33 +97,54 @@ func (r *UserRepo) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]*domain.Use
 	return users, nil
 }
 
-type LeaderboardEntry struct {
-	UserID    uuid.UUID `db:"id" json:"userId"`
-	Username  string    `db:"username" json:"username"`
-	Color     string    `db:"color" json:"color"`
-	TileCount int       `db:"tile_count" json:"tileCount"`
-	Rank      int       `json:"rank"`
-}
+// SetBan bans the user with reason, or lifts their ban when reason is nil,
+// and returns the updated user. It returns nil if there is no such user.
+// audit, if not nil, is recorded in the same transaction.
+func (r *UserRepo) SetBan(ctx context.Context, id uuid.UUID, reason *string, audit *domain.AuditEntry) (*domain.User, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("SetBan: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
 
-func (r *UserRepo) GetLeaderboard(ctx context.Context, limit int) ([]LeaderboardEntry, error) {
-	entries := []LeaderboardEntry{}
+	user := &domain.User{}
 	query := `
-        SELECT
-            u.id, u.username, u.color,
-            COUNT(t.id) AS tile_count
-        FROM users u
-        LEFT JOIN tiles t ON t.owner_id = u.id
-        GROUP BY u.id
-        ORDER BY tile_count DESC
-        LIMIT $1
-    `
-	if err := r.db.SelectContext(ctx, &entries, query, limit); err != nil {
-		return nil, fmt.Errorf("GetLeaderboard: %w", err)
-	}
-	for i := range entries {
-		entries[i].Rank = i + 1
-	}
-	return entries, nil
+        UPDATE users
+        SET banned_at = CASE WHEN $2::text IS NULL THEN NULL ELSE NOW() END,
+            ban_reason = $2
+        WHERE id = $1
+        RETURNING ` + userColumns
+	err = tx.QueryRowxContext(ctx, query, id, reason).StructScan(user)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("SetBan: %w", err)
+	}
+	if audit != nil {
+		if err := recordAudit(ctx, tx, audit, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("SetBan commit: %w", err)
+	}
+	return user, nil
+}
+
+// SetRole gives the user called username role and returns them. It returns
+// nil if there is no such user.
+func (r *UserRepo) SetRole(ctx context.Context, username string, role string) (*domain.User, error) {
+	user := &domain.User{}
+	query := `UPDATE users SET role = $2 WHERE username = $1 RETURNING ` + userColumns
+	err := r.db.QueryRowxContext(ctx, query, username, role).StructScan(user)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("SetRole: %w", err)
+	}
+	return user, nil
 }
 
 func (r *UserRepo) CountUsers(ctx context.Context) (int, error) {
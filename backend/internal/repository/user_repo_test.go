@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/testenv"
+)
+
+func TestSetBan(t *testing.T) {
+	db := testenv.Postgres(t)
+	repo := NewUserRepo(db)
+	admin, mallory := newUser(t, db, "admin"), newUser(t, db, "mallory")
+	ctx := context.Background()
+	reason := "griefing"
+	audit := func(action string) *domain.AuditEntry {
+		target := mallory.ID.String()
+		return &domain.AuditEntry{AdminID: &admin.ID, Action: action, Target: &target}
+	}
+	auditCount := func() int {
+		t.Helper()
+		var n int
+		if err := db.Get(&n, `SELECT COUNT(*) FROM admin_audit_log`); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	tests := []struct {
+		name       string
+		userID     uuid.UUID
+		reason     *string
+		audit      *domain.AuditEntry
+		wantErr    bool
+		wantNil    bool
+		wantBanned bool
+		wantAudits int
+	}{
+		// The action column takes 32 characters, so this entry can't be
+		// written and the ban has to roll back with it.
+		{"audit entry fails", mallory.ID, &reason, audit(strings.Repeat("x", 33)), true, true, false, 0},
+		{"ban", mallory.ID, &reason, audit(domain.AuditBanUser), false, false, true, 1},
+		{"unknown user", uuid.New(), &reason, audit(domain.AuditBanUser), false, true, true, 1},
+		{"unban", mallory.ID, nil, audit(domain.AuditUnbanUser), false, false, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := repo.SetBan(ctx, tt.userID, tt.reason, tt.audit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetBan() error = %v", err)
+			}
+			if (user == nil) != tt.wantNil {
+				t.Fatalf("SetBan() = %+v", user)
+			}
+			stored, err := repo.GetByID(ctx, mallory.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Banned() != tt.wantBanned {
+				t.Fatalf("banned = %v, want %v", stored.Banned(), tt.wantBanned)
+			}
+			if tt.wantBanned && (stored.BanReason == nil || *stored.BanReason != reason) {
+				t.Fatalf("ban reason = %v, want %q", stored.BanReason, reason)
+			}
+			if n := auditCount(); n != tt.wantAudits {
+				t.Fatalf("%d audit entries, want %d", n, tt.wantAudits)
+			}
+		})
+	}
+}
+
+func TestClaimTileBanned(t *testing.T) {
+	db := testenv.Postgres(t)
+	board := newBoard(t, db, "bans", 2, 2)
+	mallory := newUser(t, db, "mallory")
+	reason := "griefing"
+	if _, err := NewUserRepo(db).SetBan(context.Background(), mallory.ID, &reason, nil); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewTileRepo(db).ClaimTile(context.Background(), board.ID, 0, mallory.ID, domain.CaptureRules{}, nil)
+	if !errors.Is(err, domain.ErrUserBanned) {
+		t.Fatalf("ClaimTile() by a banned user = %v, want %v", err, domain.ErrUserBanned)
+	}
+}
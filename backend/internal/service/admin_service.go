@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+)
+
+const maxAnnouncementLength = 500
+
+var (
+	ErrBanSelf             = errors.New("you cannot ban yourself")
+	ErrAnnouncementInvalid = errors.New("announcement must be 1-500 characters")
+)
+
+// AdminService carries out moderation actions and records each one in the
+// audit log, in the same transaction as the action where there is one. An
+// action whose entry can't be written fails.
+type AdminService struct {
+	users       *repository.UserRepo
+	tiles       *TileService
+	boards      *BoardService
+	leaderboard *LeaderboardService
+	audit       *repository.AuditRepo
+}
+
+func NewAdminService(
+	users *repository.UserRepo,
+	tiles *TileService,
+	boards *BoardService,
+	leaderboard *LeaderboardService,
+	audit *repository.AuditRepo,
+) *AdminService {
+	return &AdminService{users: users, tiles: tiles, boards: boards, leaderboard: leaderboard, audit: audit}
+}
+
+// UnclaimTile frees tileID on boardID and returns the one-tile region that
+// was reset, along with how many tiles were cleared (0 or 1).
+func (s *AdminService) UnclaimTile(ctx context.Context, adminID uuid.UUID, boardID string, tileID int) (domain.Viewport, int, error) {
+	board, err := s.boards.Get(ctx, boardID)
+	if err != nil {
+		return domain.Viewport{}, 0, err
+	}
+	if !board.Contains(tileID) {
+		return domain.Viewport{}, 0, domain.ErrTileInvalid
+	}
+	audit, err := newAuditEntry(adminID, domain.AuditUnclaimTile, board.ID, strconv.Itoa(tileID), nil)
+	if err != nil {
+		return domain.Viewport{}, 0, err
+	}
+	vp := domain.Viewport{X: tileID % board.Width, Y: tileID / board.Width, W: 1, H: 1}
+	return s.resetRegion(ctx, board.ID, vp, audit)
+}
+
+// ReassignTile hands tileID to userID regardless of who holds it.
+func (s *AdminService) ReassignTile(ctx context.Context, adminID uuid.UUID, boardID string, tileID int, userID uuid.UUID) (*domain.ClaimResult, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	audit, err := newAuditEntry(adminID, domain.AuditReassignTile, boardID, strconv.Itoa(tileID), map[string]interface{}{
+		"userId": userID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.tiles.Reassign(ctx, boardID, tileID, userID, audit)
+}
+
+// Ban stops userID from signing in, connecting or claiming until unbanned.
+// Their open connections are left for the caller to close.
+func (s *AdminService) Ban(ctx context.Context, adminID uuid.UUID, userID uuid.UUID, reason string) (*domain.User, error) {
+	if userID == adminID {
+		return nil, ErrBanSelf
+	}
+	reason = strings.TrimSpace(reason)
+	audit, err := newAuditEntry(adminID, domain.AuditBanUser, "", userID.String(), map[string]interface{}{
+		"reason": reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.SetBan(ctx, userID, &reason, audit)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (s *AdminService) Unban(ctx context.Context, adminID uuid.UUID, userID uuid.UUID) (*domain.User, error) {
+	audit, err := newAuditEntry(adminID, domain.AuditUnbanUser, "", userID.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.SetBan(ctx, userID, nil, audit)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+// Disconnect records that userID is being kicked. Closing their connections
+// is up to the caller, once the record is written.
+func (s *AdminService) Disconnect(ctx context.Context, adminID uuid.UUID, userID uuid.UUID) (*domain.User, error) {
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	if err := s.record(ctx, adminID, domain.AuditDisconnect, "", userID.String(), nil); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ResetRegion unclaims every tile inside vp on boardID. It returns the
+// rectangle as clamped to the board and how many tiles were cleared.
+func (s *AdminService) ResetRegion(ctx context.Context, adminID uuid.UUID, boardID string, vp domain.Viewport) (domain.Viewport, int, error) {
+	board, err := s.boards.Get(ctx, boardID)
+	if err != nil {
+		return domain.Viewport{}, 0, err
+	}
+	audit, err := newAuditEntry(adminID, domain.AuditResetRegion, board.ID, "", nil)
+	if err != nil {
+		return domain.Viewport{}, 0, err
+	}
+	return s.resetRegion(ctx, board.ID, vp, audit)
+}
+
+// resetRegion clears vp and rebuilds the board's leaderboards, which can't
+// be adjusted tile by tile without knowing every cleared tile's owner.
+func (s *AdminService) resetRegion(ctx context.Context, boardID string, vp domain.Viewport, audit *domain.AuditEntry) (domain.Viewport, int, error) {
+	vp, count, err := s.tiles.ResetRegion(ctx, boardID, vp, audit)
+	if err != nil {
+		return domain.Viewport{}, 0, err
+	}
+	if count > 0 {
+		if _, err := s.leaderboard.Reconcile(ctx, boardID, true); err != nil {
+			log.Printf("Admin: leaderboard rebuild after reset failed for board %s: %v", boardID, err)
+		}
+	}
+	return vp, count, nil
+}
+
+// Announce validates a system announcement and returns the boards it should
+// go to: boardID alone, or every board when boardID is empty.
+func (s *AdminService) Announce(ctx context.Context, adminID uuid.UUID, boardID string, message string) ([]string, string, error) {
+	message = strings.TrimSpace(message)
+	if message == "" || len(message) > maxAnnouncementLength {
+		return nil, "", ErrAnnouncementInvalid
+	}
+
+	var boardIDs []string
+	if boardID != "" {
+		board, err := s.boards.Get(ctx, boardID)
+		if err != nil {
+			return nil, "", err
+		}
+		boardIDs = []string{board.ID}
+	} else {
+		boards, err := s.boards.List(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, board := range boards {
+			boardIDs = append(boardIDs, board.ID)
+		}
+	}
+	err := s.record(ctx, adminID, domain.AuditAnnouncement, boardID, "", map[string]interface{}{
+		"message": message,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return boardIDs, message, nil
+}
+
+// AuditLog returns up to limit audit entries older than beforeID, newest
+// first.
+func (s *AdminService) AuditLog(ctx context.Context, beforeID int64, limit int) ([]*domain.AuditEntry, error) {
+	return s.audit.List(ctx, beforeID, limit)
+}
+
+// record writes an audit entry for an action that changes nothing in
+// Postgres, before the caller carries it out.
+func (s *AdminService) record(
+	ctx context.Context,
+	adminID uuid.UUID,
+	action string,
+	boardID string,
+	target string,
+	details map[string]interface{},
+) error {
+	entry, err := newAuditEntry(adminID, action, boardID, target, details)
+	if err != nil {
+		return err
+	}
+	return s.audit.Record(ctx, entry)
+}
+
+func newAuditEntry(adminID uuid.UUID, action string, boardID string, target string, details map[string]interface{}) (*domain.AuditEntry, error) {
+	entry := &domain.AuditEntry{AdminID: &adminID, Action: action}
+	if boardID != "" {
+		entry.BoardID = &boardID
+	}
+	if target != "" {
+		entry.Target = &target
+	}
+	if details != nil {
+		raw, err := json.Marshal(details)
+		if err != nil {
+			return nil, fmt.Errorf("audit details: %w", err)
+		}
+		entry.Details = raw
+	}
+	return entry, nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+)
+
+var (
+	ErrAPIKeyInvalid = errors.New("name must be 1-64 characters and scopes any of read-board, claim and admin")
+	ErrAPIKeyRate    = errors.New("rate limit must be positive and within the server maximum")
+	ErrAPIKeyLimit   = errors.New("at most 10 api keys per user")
+)
+
+const (
+	apiKeyPrefix      = "otg_"
+	maxAPIKeysPerUser = 10
+	apiKeyWindow      = time.Minute
+)
+
+// IsAPIKey tells API keys apart from JWTs by their prefix.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// CreateAPIKey gives userID a new key named name with scopes, limited to
+// ratePerMinute requests, or the server maximum when zero. Only admins can
+// grant the admin scope. The returned key carries its secret, which is never
+// shown again.
+func (s *UserService) CreateAPIKey(ctx context.Context, userID uuid.UUID, name string, scopes []string, ratePerMinute int) (*domain.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 || len(scopes) == 0 {
+		return nil, ErrAPIKeyInvalid
+	}
+	granted := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !domain.ValidScope(scope) {
+			return nil, ErrAPIKeyInvalid
+		}
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	if ratePerMinute == 0 {
+		ratePerMinute = s.apiKeyRate
+	}
+	if ratePerMinute < 0 || ratePerMinute > s.apiKeyRate {
+		return nil, ErrAPIKeyRate
+	}
+
+	user, err := s.repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	if slices.Contains(granted, domain.ScopeAdmin) && user.Role != domain.RoleAdmin {
+		return nil, domain.ErrScopeDenied
+	}
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	secret := apiKeyPrefix + token
+	created, err := s.apiKeys.Create(ctx, &domain.APIKey{
+		UserID:        userID,
+		Name:          name,
+		Prefix:        secret[:len(apiKeyPrefix)+6],
+		Scopes:        granted,
+		RatePerMinute: ratePerMinute,
+	}, hashToken(secret), maxAPIKeysPerUser)
+	if err != nil {
+		return nil, err
+	}
+	if created == nil {
+		return nil, ErrAPIKeyLimit
+	}
+	created.Key = secret
+	return created, nil
+}
+
+func (s *UserService) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]domain.APIKey, error) {
+	return s.apiKeys.ListByUser(ctx, userID)
+}
+
+// RevokeAPIKey revokes key id of userID; requests with it fail from then on.
+func (s *UserService) RevokeAPIKey(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	revoked, err := s.apiKeys.Revoke(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return domain.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// validateAPIKey resolves secret to claims for its owner and counts the
+// request against the key's rate limit.
+func (s *UserService) validateAPIKey(ctx context.Context, secret string) (*Claims, error) {
+	key, err := s.apiKeys.GetByHash(ctx, hashToken(secret))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, domain.ErrTokenInvalid
+	}
+	user, err := s.repo.GetByID(ctx, key.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrTokenInvalid
+	}
+	if err := s.allowWindow(ctx, "ratelimit:apikey:"+key.ID.String(), key.RatePerMinute, apiKeyWindow); err != nil {
+		return nil, err
+	}
+	if err := s.apiKeys.Touch(ctx, key.ID); err != nil {
+		log.Printf("Touch api key %s failed: %v", key.ID, err)
+	}
+	return &Claims{
+		UserID:   user.ID.String(),
+		Username: user.Username,
+		Role:     user.Role,
+		APIKeyID: key.ID.String(),
+		Scopes:   key.Scopes,
+	}, nil
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"testing"
+
+	"ownthegrid/internal/domain"
+)
+
+func TestIsAPIKey(t *testing.T) {
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{"otg_abc", true},
+		{"otg_", true},
+		{"eyJhbGciOiJIUzI1NiJ9.e30.sig", false},
+		{"OTG_abc", false},
+		{"otgabc", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsAPIKey(tt.token); got != tt.want {
+			t.Errorf("IsAPIKey(%q) = %v, want %v", tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestClaimsHasScope(t *testing.T) {
+	userToken := &Claims{UserID: "u"}
+	readOnly := &Claims{UserID: "u", APIKeyID: "k", Scopes: []string{domain.ScopeReadBoard}}
+	claimer := &Claims{UserID: "u", APIKeyID: "k", Scopes: []string{domain.ScopeReadBoard, domain.ScopeClaim}}
+	noScopes := &Claims{UserID: "u", APIKeyID: "k"}
+
+	tests := []struct {
+		name   string
+		claims *Claims
+		scope  string
+		want   bool
+	}{
+		{"user token reads", userToken, domain.ScopeReadBoard, true},
+		{"user token claims", userToken, domain.ScopeClaim, true},
+		{"user token administers", userToken, domain.ScopeAdmin, true},
+		{"read-only key reads", readOnly, domain.ScopeReadBoard, true},
+		{"read-only key claims", readOnly, domain.ScopeClaim, false},
+		{"read-only key administers", readOnly, domain.ScopeAdmin, false},
+		{"claim key claims", claimer, domain.ScopeClaim, true},
+		{"claim key administers", claimer, domain.ScopeAdmin, false},
+		{"key without scopes", noScopes, domain.ScopeReadBoard, false},
+		{"unknown scope", claimer, "write-board", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.claims.HasScope(tt.scope); got != tt.want {
+				t.Fatalf("HasScope(%q) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  bool
+	}{
+		{domain.ScopeReadBoard, true},
+		{domain.ScopeClaim, true},
+		{domain.ScopeAdmin, true},
+		{"Admin", false},
+		{"read", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := domain.ValidScope(tt.scope); got != tt.want {
+			t.Errorf("ValidScope(%q) = %v, want %v", tt.scope, got, tt.want)
+		}
+	}
+}
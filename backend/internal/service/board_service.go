@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+)
+
+var boardIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+type BoardService struct {
+	repo  *repository.BoardRepo
+	cache sync.Map
+}
+
+func NewBoardService(repo *repository.BoardRepo) *BoardService {
+	return &BoardService{repo: repo}
+}
+
+func (s *BoardService) Get(ctx context.Context, id string) (*domain.Board, error) {
+	if cached, ok := s.cache.Load(id); ok {
+		return cached.(*domain.Board), nil
+	}
+	board, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if board == nil {
+		return nil, domain.ErrBoardNotFound
+	}
+	s.cache.Store(id, board)
+	return board, nil
+}
+
+func (s *BoardService) List(ctx context.Context) ([]*domain.Board, error) {
+	return s.repo.List(ctx)
+}
+
+// Create validates board, filling in its name from its id if it has none,
+// and stores it with every tile seeded.
+func (s *BoardService) Create(ctx context.Context, board *domain.Board, createdBy uuid.UUID) (*domain.Board, error) {
+	if err := normalizeBoard(board); err != nil {
+		return nil, err
+	}
+	board.CreatedBy = &createdBy
+
+	created, err := s.repo.Create(ctx, board)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, domain.ErrBoardExists
+		}
+		return nil, err
+	}
+	s.cache.Store(created.ID, created)
+	return created, nil
+}
+
+// normalizeBoard trims board's id and name, defaults the name to the id and
+// checks both and the dimensions.
+func normalizeBoard(board *domain.Board) error {
+	board.ID = strings.TrimSpace(board.ID)
+	board.Name = strings.TrimSpace(board.Name)
+	if !boardIDPattern.MatchString(board.ID) {
+		return domain.ErrBoardIDInvalid
+	}
+	if board.Name == "" {
+		board.Name = board.ID
+	}
+	if len(board.Name) > 64 {
+		return domain.ErrBoardNameInvalid
+	}
+	if board.Width <= 0 || board.Height <= 0 || board.Width > domain.MaxBoardDimension || board.Height > domain.MaxBoardDimension {
+		return domain.ErrBoardSizeInvalid
+	}
+	return nil
+}
+
+// EnsureDefault creates the default board on first start and seeds any
+// tiles missing from it.
+func (s *BoardService) EnsureDefault(ctx context.Context, width, height int) (*domain.Board, error) {
+	board, err := s.repo.GetByID(ctx, domain.DefaultBoardID)
+	if err != nil {
+		return nil, fmt.Errorf("EnsureDefault: %w", err)
+	}
+	if board == nil {
+		board, err = s.repo.Create(ctx, &domain.Board{
+			ID:     domain.DefaultBoardID,
+			Name:   "Default",
+			Width:  width,
+			Height: height,
+		})
+		if err != nil && !isUniqueViolation(err) {
+			return nil, fmt.Errorf("EnsureDefault: %w", err)
+		}
+		if err != nil {
+			return s.Get(ctx, domain.DefaultBoardID)
+		}
+	} else {
+		count, err := s.repo.TileCount(ctx, board.ID)
+		if err != nil {
+			return nil, fmt.Errorf("EnsureDefault: %w", err)
+		}
+		if count < board.TileCount() {
+			if err := s.repo.SeedTiles(ctx, board); err != nil {
+				return nil, fmt.Errorf("EnsureDefault: %w", err)
+			}
+		}
+	}
+	s.cache.Store(board.ID, board)
+	return board, nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+	"ownthegrid/internal/testenv"
+)
+
+func TestNormalizeBoard(t *testing.T) {
+	tests := []struct {
+		name     string
+		board    domain.Board
+		wantErr  error
+		wantID   string
+		wantName string
+	}{
+		{"valid", domain.Board{ID: "arena-2", Name: "Arena", Width: 10, Height: 20}, nil, "arena-2", "Arena"},
+		{"trimmed", domain.Board{ID: " arena ", Name: " Arena ", Width: 1, Height: 1}, nil, "arena", "Arena"},
+		{"name defaults to id", domain.Board{ID: "arena", Width: 1, Height: 1}, nil, "arena", "arena"},
+		{"largest", domain.Board{ID: "big", Width: domain.MaxBoardDimension, Height: domain.MaxBoardDimension}, nil, "big", "big"},
+		{"empty id", domain.Board{Width: 1, Height: 1}, domain.ErrBoardIDInvalid, "", ""},
+		{"uppercase id", domain.Board{ID: "Arena", Width: 1, Height: 1}, domain.ErrBoardIDInvalid, "", ""},
+		{"id starting with a dash", domain.Board{ID: "-arena", Width: 1, Height: 1}, domain.ErrBoardIDInvalid, "", ""},
+		{"long id", domain.Board{ID: strings.Repeat("a", 33), Width: 1, Height: 1}, domain.ErrBoardIDInvalid, "", ""},
+		{"long name", domain.Board{ID: "arena", Name: strings.Repeat("n", 65), Width: 1, Height: 1}, domain.ErrBoardNameInvalid, "", ""},
+		{"zero width", domain.Board{ID: "arena", Width: 0, Height: 1}, domain.ErrBoardSizeInvalid, "", ""},
+		{"negative height", domain.Board{ID: "arena", Width: 1, Height: -1}, domain.ErrBoardSizeInvalid, "", ""},
+		{"too wide", domain.Board{ID: "arena", Width: domain.MaxBoardDimension + 1, Height: 1}, domain.ErrBoardSizeInvalid, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board := tt.board
+			err := normalizeBoard(&board)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("normalizeBoard() = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (board.ID != tt.wantID || board.Name != tt.wantName) {
+				t.Fatalf("normalized to %q %q, want %q %q", board.ID, board.Name, tt.wantID, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestBoardServiceCreate(t *testing.T) {
+	db := testenv.Postgres(t)
+	repo := repository.NewBoardRepo(db)
+	boards := NewBoardService(repo)
+	alice := newTestUser(t, db, "alice")
+	ctx := context.Background()
+
+	board := newTestBoard(t, boards, "arena", 7, 3, alice.ID)
+	if board.Name != "arena" || board.CreatedBy == nil || *board.CreatedBy != alice.ID {
+		t.Fatalf("Create() = %+v", board)
+	}
+	if count, err := repo.TileCount(ctx, "arena"); err != nil || count != 21 {
+		t.Fatalf("TileCount() = %d, %v, want 21", count, err)
+	}
+	if _, err := boards.Create(ctx, &domain.Board{ID: "arena", Width: 1, Height: 1}, alice.ID); !errors.Is(err, domain.ErrBoardExists) {
+		t.Fatalf("Create() of a taken id = %v, want %v", err, domain.ErrBoardExists)
+	}
+	if _, err := boards.Create(ctx, &domain.Board{ID: "Arena!", Width: 1, Height: 1}, alice.ID); !errors.Is(err, domain.ErrBoardIDInvalid) {
+		t.Fatalf("Create() of a bad id = %v, want %v", err, domain.ErrBoardIDInvalid)
+	}
+	if _, err := boards.Get(ctx, "missing"); !errors.Is(err, domain.ErrBoardNotFound) {
+		t.Fatalf("Get() of a missing board = %v, want %v", err, domain.ErrBoardNotFound)
+	}
+}
+
+func TestEnsureDefault(t *testing.T) {
+	db := testenv.Postgres(t)
+	repo := repository.NewBoardRepo(db)
+	ctx := context.Background()
+
+	board, err := NewBoardService(repo).EnsureDefault(ctx, 5, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if board.ID != domain.DefaultBoardID || board.Width != 5 || board.Height != 4 {
+		t.Fatalf("EnsureDefault() = %+v", board)
+	}
+
+	// A later start seeds tiles that have gone missing and keeps the
+	// board's size even if the configured one changed.
+	if _, err := db.Exec(`DELETE FROM tiles WHERE board_id = $1 AND id >= 10`, domain.DefaultBoardID); err != nil {
+		t.Fatal(err)
+	}
+	board, err = NewBoardService(repo).EnsureDefault(ctx, 50, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if board.Width != 5 || board.Height != 4 {
+		t.Fatalf("EnsureDefault() resized the board to %dx%d", board.Width, board.Height)
+	}
+	if count, err := repo.TileCount(ctx, domain.DefaultBoardID); err != nil || count != 20 {
+		t.Fatalf("TileCount() = %d, %v, want 20", count, err)
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"ownthegrid/internal/domain"
+)
+
+// claimLimitScript enforces a per-user cooldown and token bucket atomically.
+// KEYS: bucket hash, cooldown key. ARGV: rate/s, burst, cost, cooldown ms, force.
+// Returns {allowed, retryAfterMs}. With force=1 the cost is always deducted,
+// letting the bucket go into debt, and the cooldown is left untouched.
+var claimLimitScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local cooldown = tonumber(ARGV[4])
+local force = ARGV[5] == "1"
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+if not force and cooldown > 0 then
+	local remaining = redis.call("PTTL", KEYS[2])
+	if remaining > 0 then
+		return {0, remaining}
+	end
+end
+
+if rate > 0 then
+	local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+	local tokens = tonumber(state[1]) or burst
+	local ts = tonumber(state[2]) or now
+	tokens = math.min(burst, tokens + (now - ts) * rate / 1000)
+	if not force and tokens < cost then
+		return {0, math.ceil((cost - tokens) * 1000 / rate)}
+	end
+	tokens = tokens - cost
+	redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+	redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1000)
+end
+
+if not force and cooldown > 0 then
+	redis.call("SET", KEYS[2], 1, "PX", cooldown)
+end
+
+return {1, 0}
+`)
+
+// claimRefundScript hands tokens back to a bucket, never past its burst. A
+// bucket that has already expired is full, so there is nothing to do.
+// KEYS: bucket hash. ARGV: rate/s, burst, tokens.
+var claimRefundScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local refund = tonumber(ARGV[3])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+if not state[1] then
+	return 0
+end
+
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + (now - ts) * rate / 1000 + refund)
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((burst - tokens) * 1000 / rate) + 1000)
+return 1
+`)
+
+type ClaimLimiter struct {
+	redis    RedisStore
+	rate     int
+	burst    int
+	cooldown time.Duration
+}
+
+func NewClaimLimiter(redis RedisStore, ratePerSecond int, burst int, cooldown time.Duration) *ClaimLimiter {
+	return &ClaimLimiter{
+		redis:    redis,
+		rate:     ratePerSecond,
+		burst:    burst,
+		cooldown: cooldown,
+	}
+}
+
+func (l *ClaimLimiter) enabled() bool {
+	return l != nil && (l.rate > 0 || l.cooldown > 0)
+}
+
+// Allow takes cost tokens for userID or returns a *domain.RateLimitError
+// carrying how long the caller has to wait.
+func (l *ClaimLimiter) Allow(ctx context.Context, userID uuid.UUID, cost int) error {
+	if !l.enabled() {
+		return nil
+	}
+	allowed, retryAfter, err := l.run(ctx, userID, cost, false)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return &domain.RateLimitError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Charge deducts cost tokens even if the bucket runs into debt.
+func (l *ClaimLimiter) Charge(ctx context.Context, userID uuid.UUID, cost int) error {
+	if !l.enabled() || cost <= 0 {
+		return nil
+	}
+	_, _, err := l.run(ctx, userID, cost, true)
+	return err
+}
+
+// Refund gives back cost tokens taken for a claim that was then rejected.
+// The cooldown stays, so rejected claims are still paced.
+func (l *ClaimLimiter) Refund(ctx context.Context, userID uuid.UUID, cost int) error {
+	if l == nil || l.rate <= 0 || cost <= 0 {
+		return nil
+	}
+	_, err := l.redis.RunScript(ctx, claimRefundScript, []string{bucketKey(userID)}, l.rate, l.burst, cost)
+	if err != nil {
+		return fmt.Errorf("claim limiter refund: %w", err)
+	}
+	return nil
+}
+
+func (l *ClaimLimiter) run(ctx context.Context, userID uuid.UUID, cost int, force bool) (bool, time.Duration, error) {
+	keys := []string{bucketKey(userID), "cooldown:claim:" + userID.String()}
+	forceArg := "0"
+	if force {
+		forceArg = "1"
+	}
+	raw, err := l.redis.RunScript(ctx, claimLimitScript, keys,
+		l.rate, l.burst, cost, l.cooldown.Milliseconds(), forceArg)
+	if err != nil {
+		return false, 0, fmt.Errorf("claim limiter: %w", err)
+	}
+	values, ok := raw.([]interface{})
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("claim limiter: unexpected reply %v", raw)
+	}
+	allowed, _ := values[0].(int64)
+	retryMs, _ := values[1].(int64)
+	return allowed == 1, time.Duration(retryMs) * time.Millisecond, nil
+}
+
+func bucketKey(userID uuid.UUID) string {
+	return "ratelimit:claim:" + userID.String()
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/testenv"
+)
+
+// retryAfter returns how long Allow asks the caller to wait, or 0 if it let
+// the claim through.
+func retryAfter(t *testing.T, l *ClaimLimiter, userID uuid.UUID, cost int) time.Duration {
+	t.Helper()
+	err := l.Allow(context.Background(), userID, cost)
+	if err == nil {
+		return 0
+	}
+	var rateErr *domain.RateLimitError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("Allow() = %v, want nil or a rate limit error", err)
+	}
+	return rateErr.RetryAfter
+}
+
+func TestClaimLimiter(t *testing.T) {
+	redis := NewRedisStore(testenv.Redis(t))
+	ctx := context.Background()
+
+	type step struct {
+		action string // allow, charge or refund
+		cost   int
+		// For allow: the retry window, inclusive, with 0 meaning allowed.
+		minRetry, maxRetry time.Duration
+	}
+	tests := []struct {
+		name     string
+		rate     int
+		burst    int
+		cooldown time.Duration
+		steps    []step
+	}{
+		{"disabled", 0, 0, 0, []step{
+			{"allow", 1, 0, 0}, {"allow", 100, 0, 0},
+		}},
+		{"burst then refill wait", 1, 2, 0, []step{
+			{"allow", 1, 0, 0}, {"allow", 1, 0, 0}, {"allow", 1, 900 * time.Millisecond, time.Second},
+		}},
+		{"cost over what is left", 1, 3, 0, []step{
+			{"allow", 2, 0, 0}, {"allow", 3, 1900 * time.Millisecond, 2 * time.Second}, {"allow", 1, 0, 0},
+		}},
+		{"cooldown", 0, 0, 500 * time.Millisecond, []step{
+			{"allow", 1, 0, 0}, {"allow", 1, 400 * time.Millisecond, 500 * time.Millisecond},
+		}},
+		{"cooldown checked before the bucket", 1, 5, 500 * time.Millisecond, []step{
+			{"allow", 5, 0, 0}, {"allow", 1, 400 * time.Millisecond, 500 * time.Millisecond},
+		}},
+		{"charge runs into debt", 1, 2, 0, []step{
+			{"charge", 4, 0, 0}, {"allow", 1, 2900 * time.Millisecond, 3 * time.Second},
+		}},
+		{"refund", 1, 3, 0, []step{
+			{"allow", 3, 0, 0}, {"refund", 3, 0, 0}, {"allow", 3, 0, 0},
+		}},
+		{"refund stops at the burst", 1, 3, 0, []step{
+			{"allow", 1, 0, 0}, {"refund", 5, 0, 0}, {"allow", 3, 0, 0}, {"allow", 1, 900 * time.Millisecond, time.Second},
+		}},
+		{"refund keeps the cooldown", 1, 3, 500 * time.Millisecond, []step{
+			{"allow", 1, 0, 0}, {"refund", 1, 0, 0}, {"allow", 1, 400 * time.Millisecond, 500 * time.Millisecond},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewClaimLimiter(redis, tt.rate, tt.burst, tt.cooldown)
+			userID := uuid.New()
+			for i, s := range tt.steps {
+				switch s.action {
+				case "allow":
+					got := retryAfter(t, l, userID, s.cost)
+					if got < s.minRetry || got > s.maxRetry {
+						t.Fatalf("step %d: retry after %v, want between %v and %v", i, got, s.minRetry, s.maxRetry)
+					}
+				case "charge":
+					if err := l.Charge(ctx, userID, s.cost); err != nil {
+						t.Fatalf("step %d: Charge() = %v", i, err)
+					}
+				case "refund":
+					if err := l.Refund(ctx, userID, s.cost); err != nil {
+						t.Fatalf("step %d: Refund() = %v", i, err)
+					}
+				}
+			}
+		})
+	}
+}
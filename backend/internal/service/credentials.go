@@ -0,0 +1,462 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/crypto/argon2"
+
+	"ownthegrid/internal/domain"
+)
+
+var (
+	ErrPasswordInvalid = errors.New("password must be 8-128 characters")
+	// ErrReauthRequired is returned when changing the credentials of a user
+	// without a password from a session that wasn't started just now.
+	ErrReauthRequired = errors.New("sign in again to change your credentials")
+)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 128
+	recoveryCodeCount = 10
+
+	// Failures count per username and client IP together, so guessing at
+	// an account from one address only shuts out that address, never the
+	// account's owner elsewhere. The per-IP limit caps the guesses one
+	// address spreads over many usernames; an attacker with many addresses
+	// still gets authFailureLimit guesses per account from each.
+	authFailureLimit   = 10
+	authFailureIPLimit = 50
+	authAttemptWindow  = 15 * time.Minute
+
+	registerIPLimit = 20
+	registerWindow  = time.Hour
+
+	// reauthWindow is how recently a session of a user without a password
+	// must have started for it to change their credentials.
+	reauthWindow = 10 * time.Minute
+)
+
+// argon2id parameters for new hashes. Stored hashes carry their own, so
+// these can be raised without invalidating existing passwords.
+const (
+	argonTime    = 1
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+	argonSaltLen = 16
+
+	// maxConcurrentHashes bounds the memory argon2 may take at once to this
+	// many times argonMemory KiB.
+	maxConcurrentHashes = 4
+)
+
+// fixedWindowScript counts a request against KEYS[1] within a window of
+// ARGV[1] ms. Returns {requests, retryAfterMs}.
+var fixedWindowScript = redis.NewScript(`
+local requests = redis.call("INCR", KEYS[1])
+if requests == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return {requests, redis.call("PTTL", KEYS[1])}
+`)
+
+// peekWindowScript returns {requests, retryAfterMs} of the window at
+// KEYS[1] without counting a request.
+var peekWindowScript = redis.NewScript(`
+local requests = tonumber(redis.call("GET", KEYS[1]) or "0")
+return {requests, redis.call("PTTL", KEYS[1])}
+`)
+
+// hashSlots holds one token per argon2 hash in progress.
+var hashSlots = make(chan struct{}, maxConcurrentHashes)
+
+// dummyPasswordHash is verified against when a login names an unknown user
+// or one without a password, so both take as long as a wrong password.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := hashNewPassword("ownthegrid-dummy-password")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// Login checks password against the one username registered with and
+// starts a new session for them. ip is the client's address, for rate
+// limiting.
+func (s *UserService) Login(ctx context.Context, username string, password string, ip string) (*domain.User, error) {
+	username = strings.TrimSpace(username)
+	if err := s.allowAuthAttempt(ctx, username, ip); err != nil {
+		return nil, err
+	}
+	user, err := s.repo.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	var hash *string
+	if user != nil {
+		if hash, err = s.credentials.PasswordHash(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	if hash == nil {
+		if _, err := checkPassword(ctx, dummyPasswordHash(), password); err != nil {
+			return nil, err
+		}
+		return nil, s.failAuthAttempt(ctx, username, ip)
+	}
+	ok, err := checkPassword(ctx, *hash, password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, s.failAuthAttempt(ctx, username, ip)
+	}
+	if user.Banned() {
+		return nil, domain.ErrUserBanned
+	}
+	if err := s.startSession(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Recover spends one of username's recovery codes, optionally sets a new
+// password, and signs them in afresh. Every other session of theirs is
+// revoked and returned so their connections can be closed.
+func (s *UserService) Recover(ctx context.Context, username string, code string, password string, ip string) (*domain.User, []domain.Session, error) {
+	username = strings.TrimSpace(username)
+	if password != "" {
+		if err := validatePassword(password); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := s.allowAuthAttempt(ctx, username, ip); err != nil {
+		return nil, nil, err
+	}
+	user, err := s.repo.GetByUsername(ctx, username)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, s.failAuthAttempt(ctx, username, ip)
+	}
+	if user.Banned() {
+		return nil, nil, domain.ErrUserBanned
+	}
+	var passwordHash string
+	if password != "" {
+		if passwordHash, err = hashPassword(ctx, password); err != nil {
+			return nil, nil, err
+		}
+	}
+	used, err := s.credentials.UseRecoveryCode(ctx, user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !used {
+		return nil, nil, s.failAuthAttempt(ctx, username, ip)
+	}
+
+	if passwordHash != "" {
+		if err := s.credentials.SetPassword(ctx, user.ID, passwordHash); err != nil {
+			return nil, nil, err
+		}
+	}
+	revoked, err := s.sessions.RevokeUser(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.markRevoked(ctx, revoked)
+	if err := s.startSession(ctx, user); err != nil {
+		return nil, nil, err
+	}
+	return user, revoked, nil
+}
+
+// SetPassword sets or changes the password of the caller. See reauthenticate
+// for what current has to be. Every other session of the caller is revoked
+// and returned so their connections can be closed.
+func (s *UserService) SetPassword(ctx context.Context, claims *Claims, current string, password string, ip string) ([]domain.Session, error) {
+	if err := validatePassword(password); err != nil {
+		return nil, err
+	}
+	userID, sessionID, err := s.reauthenticate(ctx, claims, current, ip)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(ctx, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.credentials.SetPassword(ctx, userID, hash); err != nil {
+		return nil, err
+	}
+	return s.revokeOtherSessions(ctx, userID, sessionID)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the caller and
+// returns the new ones, which are never shown again. Like SetPassword it
+// requires current and revokes every other session of the caller.
+func (s *UserService) RegenerateRecoveryCodes(ctx context.Context, claims *Claims, current string, ip string) ([]string, []domain.Session, error) {
+	userID, sessionID, err := s.reauthenticate(ctx, claims, current, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.credentials.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, nil, err
+	}
+	revoked, err := s.revokeOtherSessions(ctx, userID, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return codes, revoked, nil
+}
+
+func (s *UserService) RemainingRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	return s.credentials.RemainingRecoveryCodes(ctx, userID)
+}
+
+// reauthenticate makes sure the caller is the user and not just someone
+// holding their access token before their credentials change. Users with a
+// password have to give it as current; users without one have to be on a
+// session started within reauthWindow, by registering or recovering.
+func (s *UserService) reauthenticate(ctx context.Context, claims *Claims, current string, ip string) (uuid.UUID, uuid.UUID, error) {
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, domain.ErrTokenInvalid
+	}
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		// Tokens from before sessions existed can't be tied to a sign-in.
+		return uuid.Nil, uuid.Nil, ErrReauthRequired
+	}
+
+	existing, err := s.credentials.PasswordHash(ctx, userID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	if existing != nil {
+		if err := s.allowAuthAttempt(ctx, claims.Username, ip); err != nil {
+			return uuid.Nil, uuid.Nil, err
+		}
+		ok, err := checkPassword(ctx, *existing, current)
+		if err != nil {
+			return uuid.Nil, uuid.Nil, err
+		}
+		if !ok {
+			return uuid.Nil, uuid.Nil, s.failAuthAttempt(ctx, claims.Username, ip)
+		}
+		return userID, sessionID, nil
+	}
+
+	started, err := s.sessions.StartedAt(ctx, sessionID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+	if started == nil || time.Since(*started) > reauthWindow {
+		return uuid.Nil, uuid.Nil, ErrReauthRequired
+	}
+	return userID, sessionID, nil
+}
+
+func (s *UserService) revokeOtherSessions(ctx context.Context, userID uuid.UUID, keep uuid.UUID) ([]domain.Session, error) {
+	revoked, err := s.sessions.RevokeOthers(ctx, userID, keep)
+	if err != nil {
+		return nil, err
+	}
+	s.markRevoked(ctx, revoked)
+	return revoked, nil
+}
+
+// allowAuthAttempt returns a *domain.RateLimitError while username from ip,
+// or ip alone, has had too many failed login, recovery or password attempts.
+func (s *UserService) allowAuthAttempt(ctx context.Context, username string, ip string) error {
+	if err := s.peekWindow(ctx, authFailureKey(username, ip), authFailureLimit); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return s.peekWindow(ctx, "ratelimit:login-ip:"+ip, authFailureIPLimit)
+}
+
+// failAuthAttempt counts a failed attempt against username from ip and
+// against ip, and returns domain.ErrInvalidCredentials. Failing to count is
+// only logged.
+func (s *UserService) failAuthAttempt(ctx context.Context, username string, ip string) error {
+	keys := []string{authFailureKey(username, ip)}
+	if ip != "" {
+		keys = append(keys, "ratelimit:login-ip:"+ip)
+	}
+	for _, key := range keys {
+		if _, err := s.redis.RunScript(ctx, fixedWindowScript, []string{key}, authAttemptWindow.Milliseconds()); err != nil {
+			log.Printf("Count failed sign-in for %s failed: %v", key, err)
+		}
+	}
+	return domain.ErrInvalidCredentials
+}
+
+func authFailureKey(username string, ip string) string {
+	return "ratelimit:login:" + ip + ":" + strings.ToLower(username)
+}
+
+// allowWindow counts a request against key and returns a
+// *domain.RateLimitError once there have been more than limit in the current
+// window.
+func (s *UserService) allowWindow(ctx context.Context, key string, limit int, window time.Duration) error {
+	raw, err := s.redis.RunScript(ctx, fixedWindowScript, []string{key}, window.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("rate limit: %w", err)
+	}
+	return windowLimitError(raw, limit+1)
+}
+
+// peekWindow returns a *domain.RateLimitError if limit requests have
+// already been counted against key in the current window.
+func (s *UserService) peekWindow(ctx context.Context, key string, limit int) error {
+	raw, err := s.redis.RunScript(ctx, peekWindowScript, []string{key})
+	if err != nil {
+		return fmt.Errorf("rate limit: %w", err)
+	}
+	return windowLimitError(raw, limit)
+}
+
+// windowLimitError reads a {requests, retryAfterMs} reply and returns a
+// *domain.RateLimitError if requests reached over.
+func windowLimitError(raw interface{}, over int) error {
+	values, ok := raw.([]interface{})
+	if !ok || len(values) != 2 {
+		return fmt.Errorf("rate limit: unexpected reply %v", raw)
+	}
+	requests, _ := values[0].(int64)
+	retryMs, _ := values[1].(int64)
+	if requests >= int64(over) {
+		return &domain.RateLimitError{RetryAfter: time.Duration(retryMs) * time.Millisecond}
+	}
+	return nil
+}
+
+// hashPassword runs hashNewPassword once a hash slot is free.
+func hashPassword(ctx context.Context, password string) (string, error) {
+	release, err := acquireHashSlot(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return hashNewPassword(password)
+}
+
+// checkPassword runs verifyPassword once a hash slot is free.
+func checkPassword(ctx context.Context, hash string, password string) (bool, error) {
+	release, err := acquireHashSlot(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return verifyPassword(hash, password), nil
+}
+
+func acquireHashSlot(ctx context.Context) (func(), error) {
+	select {
+	case hashSlots <- struct{}{}:
+		return func() { <-hashSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return ErrPasswordInvalid
+	}
+	return nil
+}
+
+// hashNewPassword validates password and hashes it with argon2id into the
+// PHC string format.
+func hashNewPassword(password string) (string, error) {
+	if err := validatePassword(password); err != nil {
+		return "", err
+	}
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("password salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// verifyPassword reports whether password matches hash, using the
+// parameters recorded in hash.
+func verifyPassword(hash string, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+	got := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes returns fresh recovery codes, formatted as xxxxx-xxxxx,
+// and their hashes.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	buf := make([]byte, 10)
+	for i := 0; i < recoveryCodeCount; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("recovery code: %w", err)
+		}
+		raw := strings.ToLower(recoveryCodeEncoding.EncodeToString(buf))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, hashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode undoes the formatting users may add or drop when
+// typing a code back in.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/testenv"
+)
+
+func TestHashNewPasswordValidatesLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		wantErr  error
+	}{
+		{"too short", "short", ErrPasswordInvalid},
+		{"shortest", strings.Repeat("a", minPasswordLength), nil},
+		{"longest", strings.Repeat("a", maxPasswordLength), nil},
+		{"too long", strings.Repeat("a", maxPasswordLength+1), ErrPasswordInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := hashNewPassword(tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("hashNewPassword() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=1,p=4$") {
+				t.Fatalf("hashNewPassword() = %q, want an argon2id PHC string", hash)
+			}
+		})
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	hash, err := hashNewPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(hash, "$")
+
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{"match", hash, "correct horse", true},
+		{"wrong password", hash, "correct horse battery", false},
+		{"empty password", hash, "", false},
+		{"empty hash", "", "correct horse", false},
+		{"other algorithm", strings.Replace(hash, "argon2id", "argon2i", 1), "correct horse", false},
+		{"other version", strings.Replace(hash, "v=19", "v=16", 1), "correct horse", false},
+		{"bad params", strings.Replace(hash, parts[3], "m=x", 1), "correct horse", false},
+		{"bad salt", strings.Replace(hash, parts[4], "!", 1), "correct horse", false},
+		{"truncated", strings.Join(parts[:5], "$"), "correct horse", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPassword(tt.hash, tt.password); got != tt.want {
+				t.Fatalf("verifyPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashNewPasswordSalts(t *testing.T) {
+	a, err := hashNewPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := hashNewPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Fatal("two hashes of the same password are equal")
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"abcde-fghij", "abcdefghij"},
+		{"ABCDE-FGHIJ", "abcdefghij"},
+		{"abcdefghij", "abcdefghij"},
+		{"abcde fghij", "abcdefghij"},
+		{" ab-cde fg-hij ", "abcdefghij"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeRecoveryCode(tt.in); got != tt.want {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' || strings.ToLower(code) != code {
+			t.Errorf("code %q is not formatted as xxxxx-xxxxx", code)
+		}
+		if hashes[i] != hashToken(normalizeRecoveryCode(code)) {
+			t.Errorf("hash of code %q doesn't match what it normalizes to", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q issued twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestWindowLimitError(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       interface{}
+		over      int
+		wantRetry time.Duration
+		wantErr   bool
+	}{
+		{"under", []interface{}{int64(9), int64(1000)}, 10, 0, false},
+		{"at limit", []interface{}{int64(10), int64(1500)}, 10, 1500 * time.Millisecond, false},
+		{"over", []interface{}{int64(11), int64(200)}, 10, 200 * time.Millisecond, false},
+		{"not a list", "OK", 10, 0, true},
+		{"short list", []interface{}{int64(1)}, 10, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := windowLimitError(tt.raw, tt.over)
+			var rateErr *domain.RateLimitError
+			switch {
+			case tt.wantErr:
+				if err == nil || errors.As(err, &rateErr) {
+					t.Fatalf("windowLimitError() = %v, want a reply error", err)
+				}
+			case tt.wantRetry == 0:
+				if err != nil {
+					t.Fatalf("windowLimitError() = %v, want nil", err)
+				}
+			default:
+				if !errors.As(err, &rateErr) || rateErr.RetryAfter != tt.wantRetry {
+					t.Fatalf("windowLimitError() = %v, want retry after %v", err, tt.wantRetry)
+				}
+			}
+		})
+	}
+}
+
+func TestAcquireHashSlotBounded(t *testing.T) {
+	var releases []func()
+	for i := 0; i < maxConcurrentHashes; i++ {
+		release, err := acquireHashSlot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := acquireHashSlot(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquireHashSlot() with every slot taken = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	releases[0]()
+	release, err := acquireHashSlot(context.Background())
+	if err != nil {
+		t.Fatalf("acquireHashSlot() after a release = %v", err)
+	}
+	release()
+	for _, release := range releases[1:] {
+		release()
+	}
+}
+
+func TestAuthAttemptLimits(t *testing.T) {
+	s := &UserService{redis: NewRedisStore(testenv.Redis(t))}
+	ctx := context.Background()
+	fail := func(username, ip string, n int) {
+		for i := 0; i < n; i++ {
+			s.failAuthAttempt(ctx, username, ip)
+		}
+	}
+	// One address uses up alice's failures, another spreads a whole IP
+	// limit over other usernames.
+	fail("alice", "203.0.113.1", authFailureLimit)
+	for i := 0; i < authFailureIPLimit; i++ {
+		fail(fmt.Sprintf("user%d", i), "203.0.113.2", 1)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		ip       string
+		wantErr  bool
+	}{
+		{"locked username from the attacking address", "alice", "203.0.113.1", true},
+		{"case does not matter", "ALICE", "203.0.113.1", true},
+		{"locked username from another address", "alice", "198.51.100.7", false},
+		{"other username from the attacking address", "bob", "203.0.113.1", false},
+		{"any username from an address over its limit", "carol", "203.0.113.2", true},
+		{"other username and address", "carol", "198.51.100.7", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.allowAuthAttempt(ctx, tt.username, tt.ip)
+			var rateErr *domain.RateLimitError
+			if got := errors.As(err, &rateErr); got != tt.wantErr {
+				t.Fatalf("allowAuthAttempt() = %v, want limited %v", err, tt.wantErr)
+			}
+			if tt.wantErr && (rateErr.RetryAfter <= 0 || rateErr.RetryAfter > authAttemptWindow) {
+				t.Fatalf("retry after %v", rateErr.RetryAfter)
+			}
+		})
+	}
+}
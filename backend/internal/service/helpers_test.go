@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+)
+
+func newTestUser(t *testing.T, db *sqlx.DB, username string) *domain.User {
+	t.Helper()
+	user, err := repository.NewUserRepo(db).Create(context.Background(), &domain.User{Username: username, Color: domain.ColorPalette[0]}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func newTestBoard(t *testing.T, boards *BoardService, id string, width, height int, createdBy uuid.UUID) *domain.Board {
+	t.Helper()
+	board, err := boards.Create(context.Background(), &domain.Board{ID: id, Width: width, Height: height}, createdBy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return board
+}
+
+// setTileOwner hands tileID to owner as if they had claimed it age ago.
+func setTileOwner(t *testing.T, db *sqlx.DB, boardID string, tileID int, owner uuid.UUID, age time.Duration) {
+	t.Helper()
+	query := `UPDATE tiles SET owner_id = $3, claimed_at = NOW() - make_interval(secs => $4) WHERE board_id = $1 AND id = $2`
+	if _, err := db.Exec(query, boardID, tileID, owner, age.Seconds()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+)
+
+const (
+	maxEventPage = 1000
+	// maxReplayGap caps the real-time pause between two replayed events so
+	// idle stretches of a session don't stall the stream.
+	maxReplayGap = 2 * time.Second
+)
+
+type BoardSnapshot struct {
+	BoardID    string         `json:"boardId"`
+	EventID    int64          `json:"eventId"`
+	GridWidth  int            `json:"gridWidth"`
+	GridHeight int            `json:"gridHeight"`
+	Tiles      []*domain.Tile `json:"tiles"`
+}
+
+type HistoryService struct {
+	repo   *repository.EventRepo
+	boards *BoardService
+}
+
+func NewHistoryService(repo *repository.EventRepo, boards *BoardService) *HistoryService {
+	return &HistoryService{repo: repo, boards: boards}
+}
+
+func (s *HistoryService) SnapshotAtTime(ctx context.Context, boardID string, at time.Time) (*BoardSnapshot, error) {
+	eventID, err := s.repo.LastEventAt(ctx, boardID, at)
+	if err != nil {
+		return nil, err
+	}
+	return s.SnapshotAtEvent(ctx, boardID, eventID)
+}
+
+func (s *HistoryService) SnapshotAtEvent(ctx context.Context, boardID string, eventID int64) (*BoardSnapshot, error) {
+	board, err := s.boards.Get(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	tiles, err := s.repo.SnapshotAt(ctx, board.ID, eventID)
+	if err != nil {
+		return nil, err
+	}
+	return &BoardSnapshot{
+		BoardID:    board.ID,
+		EventID:    eventID,
+		GridWidth:  board.Width,
+		GridHeight: board.Height,
+		Tiles:      tiles,
+	}, nil
+}
+
+func (s *HistoryService) ListEvents(ctx context.Context, boardID string, filter repository.EventFilter) ([]*domain.TileEvent, error) {
+	board, err := s.boards.Get(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Limit <= 0 || filter.Limit > maxEventPage {
+		filter.Limit = maxEventPage
+	}
+	return s.repo.List(ctx, board.ID, filter)
+}
+
+// Replay sends the snapshot at from, then every event in [from, to] paced at
+// speed times real time. It returns when the range is exhausted, emit fails or
+// ctx is cancelled.
+func (s *HistoryService) Replay(
+	ctx context.Context,
+	boardID string,
+	from time.Time,
+	to time.Time,
+	speed float64,
+	emitSnapshot func(*BoardSnapshot) error,
+	emitEvent func(*domain.TileEvent) error,
+) error {
+	snapshot, err := s.SnapshotAtTime(ctx, boardID, from)
+	if err != nil {
+		return err
+	}
+	if err := emitSnapshot(snapshot); err != nil {
+		return err
+	}
+
+	cursor := snapshot.EventID
+	previous := from
+	for {
+		events, err := s.repo.List(ctx, snapshot.BoardID, repository.EventFilter{
+			To:      &to,
+			AfterID: cursor,
+			Limit:   maxEventPage,
+		})
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			wait := time.Duration(float64(event.CreatedAt.Sub(previous)) / speed)
+			if wait > maxReplayGap {
+				wait = maxReplayGap
+			}
+			if wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+			if err := emitEvent(event); err != nil {
+				return err
+			}
+			previous = event.CreatedAt
+			cursor = event.ID
+		}
+		if len(events) < maxEventPage {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+	"ownthegrid/internal/testenv"
+)
+
+// dbNow reads the time from Postgres, which stamps the events, so the test
+// doesn't depend on its clock matching ours.
+func dbNow(t *testing.T, db *sqlx.DB) time.Time {
+	t.Helper()
+	var now time.Time
+	if err := db.Get(&now, `SELECT clock_timestamp()`); err != nil {
+		t.Fatal(err)
+	}
+	return now
+}
+
+func TestReplay(t *testing.T) {
+	db := testenv.Postgres(t)
+	boards := NewBoardService(repository.NewBoardRepo(db))
+	history := NewHistoryService(repository.NewEventRepo(db), boards)
+	tiles := repository.NewTileRepo(db)
+	alice := newTestUser(t, db, "alice")
+	board := newTestBoard(t, boards, "replay", 3, 1, alice.ID)
+	ctx := context.Background()
+
+	start := dbNow(t, db)
+	for tile := 0; tile < 3; tile++ {
+		if _, err := tiles.ClaimTile(ctx, board.ID, tile, alice.ID, domain.CaptureRules{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	end := dbNow(t, db)
+	errStop := errors.New("stop")
+
+	tests := []struct {
+		name      string
+		boardID   string
+		from, to  time.Time
+		stopAfter int
+		wantErr   error
+		wantOwned int
+		wantTiles []int
+	}{
+		{"whole session", "", start, end, 0, nil, 0, []int{0, 1, 2}},
+		{"after the session", "", end, end.Add(time.Minute), 0, nil, 3, []int{}},
+		{"before the session", "", start.Add(-time.Hour), start, 0, nil, 0, []int{}},
+		{"emit fails", "", start, end, 2, errStop, 0, []int{0, 1}},
+		{"unknown board", "missing", start, end, 0, domain.ErrBoardNotFound, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			boardID := board.ID
+			if tt.boardID != "" {
+				boardID = tt.boardID
+			}
+			var snapshot *BoardSnapshot
+			got := []int{}
+			err := history.Replay(ctx, boardID, tt.from, tt.to, 1000,
+				func(s *BoardSnapshot) error {
+					snapshot = s
+					return nil
+				},
+				func(event *domain.TileEvent) error {
+					got = append(got, event.TileID)
+					if len(got) == tt.stopAfter {
+						return errStop
+					}
+					return nil
+				},
+			)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Replay() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantTiles == nil {
+				return
+			}
+			owned := 0
+			for _, tile := range snapshot.Tiles {
+				if tile.OwnerID != nil {
+					owned++
+				}
+			}
+			if owned != tt.wantOwned || snapshot.GridWidth != 3 || snapshot.GridHeight != 1 {
+				t.Fatalf("snapshot has %d owned tiles on %dx%d, want %d on 3x1", owned, snapshot.GridWidth, snapshot.GridHeight, tt.wantOwned)
+			}
+			if len(got) != len(tt.wantTiles) {
+				t.Fatalf("replayed tiles %v, want %v", got, tt.wantTiles)
+			}
+			for i := range got {
+				if got[i] != tt.wantTiles[i] {
+					t.Fatalf("replayed tiles %v, want %v", got, tt.wantTiles)
+				}
+			}
+		})
+	}
+}
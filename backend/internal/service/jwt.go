@@ -1,6 +1,20 @@
 package service
 
 import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -10,28 +24,204 @@ import (
 type Claims struct {
 	UserID   string `json:"userId"`
 	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
+	// SessionID names the refresh-token session the token was minted from.
+	SessionID string `json:"sid,omitempty"`
+	// APIKeyID and Scopes are set when the caller authenticated with an API
+	// key, which is never a JWT; they are what the key was granted.
+	APIKeyID string   `json:"apiKeyId,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func buildToken(userID uuid.UUID, username string, secret string, ttl time.Duration) (string, error) {
-	now := time.Now()
+// HasScope reports whether the caller may act within scope. User tokens
+// carry every scope; API keys only those they were granted.
+func (c *Claims) HasScope(scope string) bool {
+	return c.APIKeyID == "" || slices.Contains(c.Scopes, scope)
+}
+
+// verificationKey is one key tokens may be signed with, named by the kid
+// header. private is nil for keys that only verify.
+type verificationKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	public  crypto.PublicKey
+	private crypto.Signer
+}
+
+// KeySet signs tokens with one key and verifies them with any of its keys,
+// picked by the token's kid. Several keys can be active at once so the
+// signing key can be rotated without invalidating tokens already out.
+//
+// A set may also hold a shared HS256 secret. It signs only when there is no
+// private key, and verifies only tokens without a kid, so tokens minted
+// before switching to keys keep working until they expire.
+type KeySet struct {
+	keys    map[string]*verificationKey
+	signing *verificationKey
+	secret  []byte
+}
+
+// NewKeySet loads the PEM keys in files, each named by its file name without
+// the extension, and signs with signingKID, or else the first private key.
+// secret may be empty once every token in use carries a kid.
+func NewKeySet(files []string, signingKID string, secret string) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]*verificationKey, len(files))}
+	if secret != "" {
+		set.secret = []byte(secret)
+	}
+	for _, file := range files {
+		key, err := loadKey(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := set.keys[key.kid]; ok {
+			return nil, fmt.Errorf("jwt keys: duplicate kid %q", key.kid)
+		}
+		set.keys[key.kid] = key
+		if set.signing == nil && signingKID == "" && key.private != nil {
+			set.signing = key
+		}
+	}
+	if signingKID != "" {
+		key, ok := set.keys[signingKID]
+		if !ok || key.private == nil {
+			return nil, fmt.Errorf("jwt keys: no private key with kid %q", signingKID)
+		}
+		set.signing = key
+	}
+	if set.signing == nil && set.secret == nil {
+		return nil, errors.New("jwt keys: no private key or secret to sign with")
+	}
+	return set, nil
+}
+
+func loadKey(file string) (*verificationKey, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("jwt key %s: %w", file, err)
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("jwt key %s: no PEM block", file)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("jwt key %s: unsupported PEM type %q", file, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("jwt key %s: %w", file, err)
+	}
+
+	key := &verificationKey{kid: strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))}
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.public = jwt.SigningMethodEdDSA, k
+	case *rsa.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodRS256, k, k.Public()
+	case *rsa.PublicKey:
+		key.method, key.public = jwt.SigningMethodRS256, k
+	default:
+		return nil, fmt.Errorf("jwt key %s: only Ed25519 and RSA keys are supported", file)
+	}
+	if rsaKey, ok := key.public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("jwt key %s: RSA keys must be at least 2048 bits", file)
+	}
+	return key, nil
+}
+
+func (ks *KeySet) sign(claims Claims) (string, error) {
+	if ks.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.secret)
+	}
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.kid
+	return token.SignedString(ks.signing.private)
+}
+
+// keyFor returns the key a token must verify against. The algorithm in the
+// header has to be the one its key is used with, so a public key can never
+// be passed off as an HMAC secret.
+func (ks *KeySet) keyFor(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if ks.secret == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("%w: missing kid", jwt.ErrTokenUnverifiable)
+		}
+		return ks.secret, nil
+	}
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown kid %q", jwt.ErrTokenUnverifiable, kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("%w: kid %q is not used with %s", jwt.ErrTokenSignatureInvalid, kid, token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public half of every asymmetric key as a JSON Web Key
+// Set. The HS256 secret is never published.
+func (ks *KeySet) JWKS() map[string]interface{} {
+	keys := make([]map[string]string, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		jwk := map[string]string{
+			"kid": key.kid,
+			"alg": key.method.Alg(),
+			"use": "sig",
+		}
+		switch pub := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk["kty"] = "OKP"
+			jwk["crv"] = "Ed25519"
+			jwk["x"] = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk["kty"] = "RSA"
+			jwk["n"] = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk["e"] = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		}
+		keys = append(keys, jwk)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i]["kid"] < keys[j]["kid"] })
+	return map[string]interface{}{"keys": keys}
+}
+
+func buildToken(userID uuid.UUID, username string, role string, sessionID uuid.UUID, keys *KeySet, expiresAt time.Time) (string, error) {
 	claims := Claims{
-		UserID:   userID.String(),
-		Username: username,
+		UserID:    userID.String(),
+		Username:  username,
+		Role:      role,
+		SessionID: sessionID.String(),
 		RegisteredClaims: jwt.RegisteredClaims{
-			IssuedAt:  jwt.NewNumericDate(now),
-			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			Subject:   userID.String(),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return keys.sign(claims)
 }
 
-func parseToken(tokenString string, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+func parseToken(tokenString string, keys *KeySet) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keys.keyFor,
+		jwt.WithValidMethods([]string{
+			jwt.SigningMethodEdDSA.Alg(),
+			jwt.SigningMethodRS256.Alg(),
+			jwt.SigningMethodHS256.Alg(),
+		}),
+		jwt.WithExpirationRequired(),
+	)
 	if err != nil {
 		return nil, err
 	}
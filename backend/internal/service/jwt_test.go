@@ -0,0 +1,281 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const testSecret = "test-secret-test-secret-test-secret"
+
+// writeKey writes key as a PEM file called name in dir and returns its path.
+func writeKey(t *testing.T, dir string, name string, key interface{}) string {
+	t.Helper()
+	var block *pem.Block
+	switch k := key.(type) {
+	case ed25519.PublicKey, *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	case *rsa.PrivateKey:
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	path := filepath.Join(dir, name+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newEd25519(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newRSA(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func testClaims() Claims {
+	id := uuid.New()
+	return Claims{
+		UserID:   id.String(),
+		Username: "tester",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+}
+
+func TestNewKeySet(t *testing.T) {
+	dir := t.TempDir()
+	ed := writeKey(t, dir, "ed", newEd25519(t))
+	edPub := writeKey(t, dir, "ed-pub", newEd25519(t).Public())
+	small := writeKey(t, dir, "small", newRSA(t, 1024))
+	other := writeKey(t, t.TempDir(), "ed", newEd25519(t))
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		files      []string
+		signingKID string
+		secret     string
+		wantErr    string
+		wantSigner string
+	}{
+		{"secret only", nil, "", testSecret, "", ""},
+		{"first private key signs", []string{edPub, ed}, "", "", "", "ed"},
+		{"named signing key", []string{ed}, "ed", "", "", "ed"},
+		{"nothing to sign with", nil, "", "", "no private key or secret", ""},
+		{"public keys only", []string{edPub}, "", "", "no private key or secret", ""},
+		{"signing key without private half", []string{edPub}, "ed-pub", testSecret, `no private key with kid "ed-pub"`, ""},
+		{"unknown signing key", []string{ed}, "nope", "", `no private key with kid "nope"`, ""},
+		{"duplicate kid", []string{ed, other}, "", "", `duplicate kid "ed"`, ""},
+		{"small RSA key", []string{small}, "", "", "at least 2048 bits", ""},
+		{"not PEM", []string{garbage}, "", "", "no PEM block", ""},
+		{"missing file", []string{filepath.Join(dir, "missing.pem")}, "", "", "no such file", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := NewKeySet(tt.files, tt.signingKID, tt.secret)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewKeySet() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewKeySet() error = %v", err)
+			}
+			signer := ""
+			if set.signing != nil {
+				signer = set.signing.kid
+			}
+			if signer != tt.wantSigner {
+				t.Fatalf("signing kid = %q, want %q", signer, tt.wantSigner)
+			}
+		})
+	}
+}
+
+func TestKeySetRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		files  []string
+		secret string
+		alg    string
+	}{
+		{"HS256", nil, testSecret, "HS256"},
+		{"EdDSA", []string{writeKey(t, dir, "ed", newEd25519(t))}, "", "EdDSA"},
+		{"RS256", []string{writeKey(t, dir, "rsa", newRSA(t, 2048))}, "", "RS256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := NewKeySet(tt.files, "", tt.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := testClaims()
+			token, err := set.sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := parseToken(token, set)
+			if err != nil {
+				t.Fatalf("parseToken() error = %v", err)
+			}
+			if parsed.UserID != claims.UserID {
+				t.Fatalf("parsed user = %q, want %q", parsed.UserID, claims.UserID)
+			}
+			header, _, _ := strings.Cut(token, ".")
+			raw, err := jwt.NewParser().DecodeSegment(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(raw), `"alg":"`+tt.alg+`"`) {
+				t.Fatalf("header %s, want alg %s", raw, tt.alg)
+			}
+		})
+	}
+}
+
+func TestKeySetKeyFor(t *testing.T) {
+	dir := t.TempDir()
+	edKey := newEd25519(t)
+	rsaKey := newRSA(t, 2048)
+	withSecret, err := NewKeySet([]string{writeKey(t, dir, "ed", edKey), writeKey(t, dir, "rsa", rsaKey)}, "ed", testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutSecret, err := NewKeySet([]string{writeKey(t, dir, "ed", edKey)}, "ed", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signWith signs claims with method and key, setting kid when not empty.
+	signWith := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, testClaims())
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	edDER, err := x509.MarshalPKIXPublicKey(edKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		set     *KeySet
+		token   string
+		wantErr error
+	}{
+		{"EdDSA with kid", withSecret, signWith(jwt.SigningMethodEdDSA, "ed", edKey), nil},
+		{"RS256 with kid", withSecret, signWith(jwt.SigningMethodRS256, "rsa", rsaKey), nil},
+		{"HS256 without kid", withSecret, signWith(jwt.SigningMethodHS256, "", []byte(testSecret)), nil},
+		{"HS256 without kid or secret", withoutSecret, signWith(jwt.SigningMethodHS256, "", []byte(testSecret)), jwt.ErrTokenUnverifiable},
+		{"EdDSA without kid", withSecret, signWith(jwt.SigningMethodEdDSA, "", edKey), jwt.ErrTokenUnverifiable},
+		{"unknown kid", withSecret, signWith(jwt.SigningMethodEdDSA, "other", edKey), jwt.ErrTokenUnverifiable},
+		{"kid used with another alg", withSecret, signWith(jwt.SigningMethodRS256, "ed", rsaKey), jwt.ErrTokenSignatureInvalid},
+		{"public key as HMAC secret", withSecret, signWith(jwt.SigningMethodHS256, "ed", edDER), jwt.ErrTokenSignatureInvalid},
+		{"HS256 with kid", withSecret, signWith(jwt.SigningMethodHS256, "ed", []byte(testSecret)), jwt.ErrTokenSignatureInvalid},
+		{"wrong key for kid", withSecret, signWith(jwt.SigningMethodEdDSA, "ed", newEd25519(t)), jwt.ErrTokenSignatureInvalid},
+		{"none", withSecret, signWith(jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType), jwt.ErrTokenSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseToken(tt.token, tt.set)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("parseToken() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseTokenRequiresExpiry(t *testing.T) {
+	set, err := NewKeySet(nil, "", testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := testClaims()
+	claims.ExpiresAt = nil
+	token, err := set.sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseToken(token, set); !errors.Is(err, jwt.ErrTokenRequiredClaimMissing) {
+		t.Fatalf("parseToken() error = %v, want %v", err, jwt.ErrTokenRequiredClaimMissing)
+	}
+}
+
+func TestKeySetJWKS(t *testing.T) {
+	dir := t.TempDir()
+	set, err := NewKeySet([]string{
+		writeKey(t, dir, "b-rsa", newRSA(t, 2048)),
+		writeKey(t, dir, "a-ed", newEd25519(t).Public()),
+	}, "", testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := set.JWKS()["keys"].([]map[string]string)
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys, want 2; the secret must never be published", len(keys))
+	}
+	want := []map[string]string{
+		{"kid": "a-ed", "kty": "OKP", "alg": "EdDSA", "crv": "Ed25519"},
+		{"kid": "b-rsa", "kty": "RSA", "alg": "RS256", "e": "AQAB"},
+	}
+	for i, fields := range want {
+		for field, value := range fields {
+			if keys[i][field] != value {
+				t.Errorf("key %d %s = %q, want %q", i, field, keys[i][field], value)
+			}
+		}
+		if keys[i]["use"] != "sig" {
+			t.Errorf("key %d use = %q, want sig", i, keys[i]["use"])
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// KEYS: lease. ARGV: holder, ttl ms. Takes the lease when it is free and
+// extends it when the caller already holds it. Returns 1 while held.
+var leaseAcquireScript = redis.NewScript(`
+local holder = redis.call("GET", KEYS[1])
+if holder == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if not holder then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// KEYS: lease. ARGV: holder.
+var leaseReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// LeaderElection runs singleton background jobs on one instance at a time.
+// Each job has its own lease (leader:<name>) that the holder renews every
+// third of the ttl; when the holder dies the lease expires and another
+// instance takes over.
+type LeaderElection struct {
+	redis      RedisStore
+	instanceID string
+	ttl        time.Duration
+}
+
+func NewLeaderElection(redis RedisStore, instanceID string, ttl time.Duration) *LeaderElection {
+	return &LeaderElection{redis: redis, instanceID: instanceID, ttl: ttl}
+}
+
+func leaseKey(name string) string {
+	return "leader:" + name
+}
+
+// Run blocks until ctx is done, running job whenever this instance holds the
+// lease for name. The context passed to job is cancelled as soon as the
+// lease can't be renewed, so job must return promptly once it is done.
+func (l *LeaderElection) Run(ctx context.Context, name string, job func(ctx context.Context)) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	var (
+		stop    context.CancelFunc
+		stopped chan struct{}
+	)
+	resign := func() {
+		if stop == nil {
+			return
+		}
+		stop()
+		<-stopped
+		stop, stopped = nil, nil
+	}
+	defer func() {
+		resign()
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := l.release(releaseCtx, name); err != nil {
+			log.Printf("Leader %s: %v", name, err)
+		}
+	}()
+
+	for {
+		held, err := l.acquire(ctx, name)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Leader %s: %v", name, err)
+		}
+		switch {
+		case held && stop == nil:
+			log.Printf("Leader %s: acquired by instance %s", name, l.instanceID)
+			stop, stopped = startJob(ctx, job)
+		case !held && stop != nil:
+			log.Printf("Leader %s: lease lost by instance %s", name, l.instanceID)
+			resign()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startJob runs job in its own goroutine and returns a cancel func plus a
+// channel closed once job has returned.
+func startJob(ctx context.Context, job func(ctx context.Context)) (context.CancelFunc, chan struct{}) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		job(jobCtx)
+	}()
+	return cancel, done
+}
+
+func (l *LeaderElection) acquire(ctx context.Context, name string) (bool, error) {
+	res, err := l.redis.RunScript(ctx, leaseAcquireScript, []string{leaseKey(name)}, l.instanceID, l.ttl.Milliseconds())
+	if err != nil {
+		return false, fmt.Errorf("acquire lease: %w", err)
+	}
+	n, _ := res.(int64)
+	return n == 1, nil
+}
+
+func (l *LeaderElection) release(ctx context.Context, name string) error {
+	if _, err := l.redis.RunScript(ctx, leaseReleaseScript, []string{leaseKey(name)}, l.instanceID); err != nil {
+		return fmt.Errorf("release lease: %w", err)
+	}
+	return nil
+}
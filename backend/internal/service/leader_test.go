@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"ownthegrid/internal/testenv"
+)
+
+func TestLease(t *testing.T) {
+	redis := NewRedisStore(testenv.Redis(t))
+	a := NewLeaderElection(redis, "a", time.Minute)
+	b := NewLeaderElection(redis, "b", time.Minute)
+	ctx := context.Background()
+
+	steps := []struct {
+		name     string
+		election *LeaderElection
+		release  bool
+		want     bool
+	}{
+		{"free lease", a, false, true},
+		{"held by another", b, false, false},
+		{"renewed by its holder", a, false, true},
+		{"released by a non-holder", b, true, false},
+		{"still held", b, false, false},
+		{"released by its holder", a, true, false},
+		{"taken over", b, false, true},
+	}
+	for _, step := range steps {
+		if step.release {
+			if err := step.election.release(ctx, "job"); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+			continue
+		}
+		held, err := step.election.acquire(ctx, "job")
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if held != step.want {
+			t.Fatalf("%s: acquire() = %v, want %v", step.name, held, step.want)
+		}
+	}
+}
+
+// jobTracker records which instances are running a job right now.
+type jobTracker struct {
+	mu      sync.Mutex
+	running map[string]bool
+	changed chan struct{}
+}
+
+func (j *jobTracker) job(instance string) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		j.set(instance, true)
+		<-ctx.Done()
+		j.set(instance, false)
+	}
+}
+
+func (j *jobTracker) set(instance string, running bool) {
+	j.mu.Lock()
+	j.running[instance] = running
+	j.mu.Unlock()
+	select {
+	case j.changed <- struct{}{}:
+	default:
+	}
+}
+
+// waitFor waits until exactly the given instances are running the job.
+func (j *jobTracker) waitFor(t *testing.T, instances ...string) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		j.mu.Lock()
+		n := 0
+		for _, running := range j.running {
+			if running {
+				n++
+			}
+		}
+		ok := n == len(instances)
+		for _, instance := range instances {
+			ok = ok && j.running[instance]
+		}
+		state := make(map[string]bool, len(j.running))
+		for k, v := range j.running {
+			state[k] = v
+		}
+		j.mu.Unlock()
+		if ok {
+			return
+		}
+		select {
+		case <-j.changed:
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatalf("running %v, want only %v", state, instances)
+		}
+	}
+}
+
+func TestLeaderElectionFailover(t *testing.T) {
+	client := testenv.Redis(t)
+	redis := NewRedisStore(client)
+	const ttl = 300 * time.Millisecond
+	jobs := &jobTracker{running: map[string]bool{}, changed: make(chan struct{}, 1)}
+
+	ctxA, stopA := context.WithCancel(context.Background())
+	doneA := make(chan struct{})
+	go func() {
+		NewLeaderElection(redis, "a", ttl).Run(ctxA, "job", jobs.job("a"))
+		close(doneA)
+	}()
+	jobs.waitFor(t, "a")
+
+	ctxB, stopB := context.WithCancel(context.Background())
+	defer stopB()
+	go NewLeaderElection(redis, "b", ttl).Run(ctxB, "job", jobs.job("b"))
+
+	// b waits while a holds the lease, and takes over once a stops.
+	time.Sleep(2 * ttl)
+	jobs.waitFor(t, "a")
+	stopA()
+	<-doneA
+	jobs.waitFor(t, "b")
+
+	// A holder that finds the lease taken stops its job.
+	if err := client.Set(context.Background(), leaseKey("job"), "c", time.Minute).Err(); err != nil {
+		t.Fatal(err)
+	}
+	jobs.waitFor(t)
+}
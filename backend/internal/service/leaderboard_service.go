@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+)
+
+const maxLeaderboardLimit = 100
+
+// KEYS: leaderboard. ARGV: score / member pairs. Replaces the whole set in
+// one step so readers never see it half rebuilt.
+var leaderboardRebuildScript = redis.NewScript(`
+redis.call("DEL", KEYS[1])
+for i = 1, #ARGV, 2 do
+	redis.call("ZADD", KEYS[1], ARGV[i], ARGV[i + 1])
+end
+return #ARGV / 2
+`)
+
+// LeaderboardService serves rankings from the board:<id>:leaderboard and
+// board:<id>:team-leaderboard sorted sets that TileService keeps up to date
+// on every claim. Postgres stays the source of truth: Reconcile rebuilds the
+// sets from tile ownership.
+type LeaderboardService struct {
+	tiles  *repository.TileRepo
+	users  *repository.UserRepo
+	teams  *repository.TeamRepo
+	boards *BoardService
+	redis  RedisStore
+}
+
+func NewLeaderboardService(
+	tiles *repository.TileRepo,
+	users *repository.UserRepo,
+	teams *repository.TeamRepo,
+	boards *BoardService,
+	redis RedisStore,
+) *LeaderboardService {
+	return &LeaderboardService{tiles: tiles, users: users, teams: teams, boards: boards, redis: redis}
+}
+
+// Top returns the limit highest ranked users on boardID. Users without tiles
+// are left out.
+func (s *LeaderboardService) Top(ctx context.Context, boardID string, limit int) ([]domain.LeaderboardEntry, error) {
+	if limit <= 0 {
+		return []domain.LeaderboardEntry{}, nil
+	}
+	if limit > maxLeaderboardLimit {
+		limit = maxLeaderboardLimit
+	}
+	rows, err := s.redis.ZRevRangeWithScores(ctx, boardKey(boardID, "leaderboard"), 0, int64(limit-1))
+	if err != nil {
+		return nil, fmt.Errorf("leaderboard: %w", err)
+	}
+
+	entries := make([]domain.LeaderboardEntry, 0, len(rows))
+	ids := make([]uuid.UUID, 0, len(rows))
+	for i, row := range rows {
+		count := int(row.Score)
+		if count <= 0 {
+			break
+		}
+		member, _ := row.Member.(string)
+		id, err := uuid.Parse(member)
+		if err != nil {
+			continue
+		}
+		rank := i + 1
+		if n := len(entries); n > 0 && entries[n-1].TileCount == count {
+			rank = entries[n-1].Rank
+		}
+		entries = append(entries, domain.LeaderboardEntry{UserID: id, TileCount: count, Rank: rank})
+		ids = append(ids, id)
+	}
+
+	if err := s.fillUsers(ctx, entries, ids); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// TopTeams returns the limit highest ranked teams on boardID, counting the
+// tiles their members own.
+func (s *LeaderboardService) TopTeams(ctx context.Context, boardID string, limit int) ([]domain.TeamLeaderboardEntry, error) {
+	if limit <= 0 {
+		return []domain.TeamLeaderboardEntry{}, nil
+	}
+	if limit > maxLeaderboardLimit {
+		limit = maxLeaderboardLimit
+	}
+	rows, err := s.redis.ZRevRangeWithScores(ctx, boardKey(boardID, "team-leaderboard"), 0, int64(limit-1))
+	if err != nil {
+		return nil, fmt.Errorf("team leaderboard: %w", err)
+	}
+
+	entries := make([]domain.TeamLeaderboardEntry, 0, len(rows))
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		count := int(row.Score)
+		if count <= 0 {
+			break
+		}
+		member, _ := row.Member.(string)
+		id, err := uuid.Parse(member)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, domain.TeamLeaderboardEntry{TeamID: id, TileCount: count})
+		ids = append(ids, id)
+	}
+
+	teams, err := s.teams.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*domain.Team, len(teams))
+	for _, team := range teams {
+		byID[team.ID] = team
+	}
+	// Teams deleted since their last tile was counted are skipped.
+	known := entries[:0]
+	for _, entry := range entries {
+		if team, ok := byID[entry.TeamID]; ok {
+			entry.Name = team.Name
+			entry.Color = team.Color
+			known = append(known, entry)
+		}
+	}
+	rankTeams(known)
+	return known, nil
+}
+
+// MoveTeamScore moves userID's tiles on boardID from one team's score to
+// another's after they switch teams. Either team may be nil.
+func (s *LeaderboardService) MoveTeamScore(ctx context.Context, boardID string, userID uuid.UUID, from, to *uuid.UUID) error {
+	score, err := s.redis.ZScore(ctx, boardKey(boardID, "leaderboard"), userID.String())
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("team leaderboard: %w", err)
+	}
+	if score <= 0 {
+		return nil
+	}
+	key := boardKey(boardID, "team-leaderboard")
+	if from != nil {
+		if err := s.redis.ZIncrBy(ctx, key, -score, from.String()); err != nil {
+			return fmt.Errorf("team leaderboard: %w", err)
+		}
+	}
+	if to != nil {
+		if err := s.redis.ZIncrBy(ctx, key, score, to.String()); err != nil {
+			return fmt.Errorf("team leaderboard: %w", err)
+		}
+	}
+	return nil
+}
+
+// rankTeams fills in competition ranks for entries sorted by tile count.
+func rankTeams(entries []domain.TeamLeaderboardEntry) {
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i-1].TileCount == entries[i].TileCount {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+}
+
+// RankOf returns userID's standing on boardID, or ErrBoardNotFound. A user
+// without tiles ranks level with everyone else who has none.
+func (s *LeaderboardService) RankOf(ctx context.Context, boardID string, userID uuid.UUID) (*domain.LeaderboardEntry, error) {
+	board, err := s.boards.Get(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, nil
+	}
+
+	key := boardKey(board.ID, "leaderboard")
+	score, err := s.redis.ZScore(ctx, key, userID.String())
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("leaderboard rank: %w", err)
+	}
+	if score < 0 {
+		score = 0
+	}
+	above, err := s.redis.ZCount(ctx, key, "("+strconv.Itoa(int(score)), "+inf")
+	if err != nil {
+		return nil, fmt.Errorf("leaderboard rank: %w", err)
+	}
+
+	return &domain.LeaderboardEntry{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Color:     user.Color,
+		TileCount: int(score),
+		Rank:      int(above) + 1,
+	}, nil
+}
+
+// Reconcile compares the user and team sorted sets for boardID with tile
+// ownership in Postgres and rebuilds the ones that disagree, or both
+// unconditionally when force is set. It reports whether anything was
+// rebuilt.
+//
+// Claims and team changes racing a rebuild can leave a score off by their
+// increment until the next reconcile: too low if the increment lands after
+// the Postgres read but before the rebuild, which wipes it, and too high if
+// the change is in the read but its increment lands after the rebuild.
+func (s *LeaderboardService) Reconcile(ctx context.Context, boardID string, force bool) (bool, error) {
+	counts, err := s.tiles.OwnerCounts(ctx, boardID)
+	if err != nil {
+		return false, err
+	}
+	territory, err := s.tiles.TeamTerritory(ctx, boardID)
+	if err != nil {
+		return false, err
+	}
+	teamCounts := make(map[uuid.UUID]int, len(territory))
+	for _, entry := range territory {
+		teamCounts[entry.TeamID] = entry.TileCount
+	}
+
+	rebuilt, err := s.reconcileSet(ctx, boardKey(boardID, "leaderboard"), counts, force)
+	if err != nil {
+		return false, err
+	}
+	rebuiltTeams, err := s.reconcileSet(ctx, boardKey(boardID, "team-leaderboard"), teamCounts, force)
+	if err != nil {
+		return false, err
+	}
+	return rebuilt || rebuiltTeams, nil
+}
+
+func (s *LeaderboardService) reconcileSet(ctx context.Context, key string, counts map[uuid.UUID]int, force bool) (bool, error) {
+	if !force {
+		rows, err := s.redis.ZRevRangeWithScores(ctx, key, 0, -1)
+		if err != nil {
+			return false, fmt.Errorf("leaderboard reconcile: %w", err)
+		}
+		if !leaderboardDrifted(rows, counts) {
+			return false, nil
+		}
+	}
+
+	args := make([]interface{}, 0, len(counts)*2)
+	for id, count := range counts {
+		args = append(args, count, id.String())
+	}
+	if _, err := s.redis.RunScript(ctx, leaderboardRebuildScript, []string{key}, args...); err != nil {
+		return false, fmt.Errorf("leaderboard rebuild: %w", err)
+	}
+	return true, nil
+}
+
+func leaderboardDrifted(rows []redis.Z, counts map[uuid.UUID]int) bool {
+	seen := 0
+	for _, row := range rows {
+		count := int(row.Score)
+		if count == 0 {
+			continue
+		}
+		member, _ := row.Member.(string)
+		id, err := uuid.Parse(member)
+		if err != nil || counts[id] != count {
+			return true
+		}
+		seen++
+	}
+	return seen != len(counts)
+}
+
+func (s *LeaderboardService) fillUsers(ctx context.Context, entries []domain.LeaderboardEntry, ids []uuid.UUID) error {
+	users, err := s.users.GetByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[uuid.UUID]*domain.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+	for i := range entries {
+		user, ok := byID[entries[i].UserID]
+		if !ok {
+			log.Printf("Leaderboard: unknown user %s", entries[i].UserID)
+			continue
+		}
+		entries[i].Username = user.Username
+		entries[i].Color = user.Color
+	}
+	return nil
+}
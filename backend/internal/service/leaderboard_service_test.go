@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+	"ownthegrid/internal/testenv"
+)
+
+func newTestLeaderboard(t *testing.T, db *sqlx.DB, redis RedisStore) (*LeaderboardService, *BoardService) {
+	t.Helper()
+	boards := NewBoardService(repository.NewBoardRepo(db))
+	leaderboard := NewLeaderboardService(
+		repository.NewTileRepo(db), repository.NewUserRepo(db), repository.NewTeamRepo(db), boards, redis,
+	)
+	return leaderboard, boards
+}
+
+func TestRankTeams(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts []int
+		want   []int
+	}{
+		{"empty", nil, []int{}},
+		{"one", []int{5}, []int{1}},
+		{"distinct", []int{9, 5, 1}, []int{1, 2, 3}},
+		{"tie for first", []int{9, 9, 5}, []int{1, 1, 3}},
+		{"tie in the middle", []int{9, 5, 5, 5, 1}, []int{1, 2, 2, 2, 5}},
+		{"tie for last", []int{9, 0, 0}, []int{1, 2, 2}},
+		{"all tied", []int{3, 3, 3}, []int{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := make([]domain.TeamLeaderboardEntry, len(tt.counts))
+			for i, count := range tt.counts {
+				entries[i].TileCount = count
+			}
+			rankTeams(entries)
+			got := []int{}
+			for _, entry := range entries {
+				got = append(got, entry.Rank)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ranks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankOf(t *testing.T) {
+	db := testenv.Postgres(t)
+	redis := NewRedisStore(testenv.Redis(t))
+	leaderboard, boards := newTestLeaderboard(t, db, redis)
+	users := []*domain.User{
+		newTestUser(t, db, "alice"), newTestUser(t, db, "bob"), newTestUser(t, db, "carol"), newTestUser(t, db, "dave"),
+	}
+	board := newTestBoard(t, boards, "ranks", 2, 2, users[0].ID)
+	ctx := context.Background()
+
+	// alice 5, bob and carol 3 each, dave none.
+	for i, count := range []float64{5, 3, 3} {
+		if err := redis.ZIncrBy(ctx, boardKey(board.ID, "leaderboard"), count, users[i].ID.String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		boardID   string
+		userID    uuid.UUID
+		wantErr   error
+		wantNil   bool
+		wantRank  int
+		wantCount int
+	}{
+		{"leader", board.ID, users[0].ID, nil, false, 1, 5},
+		{"tied", board.ID, users[1].ID, nil, false, 2, 3},
+		{"tied the other way", board.ID, users[2].ID, nil, false, 2, 3},
+		{"no tiles", board.ID, users[3].ID, nil, false, 4, 0},
+		{"unknown user", board.ID, uuid.New(), nil, true, 0, 0},
+		{"unknown board", "missing", users[0].ID, domain.ErrBoardNotFound, true, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := leaderboard.RankOf(ctx, tt.boardID, tt.userID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RankOf() error = %v, want %v", err, tt.wantErr)
+			}
+			if (entry == nil) != tt.wantNil {
+				t.Fatalf("RankOf() = %+v", entry)
+			}
+			if entry != nil && (entry.Rank != tt.wantRank || entry.TileCount != tt.wantCount) {
+				t.Fatalf("rank %d with %d tiles, want %d with %d", entry.Rank, entry.TileCount, tt.wantRank, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	db := testenv.Postgres(t)
+	redis := NewRedisStore(testenv.Redis(t))
+	leaderboard, boards := newTestLeaderboard(t, db, redis)
+	alice, bob := newTestUser(t, db, "alice"), newTestUser(t, db, "bob")
+	board := newTestBoard(t, boards, "reconcile", 3, 3, alice.ID)
+	color := domain.ColorPalette[1]
+	team, _, err := repository.NewTeamRepo(db).Create(context.Background(), &domain.Team{Name: "reds", Color: &color}, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tile := range []int{0, 1, 2} {
+		setTileOwner(t, db, board.ID, tile, alice.ID, time.Hour)
+	}
+	setTileOwner(t, db, board.ID, 3, bob.ID, time.Hour)
+	ctx := context.Background()
+	users, teams := boardKey(board.ID, "leaderboard"), boardKey(board.ID, "team-leaderboard")
+
+	// scores leaves out members at zero, which Reconcile ignores.
+	scores := func(key string) map[string]int {
+		t.Helper()
+		rows, err := redis.ZRevRangeWithScores(ctx, key, 0, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]int{}
+		for _, row := range rows {
+			if member, _ := row.Member.(string); row.Score != 0 {
+				got[member] = int(row.Score)
+			}
+		}
+		return got
+	}
+	wantUsers := map[string]int{alice.ID.String(): 3, bob.ID.String(): 1}
+	wantTeams := map[string]int{team.ID.String(): 3}
+
+	tests := []struct {
+		name        string
+		drift       func()
+		force       bool
+		wantRebuilt bool
+	}{
+		{"empty sets", func() {}, false, true},
+		{"in step", func() {}, false, false},
+		{"in step but forced", func() {}, true, true},
+		{"user score off", func() { redis.ZIncrBy(ctx, users, 2, bob.ID.String()) }, false, true},
+		{"stray user", func() { redis.ZIncrBy(ctx, users, 1, uuid.NewString()) }, false, true},
+		{"team score off", func() { redis.ZIncrBy(ctx, teams, -1, team.ID.String()) }, false, true},
+		{"zero scores are ignored", func() { redis.ZIncrBy(ctx, users, 0, uuid.NewString()) }, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.drift()
+			rebuilt, err := leaderboard.Reconcile(ctx, board.ID, tt.force)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rebuilt != tt.wantRebuilt {
+				t.Fatalf("Reconcile() = %v, want %v", rebuilt, tt.wantRebuilt)
+			}
+			if got := scores(users); !reflect.DeepEqual(got, wantUsers) {
+				t.Fatalf("user scores = %v, want %v", got, wantUsers)
+			}
+			if got := scores(teams); !reflect.DeepEqual(got, wantTeams) {
+				t.Fatalf("team scores = %v, want %v", got, wantTeams)
+			}
+		})
+	}
+}
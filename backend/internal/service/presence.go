@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const presenceInstancesKey = "presence:instances"
+
+// Presence is tracked per instance: board:<id>:presence:<instance> holds the
+// users connected through that instance, scored by their last heartbeat, and
+// presence:instances holds each instance's own heartbeat. board:<id>:online
+// stays the set of users present through at least one live instance.
+//
+// All scripts take timestamps from Redis TIME so instance clocks don't matter.
+const presenceNowLua = `
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+`
+
+// KEYS: instances, online set, instance presence. ARGV: instance, user.
+var presenceJoinScript = redis.NewScript(presenceNowLua + `
+redis.call("ZADD", KEYS[1], now, ARGV[1])
+redis.call("ZADD", KEYS[3], now, ARGV[2])
+return redis.call("SADD", KEYS[2], ARGV[2])
+`)
+
+// presenceInstanceLua maps each instance named in ARGV[first..] to the
+// presence set passed in KEYS at the same offset from 3, and fails with
+// STALE_INSTANCES if KEYS[1] lists an instance that wasn't passed, so the
+// caller can read the instances again and retry.
+const presenceInstanceLua = `
+local presenceOf = {}
+for i = first, #ARGV do
+	presenceOf[ARGV[i]] = KEYS[i - first + 3]
+end
+for _, inst in ipairs(redis.call("ZRANGE", KEYS[1], 0, -1)) do
+	if not presenceOf[inst] then
+		return redis.error_reply("STALE_INSTANCES")
+	end
+end
+`
+
+// KEYS: instances, online set, then the presence set of every instance.
+// ARGV: user, ttl ms, then the instances, this one first. Returns 1 when
+// the user has no presence left on any live instance.
+var presenceLeaveScript = redis.NewScript(presenceNowLua + `local first = 3` + presenceInstanceLua + `
+redis.call("ZREM", KEYS[3], ARGV[1])
+local cutoff = now - tonumber(ARGV[2])
+for _, inst in ipairs(redis.call("ZRANGEBYSCORE", KEYS[1], cutoff, "+inf")) do
+	local score = redis.call("ZSCORE", presenceOf[inst], ARGV[1])
+	if score and tonumber(score) >= cutoff then
+		return 0
+	end
+end
+return redis.call("SREM", KEYS[2], ARGV[1])
+`)
+
+// KEYS: instances, then the presence set and online set of each board.
+// ARGV: instance, then for each board its number of users followed by them.
+var presenceHeartbeatScript = redis.NewScript(presenceNowLua + `
+redis.call("ZADD", KEYS[1], now, ARGV[1])
+local arg = 2
+for k = 2, #KEYS, 2 do
+	local count = tonumber(ARGV[arg])
+	for i = arg + 1, arg + count do
+		redis.call("ZADD", KEYS[k], now, ARGV[i])
+		redis.call("SADD", KEYS[k + 1], ARGV[i])
+	end
+	arg = arg + count + 1
+end
+return 1
+`)
+
+// KEYS: instances, online set, then the presence set of every instance.
+// ARGV: ttl ms, then the instances. Drops presence owned by dead instances
+// or not refreshed within ttl and returns the users that are no longer
+// present anywhere.
+var presenceEvictScript = redis.NewScript(presenceNowLua + `local first = 2` + presenceInstanceLua + `
+local cutoff = now - tonumber(ARGV[1])
+local live = redis.call("ZRANGEBYSCORE", KEYS[1], cutoff, "+inf")
+local dead = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", "(" .. cutoff)
+
+for _, inst in ipairs(dead) do
+	redis.call("DEL", presenceOf[inst])
+end
+for _, inst in ipairs(live) do
+	redis.call("ZREMRANGEBYSCORE", presenceOf[inst], "-inf", "(" .. cutoff)
+end
+
+local evicted = {}
+for _, user in ipairs(redis.call("SMEMBERS", KEYS[2])) do
+	local present = false
+	for _, inst in ipairs(live) do
+		if redis.call("ZSCORE", presenceOf[inst], user) then
+			present = true
+			break
+		end
+	end
+	if not present then
+		redis.call("SREM", KEYS[2], user)
+		table.insert(evicted, user)
+	end
+end
+return evicted
+`)
+
+// KEYS: instances. ARGV: ttl ms.
+var presencePruneScript = redis.NewScript(presenceNowLua + `
+return redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", "(" .. (now - 2 * tonumber(ARGV[1])))
+`)
+
+// KEYS: instances. ARGV: instance.
+var presenceShutdownScript = redis.NewScript(`
+return redis.call("ZADD", KEYS[1], "XX", 0, ARGV[1])
+`)
+
+type Presence struct {
+	redis      RedisStore
+	instanceID string
+	ttl        time.Duration
+}
+
+func NewPresence(redis RedisStore, instanceID string, ttl time.Duration) *Presence {
+	return &Presence{redis: redis, instanceID: instanceID, ttl: ttl}
+}
+
+func (p *Presence) InstanceID() string {
+	return p.instanceID
+}
+
+func (p *Presence) presencePrefix(boardID string) string {
+	return boardKey(boardID, "presence:")
+}
+
+// Join marks userID present on boardID through this instance. It reports
+// whether the user was not present anywhere before.
+func (p *Presence) Join(ctx context.Context, boardID string, userID string) (bool, error) {
+	keys := []string{presenceInstancesKey, boardKey(boardID, "online"), p.presencePrefix(boardID) + p.instanceID}
+	added, err := p.redis.RunScript(ctx, presenceJoinScript, keys, p.instanceID, userID)
+	if err != nil {
+		return false, fmt.Errorf("presence join: %w", err)
+	}
+	n, _ := added.(int64)
+	return n == 1, nil
+}
+
+// Leave drops this instance's presence for userID on boardID. It reports
+// whether the user is now gone from every instance.
+func (p *Presence) Leave(ctx context.Context, boardID string, userID string) (bool, error) {
+	removed, err := p.runWithInstances(ctx, presenceLeaveScript, boardID, userID, p.ttl.Milliseconds())
+	if err != nil {
+		return false, fmt.Errorf("presence leave: %w", err)
+	}
+	n, _ := removed.(int64)
+	return n == 1, nil
+}
+
+// Heartbeat refreshes this instance and every user connected through it.
+// connected maps board id to user ids.
+func (p *Presence) Heartbeat(ctx context.Context, connected map[string][]string) error {
+	keys := []string{presenceInstancesKey}
+	args := []interface{}{p.instanceID}
+	for boardID, userIDs := range connected {
+		keys = append(keys, p.presencePrefix(boardID)+p.instanceID, boardKey(boardID, "online"))
+		args = append(args, len(userIDs))
+		for _, userID := range userIDs {
+			args = append(args, userID)
+		}
+	}
+	if _, err := p.redis.RunScript(ctx, presenceHeartbeatScript, keys, args...); err != nil {
+		return fmt.Errorf("presence heartbeat: %w", err)
+	}
+	return nil
+}
+
+// EvictStale removes users on boardID whose owning instances stopped
+// heartbeating and returns their ids.
+func (p *Presence) EvictStale(ctx context.Context, boardID string) ([]string, error) {
+	raw, err := p.runWithInstances(ctx, presenceEvictScript, boardID, p.ttl.Milliseconds())
+	if err != nil {
+		return nil, fmt.Errorf("presence evict: %w", err)
+	}
+	values, _ := raw.([]interface{})
+	evicted := make([]string, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(string); ok {
+			evicted = append(evicted, id)
+		}
+	}
+	return evicted, nil
+}
+
+// runWithInstances runs a script that needs the presence set of every
+// instance on boardID. Scripts can only touch the keys they are passed, so
+// the instances are read first; if one registers in between the script
+// refuses to run and the instances are read again.
+func (p *Presence) runWithInstances(ctx context.Context, script *redis.Script, boardID string, args ...interface{}) (interface{}, error) {
+	for attempt := 1; ; attempt++ {
+		registered, err := p.redis.ZRevRangeWithScores(ctx, presenceInstancesKey, 0, -1)
+		if err != nil {
+			return nil, err
+		}
+		instances := []string{p.instanceID}
+		for _, z := range registered {
+			if inst, ok := z.Member.(string); ok && inst != p.instanceID {
+				instances = append(instances, inst)
+			}
+		}
+
+		keys := []string{presenceInstancesKey, boardKey(boardID, "online")}
+		scriptArgs := append([]interface{}{}, args...)
+		for _, inst := range instances {
+			keys = append(keys, p.presencePrefix(boardID)+inst)
+			scriptArgs = append(scriptArgs, inst)
+		}
+		result, err := p.redis.RunScript(ctx, script, keys, scriptArgs...)
+		if err != nil && strings.Contains(err.Error(), "STALE_INSTANCES") && attempt < 3 {
+			continue
+		}
+		return result, err
+	}
+}
+
+// PruneInstances forgets instances that stopped heartbeating. Call it after
+// EvictStale has run for every board.
+func (p *Presence) PruneInstances(ctx context.Context) error {
+	_, err := p.redis.RunScript(ctx, presencePruneScript, []string{presenceInstancesKey}, p.ttl.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("presence prune: %w", err)
+	}
+	return nil
+}
+
+// Shutdown withdraws this instance so other instances evict its users on
+// their next sweep instead of waiting for the ttl.
+func (p *Presence) Shutdown(ctx context.Context) error {
+	_, err := p.redis.RunScript(ctx, presenceShutdownScript, []string{presenceInstancesKey}, p.instanceID)
+	if err != nil {
+		return fmt.Errorf("presence shutdown: %w", err)
+	}
+	return nil
+}
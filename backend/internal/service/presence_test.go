@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ownthegrid/internal/testenv"
+)
+
+func TestPresenceJoinLeave(t *testing.T) {
+	redis := NewRedisStore(testenv.Redis(t))
+	instances := map[string]*Presence{
+		"a": NewPresence(redis, "a", 30*time.Second),
+		"b": NewPresence(redis, "b", 30*time.Second),
+	}
+	ctx := context.Background()
+
+	// Connections on one instance share its presence; the hub only calls
+	// Leave when an instance's last connection for the user closes.
+	steps := []struct {
+		name     string
+		instance string
+		join     bool
+		user     string
+		want     bool
+		online   int64
+	}{
+		{"first join", "a", true, "alice", true, 1},
+		{"join through a second instance", "b", true, "alice", false, 1},
+		{"another user", "a", true, "bob", true, 2},
+		{"leave one instance", "a", false, "alice", false, 2},
+		{"leave the last instance", "b", false, "alice", true, 1},
+		{"leave twice", "b", false, "alice", false, 1},
+		{"rejoin", "b", true, "alice", true, 2},
+	}
+	for _, step := range steps {
+		p := instances[step.instance]
+		var got bool
+		var err error
+		if step.join {
+			got, err = p.Join(ctx, "main", step.user)
+		} else {
+			got, err = p.Leave(ctx, "main", step.user)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got != step.want {
+			t.Fatalf("%s: got %v, want %v", step.name, got, step.want)
+		}
+		if n, err := redis.SCard(ctx, boardKey("main", "online")); err != nil || n != step.online {
+			t.Fatalf("%s: %d online, %v, want %d", step.name, n, err, step.online)
+		}
+	}
+}
+
+func TestPresenceEvictStale(t *testing.T) {
+	redis := NewRedisStore(testenv.Redis(t))
+	const ttl = time.Second
+	a, b := NewPresence(redis, "a", ttl), NewPresence(redis, "b", ttl)
+	ctx := context.Background()
+	join := func(p *Presence, users ...string) {
+		t.Helper()
+		for _, user := range users {
+			if _, err := p.Join(ctx, "main", user); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	steps := []struct {
+		name   string
+		before func()
+		want   []string
+	}{
+		{
+			name:   "every instance alive",
+			before: func() { join(a, "alice", "bob"); join(b, "bob", "carol") },
+			want:   []string{},
+		},
+		{
+			// A stopped instance's users go unless another still has them.
+			name: "instance shut down",
+			before: func() {
+				if err := b.Shutdown(ctx); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"carol"},
+		},
+		{
+			// Users a live instance stops heartbeating expire on their own.
+			name: "user not heartbeated",
+			before: func() {
+				time.Sleep(ttl + 200*time.Millisecond)
+				if err := a.Heartbeat(ctx, map[string][]string{"main": {"alice"}}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"bob"},
+		},
+		{
+			name: "instance stopped heartbeating",
+			before: func() {
+				join(b, "dave")
+				time.Sleep(ttl + 200*time.Millisecond)
+				if err := a.Heartbeat(ctx, map[string][]string{"main": {"alice"}}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"dave"},
+		},
+	}
+	for _, step := range steps {
+		step.before()
+		evicted, err := a.EvictStale(ctx, "main")
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if len(evicted) != len(step.want) || (len(evicted) == 1 && evicted[0] != step.want[0]) {
+			t.Fatalf("%s: evicted %v, want %v", step.name, evicted, step.want)
+		}
+	}
+
+	online, err := redis.SMembers(ctx, boardKey("main", "online"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(online) != 1 || online[0] != "alice" {
+		t.Fatalf("online = %v, want [alice]", online)
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+)
+
+// SeasonService runs seasons: fixed-length rounds of play after which a
+// board's final state is archived and every tile goes back to unowned.
+type SeasonService struct {
+	repo        *repository.SeasonRepo
+	boards      *BoardService
+	leaderboard *LeaderboardService
+	length      time.Duration
+}
+
+// NewSeasonService returns a service starting seasons of the given length.
+// A length of 0 disables automatic seasons; archived ones can still be
+// browsed.
+func NewSeasonService(
+	repo *repository.SeasonRepo,
+	boards *BoardService,
+	leaderboard *LeaderboardService,
+	length time.Duration,
+) *SeasonService {
+	return &SeasonService{repo: repo, boards: boards, leaderboard: leaderboard, length: length}
+}
+
+func (s *SeasonService) Enabled() bool {
+	return s.length > 0
+}
+
+// Current returns the running season on boardID, or nil when there is none.
+func (s *SeasonService) Current(ctx context.Context, boardID string) (*domain.Season, error) {
+	board, err := s.boards.Get(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.Current(ctx, board.ID)
+}
+
+// List returns boardID's seasons, newest first, with the winners of those
+// that have ended.
+func (s *SeasonService) List(ctx context.Context, boardID string) ([]*domain.Season, error) {
+	board, err := s.boards.Get(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	seasons, err := s.repo.List(ctx, board.ID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(seasons))
+	for _, season := range seasons {
+		if season.EndedAt != nil {
+			ids = append(ids, season.ID)
+		}
+	}
+	winners, winningTeams, err := s.repo.Winners(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, season := range seasons {
+		season.Winners = winners[season.ID]
+		season.WinningTeams = winningTeams[season.ID]
+	}
+	return seasons, nil
+}
+
+// Results returns an ended season's archived standings. A running season
+// has none yet and is returned on its own.
+func (s *SeasonService) Results(ctx context.Context, seasonID int64) (*domain.SeasonResults, error) {
+	season, err := s.repo.GetByID(ctx, seasonID)
+	if err != nil {
+		return nil, err
+	}
+	if season == nil {
+		return nil, domain.ErrSeasonNotFound
+	}
+	results := &domain.SeasonResults{
+		Season:      season,
+		Leaderboard: []domain.LeaderboardEntry{},
+		Teams:       []domain.TeamLeaderboardEntry{},
+	}
+	if season.EndedAt == nil {
+		return results, nil
+	}
+	if results.Leaderboard, err = s.repo.Standings(ctx, season.ID); err != nil {
+		return nil, err
+	}
+	if results.Teams, err = s.repo.TeamStandings(ctx, season.ID); err != nil {
+		return nil, err
+	}
+	for _, entry := range results.Leaderboard {
+		if entry.Rank == 1 {
+			season.Winners = append(season.Winners, entry)
+		}
+	}
+	for _, entry := range results.Teams {
+		if entry.Rank == 1 {
+			season.WinningTeams = append(season.WinningTeams, entry)
+		}
+	}
+	return results, nil
+}
+
+// FinalBoard returns the season and the tiles that were claimed when it
+// ended.
+func (s *SeasonService) FinalBoard(ctx context.Context, seasonID int64) (*domain.Season, []*domain.Tile, error) {
+	season, err := s.repo.GetByID(ctx, seasonID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if season == nil || season.EndedAt == nil {
+		return nil, nil, domain.ErrSeasonNotFound
+	}
+	tiles, err := s.repo.Tiles(ctx, season.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return season, tiles, nil
+}
+
+// Start begins the first season on boardID. It returns nil if a season is
+// already running, for example because another instance got there first.
+func (s *SeasonService) Start(ctx context.Context, boardID string) (*domain.Season, error) {
+	season, err := s.repo.Start(ctx, boardID, time.Now().Add(s.length))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return season, nil
+}
+
+// End archives season, resets its board and starts the next season when
+// seasons are enabled. The board's leaderboards are rebuilt from the reset
+// board before returning. Both seasons are nil if season had already ended.
+func (s *SeasonService) End(ctx context.Context, season *domain.Season) (*domain.Season, *domain.Season, error) {
+	var nextEndsAt *time.Time
+	if s.Enabled() {
+		endsAt := time.Now().Add(s.length)
+		nextEndsAt = &endsAt
+	}
+	ended, next, err := s.repo.End(ctx, season, nextEndsAt)
+	if err != nil {
+		if errors.Is(err, domain.ErrSeasonEnded) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	if _, err := s.leaderboard.Reconcile(ctx, ended.BoardID, true); err != nil {
+		return ended, next, err
+	}
+	return ended, next, nil
+}
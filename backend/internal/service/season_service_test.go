@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+	"ownthegrid/internal/testenv"
+)
+
+func TestSeasonEnd(t *testing.T) {
+	tests := []struct {
+		name     string
+		length   time.Duration
+		wantNext bool
+	}{
+		{"seasons enabled", time.Hour, true},
+		{"seasons disabled", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testenv.Postgres(t)
+			redis := NewRedisStore(testenv.Redis(t))
+			leaderboard, boards := newTestLeaderboard(t, db, redis)
+			seasons := NewSeasonService(repository.NewSeasonRepo(db), boards, leaderboard, tt.length)
+			alice, bob, carol := newTestUser(t, db, "alice"), newTestUser(t, db, "bob"), newTestUser(t, db, "carol")
+			board := newTestBoard(t, boards, "season", 3, 3, alice.ID)
+			color := domain.ColorPalette[1]
+			team, _, err := repository.NewTeamRepo(db).Create(context.Background(), &domain.Team{Name: "reds", Color: &color}, alice.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// alice and bob tie on three tiles, carol has one.
+			owners := []*domain.User{alice, alice, alice, bob, bob, bob, carol}
+			for tile, owner := range owners {
+				setTileOwner(t, db, board.ID, tile, owner.ID, time.Minute)
+			}
+			ctx := context.Background()
+			if _, err := leaderboard.Reconcile(ctx, board.ID, true); err != nil {
+				t.Fatal(err)
+			}
+
+			season, err := seasons.Start(ctx, board.ID)
+			if err != nil || season == nil {
+				t.Fatalf("Start() = %v, %v", season, err)
+			}
+			if again, err := seasons.Start(ctx, board.ID); err != nil || again != nil {
+				t.Fatalf("Start() with a season running = %v, %v, want nil", again, err)
+			}
+
+			ended, next, err := seasons.End(ctx, season)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ended == nil || ended.EndedAt == nil {
+				t.Fatalf("End() ended = %+v", ended)
+			}
+			if (next != nil) != tt.wantNext || (next != nil && next.Number != season.Number+1) {
+				t.Fatalf("End() next = %+v, want one: %v", next, tt.wantNext)
+			}
+			if again, _, err := seasons.End(ctx, season); err != nil || again != nil {
+				t.Fatalf("End() twice = %v, %v, want nil", again, err)
+			}
+
+			// The board is reset and its leaderboards rebuilt from it.
+			counts, err := repository.NewTileRepo(db).OwnerCounts(ctx, board.ID)
+			if err != nil || len(counts) != 0 {
+				t.Fatalf("owners after the reset = %v, %v", counts, err)
+			}
+			if top, err := leaderboard.Top(ctx, board.ID, 10); err != nil || len(top) != 0 {
+				t.Fatalf("leaderboard after the reset = %v, %v", top, err)
+			}
+			if top, err := leaderboard.TopTeams(ctx, board.ID, 10); err != nil || len(top) != 0 {
+				t.Fatalf("team leaderboard after the reset = %v, %v", top, err)
+			}
+
+			results, err := seasons.Results(ctx, season.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantRanks := map[string][2]int{"alice": {1, 3}, "bob": {1, 3}, "carol": {3, 1}}
+			if len(results.Leaderboard) != len(wantRanks) {
+				t.Fatalf("standings = %+v", results.Leaderboard)
+			}
+			for _, entry := range results.Leaderboard {
+				if want := wantRanks[entry.Username]; entry.Rank != want[0] || entry.TileCount != want[1] {
+					t.Fatalf("%s ranked %d with %d tiles, want %v", entry.Username, entry.Rank, entry.TileCount, want)
+				}
+			}
+			if len(results.Season.Winners) != 2 {
+				t.Fatalf("winners = %+v, want alice and bob", results.Season.Winners)
+			}
+			if len(results.Teams) != 1 || results.Teams[0].TeamID != team.ID || results.Teams[0].TileCount != 3 {
+				t.Fatalf("team standings = %+v", results.Teams)
+			}
+
+			_, tiles, err := seasons.FinalBoard(ctx, season.ID)
+			if err != nil || len(tiles) != len(owners) {
+				t.Fatalf("FinalBoard() = %d tiles, %v, want %d", len(tiles), err, len(owners))
+			}
+			if next != nil {
+				if _, _, err := seasons.FinalBoard(ctx, next.ID); !errors.Is(err, domain.ErrSeasonNotFound) {
+					t.Fatalf("FinalBoard() of a running season = %v, want %v", err, domain.ErrSeasonNotFound)
+				}
+			}
+		})
+	}
+}
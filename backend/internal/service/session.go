@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+)
+
+// ValidateToken parses an access token and checks it against the
+// revocation list. Tokens minted before sessions existed carry no session
+// and can't be revoked; they simply run until they expire. API keys are
+// accepted too, and count against their rate limit.
+func (s *UserService) ValidateToken(ctx context.Context, token string) (*Claims, error) {
+	if IsAPIKey(token) {
+		return s.validateAPIKey(ctx, token)
+	}
+	claims, err := parseToken(token, s.keys)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (s *UserService) checkRevoked(ctx context.Context, claims *Claims) error {
+	if claims.SessionID == "" {
+		return nil
+	}
+	revoked, err := s.redis.Exists(ctx, sessionRevokedKey(claims.SessionID))
+	if err != nil {
+		return fmt.Errorf("revocation check: %w", err)
+	}
+	if revoked > 0 {
+		return domain.ErrTokenRevoked
+	}
+	return nil
+}
+
+// JWKS returns the public keys access tokens can be verified with.
+func (s *UserService) JWKS() map[string]interface{} {
+	return s.keys.JWKS()
+}
+
+// Refresh spends refreshToken and returns its user with a fresh access token
+// and the next refresh token of the same session. Presenting a spent token
+// revokes the session and fails with a *domain.TokenReuseError.
+func (s *UserService) Refresh(ctx context.Context, refreshToken string) (*domain.User, error) {
+	if refreshToken == "" {
+		return nil, domain.ErrTokenInvalid
+	}
+	next, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(s.refreshTTL)
+	session, err := s.sessions.Rotate(ctx, hashToken(refreshToken), hashToken(next), expiresAt)
+	if err != nil {
+		var reuse *domain.TokenReuseError
+		if errors.As(err, &reuse) {
+			s.markRevoked(ctx, []domain.Session{reuse.Session})
+		}
+		return nil, err
+	}
+
+	user, err := s.repo.GetByID(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrTokenInvalid
+	}
+	if user.Banned() {
+		return nil, domain.ErrUserBanned
+	}
+	if err := s.issueAccessToken(user, session.ID); err != nil {
+		return nil, err
+	}
+	user.RefreshToken = next
+	return user, nil
+}
+
+// Logout revokes sessions and returns those it revoked so their connections
+// can be closed. With all set every session of the caller goes; otherwise
+// the session of refreshToken, or failing that the one claims came from.
+// claims may be nil when only a refresh token is at hand.
+func (s *UserService) Logout(ctx context.Context, claims *Claims, refreshToken string, all bool) ([]domain.Session, error) {
+	var revoked []domain.Session
+	switch {
+	case all:
+		if claims == nil {
+			return nil, domain.ErrTokenInvalid
+		}
+		userID, err := uuid.Parse(claims.UserID)
+		if err != nil {
+			return nil, domain.ErrTokenInvalid
+		}
+		if revoked, err = s.sessions.RevokeUser(ctx, userID); err != nil {
+			return nil, err
+		}
+	case refreshToken != "":
+		session, err := s.sessions.RevokeByHash(ctx, hashToken(refreshToken))
+		if err != nil {
+			return nil, err
+		}
+		if session != nil {
+			revoked = append(revoked, *session)
+		}
+	case claims != nil && claims.SessionID != "":
+		sessionID, err := uuid.Parse(claims.SessionID)
+		if err != nil {
+			return nil, domain.ErrTokenInvalid
+		}
+		userID, err := uuid.Parse(claims.UserID)
+		if err != nil {
+			return nil, domain.ErrTokenInvalid
+		}
+		if err := s.sessions.RevokeSession(ctx, sessionID); err != nil {
+			return nil, err
+		}
+		revoked = append(revoked, domain.Session{ID: sessionID, UserID: userID})
+	}
+	s.markRevoked(ctx, revoked)
+	return revoked, nil
+}
+
+// startSession opens a new session for user and sets its first tokens on
+// them.
+func (s *UserService) startSession(ctx context.Context, user *domain.User) error {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return err
+	}
+	session := domain.Session{ID: uuid.New(), UserID: user.ID}
+	if err := s.sessions.Create(ctx, session, hashToken(refreshToken), time.Now().Add(s.refreshTTL)); err != nil {
+		return err
+	}
+	if err := s.issueAccessToken(user, session.ID); err != nil {
+		return err
+	}
+	user.RefreshToken = refreshToken
+	return nil
+}
+
+func (s *UserService) issueAccessToken(user *domain.User, sessionID uuid.UUID) error {
+	expiresAt := time.Now().Add(s.accessTTL)
+	token, err := buildToken(user.ID, user.Username, user.Role, sessionID, s.keys, expiresAt)
+	if err != nil {
+		return fmt.Errorf("token: %w", err)
+	}
+	user.Token = token
+	user.TokenExpiresAt = &expiresAt
+	return nil
+}
+
+// markRevoked puts sessions on the revocation list for as long as an access
+// token minted from them could still be valid. Their refresh tokens are
+// already revoked in Postgres, so on failure the access tokens merely run
+// until they expire.
+func (s *UserService) markRevoked(ctx context.Context, sessions []domain.Session) {
+	for _, session := range sessions {
+		if err := s.redis.Set(ctx, sessionRevokedKey(session.ID.String()), 1, s.accessTTL); err != nil {
+			log.Printf("Revoke session %s failed: %v", session.ID, err)
+		}
+	}
+}
+
+func sessionRevokedKey(sessionID string) string {
+	return "session:" + sessionID + ":revoked"
+}
+
+// randomToken returns 32 random bytes, base64url encoded, for tokens that
+// are looked up by their hash rather than verified.
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+	"ownthegrid/internal/testenv"
+)
+
+func TestRefreshReuse(t *testing.T) {
+	db := testenv.Postgres(t)
+	redis := NewRedisStore(testenv.Redis(t))
+	keys, err := NewKeySet(nil, "", testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewUserService(
+		repository.NewUserRepo(db), repository.NewSessionRepo(db), repository.NewCredentialRepo(db),
+		repository.NewAPIKeyRepo(db), redis, nil, keys, 15*time.Minute, time.Hour, 60,
+	)
+	ctx := context.Background()
+
+	registered, err := users.Register(ctx, "alice", "correct horse", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := users.Login(ctx, "alice", "correct horse", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tokens holds every refresh and access token handed out, by name.
+	tokens := map[string]*domain.User{"first": registered, "other session": other}
+	steps := []struct {
+		name       string
+		refresh    string // token to refresh
+		saveAs     string
+		wantErr    error
+		wantReuse  bool
+		validate   string // access token to check afterwards
+		wantAccess error
+	}{
+		{name: "rotate", refresh: "first", saveAs: "second", validate: "second"},
+		{name: "rotate again", refresh: "second", saveAs: "third", validate: "third"},
+		{name: "spent token", refresh: "first", wantErr: domain.ErrTokenRevoked, wantReuse: true, validate: "third", wantAccess: domain.ErrTokenRevoked},
+		{name: "latest token of the revoked session", refresh: "third", wantErr: domain.ErrTokenInvalid},
+		{name: "other sessions keep working", refresh: "other session", saveAs: "other next", validate: "other next"},
+		{name: "unknown token", wantErr: domain.ErrTokenInvalid},
+	}
+	for _, step := range steps {
+		token := "not-a-token"
+		if user := tokens[step.refresh]; user != nil {
+			token = user.RefreshToken
+		}
+		user, err := users.Refresh(ctx, token)
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: Refresh() error = %v, want %v", step.name, err, step.wantErr)
+		}
+		var reuse *domain.TokenReuseError
+		if errors.As(err, &reuse) != step.wantReuse {
+			t.Fatalf("%s: Refresh() error = %v, want reuse %v", step.name, err, step.wantReuse)
+		}
+		if step.saveAs != "" {
+			if user.RefreshToken == "" || user.RefreshToken == token || user.Token == "" {
+				t.Fatalf("%s: Refresh() gave refresh %q, access %q", step.name, user.RefreshToken, user.Token)
+			}
+			tokens[step.saveAs] = user
+		}
+		if step.validate != "" {
+			if _, err := users.ValidateToken(ctx, tokens[step.validate].Token); !errors.Is(err, step.wantAccess) {
+				t.Fatalf("%s: ValidateToken() = %v, want %v", step.name, err, step.wantAccess)
+			}
+		}
+	}
+}
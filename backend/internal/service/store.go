@@ -10,12 +10,17 @@ import (
 type RedisStore interface {
 	Exists(ctx context.Context, key string) (int64, error)
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	GetDel(ctx context.Context, key string) (string, error)
 	ZIncrBy(ctx context.Context, key string, increment float64, member string) error
+	ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error)
+	ZScore(ctx context.Context, key string, member string) (float64, error)
+	ZCount(ctx context.Context, key string, min, max string) (int64, error)
 	TTL(ctx context.Context, key string) (time.Duration, error)
 	SCard(ctx context.Context, key string) (int64, error)
 	SAdd(ctx context.Context, key string, members ...interface{}) error
 	SRem(ctx context.Context, key string, members ...interface{}) error
 	SMembers(ctx context.Context, key string) ([]string, error)
+	RunScript(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error)
 }
 
 type RedisStoreAdapter struct {
@@ -34,10 +39,31 @@ func (r *RedisStoreAdapter) Set(ctx context.Context, key string, value interface
 	return r.client.Set(ctx, key, value, expiration).Err()
 }
 
+// GetDel returns the value of key and deletes it, or "" if there is none.
+func (r *RedisStoreAdapter) GetDel(ctx context.Context, key string) (string, error) {
+	value, err := r.client.GetDel(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
 func (r *RedisStoreAdapter) ZIncrBy(ctx context.Context, key string, increment float64, member string) error {
 	return r.client.ZIncrBy(ctx, key, increment, member).Err()
 }
 
+func (r *RedisStoreAdapter) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
+	return r.client.ZRevRangeWithScores(ctx, key, start, stop).Result()
+}
+
+func (r *RedisStoreAdapter) ZScore(ctx context.Context, key string, member string) (float64, error) {
+	return r.client.ZScore(ctx, key, member).Result()
+}
+
+func (r *RedisStoreAdapter) ZCount(ctx context.Context, key string, min, max string) (int64, error) {
+	return r.client.ZCount(ctx, key, min, max).Result()
+}
+
 func (r *RedisStoreAdapter) TTL(ctx context.Context, key string) (time.Duration, error) {
 	return r.client.TTL(ctx, key).Result()
 }
@@ -57,3 +83,7 @@ func (r *RedisStoreAdapter) SRem(ctx context.Context, key string, members ...int
 func (r *RedisStoreAdapter) SMembers(ctx context.Context, key string) ([]string, error) {
 	return r.client.SMembers(ctx, key).Result()
 }
+
+func (r *RedisStoreAdapter) RunScript(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	return script.Run(ctx, r.client, keys, args...).Result()
+}
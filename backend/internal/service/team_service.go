@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+)
+
+const maxTeamNameLength = 32
+
+var teamColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// TeamService manages teams and membership. A user is in at most one team;
+// joining another team leaves the current one, and a team is deleted once
+// its last member leaves.
+type TeamService struct {
+	repo        *repository.TeamRepo
+	boards      *BoardService
+	leaderboard *LeaderboardService
+}
+
+func NewTeamService(repo *repository.TeamRepo, boards *BoardService, leaderboard *LeaderboardService) *TeamService {
+	return &TeamService{repo: repo, boards: boards, leaderboard: leaderboard}
+}
+
+func (s *TeamService) List(ctx context.Context) ([]*domain.Team, error) {
+	return s.repo.List(ctx)
+}
+
+// Get returns the team with its members.
+func (s *TeamService) Get(ctx context.Context, id uuid.UUID) (*domain.Team, error) {
+	team, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if team == nil {
+		return nil, domain.ErrTeamNotFound
+	}
+	members, err := s.repo.Members(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	team.Members = members
+	return team, nil
+}
+
+// Create makes a new team with userID as its first member. color may be
+// empty, in which case members keep their own colors.
+func (s *TeamService) Create(ctx context.Context, name string, color string, userID uuid.UUID) (*domain.Team, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("team name is required")
+	}
+	if len(name) > maxTeamNameLength {
+		return nil, errors.New("team name must be at most 32 characters")
+	}
+	team := &domain.Team{Name: name}
+	if color = strings.TrimSpace(color); color != "" {
+		if !teamColorPattern.MatchString(color) {
+			return nil, errors.New("team color must look like #RRGGBB")
+		}
+		color = strings.ToUpper(color)
+		team.Color = &color
+	}
+
+	created, previous, err := s.repo.Create(ctx, team, userID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, domain.ErrTeamExists
+		}
+		return nil, err
+	}
+	s.moveScores(ctx, userID, previous, &created.ID)
+	return created, nil
+}
+
+// Join moves userID into teamID, leaving their current team if they have
+// one.
+func (s *TeamService) Join(ctx context.Context, teamID uuid.UUID, userID uuid.UUID) (*domain.Team, error) {
+	previous, err := s.repo.SetMembership(ctx, userID, &teamID)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil || *previous != teamID {
+		s.moveScores(ctx, userID, previous, &teamID)
+	}
+	return s.Get(ctx, teamID)
+}
+
+func (s *TeamService) Leave(ctx context.Context, userID uuid.UUID) error {
+	previous, err := s.repo.SetMembership(ctx, userID, nil)
+	if err != nil {
+		return err
+	}
+	if previous == nil {
+		return domain.ErrNotInTeam
+	}
+	s.moveScores(ctx, userID, previous, nil)
+	return nil
+}
+
+// moveScores carries the user's tiles over to their new team on every board.
+// Failures only leave the team leaderboard stale until the next reconcile.
+func (s *TeamService) moveScores(ctx context.Context, userID uuid.UUID, from, to *uuid.UUID) {
+	if from == nil && to == nil {
+		return
+	}
+	boards, err := s.boards.List(ctx)
+	if err != nil {
+		log.Printf("Team leaderboard: failed to list boards: %v", err)
+		return
+	}
+	for _, board := range boards {
+		if err := s.leaderboard.MoveTeamScore(ctx, board.ID, userID, from, to); err != nil {
+			log.Printf("Team leaderboard: failed to move %s on board %s: %v", userID, board.ID, err)
+		}
+	}
+}
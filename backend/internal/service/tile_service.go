@@ -2,7 +2,8 @@ package service
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"log"
 
 	"github.com/google/uuid"
 
@@ -11,87 +12,229 @@ import (
 )
 
 type TileService struct {
-	repo       *repository.TileRepo
-	redis      RedisStore
-	gridWidth  int
-	gridHeight int
+	repo    *repository.TileRepo
+	boards  *BoardService
+	redis   RedisStore
+	capture domain.CaptureRules
+	limiter *ClaimLimiter
 }
 
 func NewTileService(
 	repo *repository.TileRepo,
+	boards *BoardService,
 	redis RedisStore,
-	gridWidth int,
-	gridHeight int,
+	capture domain.CaptureRules,
+	limiter *ClaimLimiter,
 ) *TileService {
 	return &TileService{
-		repo:       repo,
-		redis:      redis,
-		gridWidth:  gridWidth,
-		gridHeight: gridHeight,
+		repo:    repo,
+		boards:  boards,
+		redis:   redis,
+		capture: capture,
+		limiter: limiter,
 	}
 }
 
-func (s *TileService) ClaimTile(ctx context.Context, tileID int, userID uuid.UUID) (*domain.Tile, error) {
-	if tileID < 0 || tileID >= s.gridWidth*s.gridHeight {
+func (s *TileService) ClaimTile(ctx context.Context, boardID string, tileID int, userID uuid.UUID) (*domain.ClaimResult, error) {
+	board, err := s.boards.Get(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	if !board.Contains(tileID) {
 		return nil, domain.ErrTileInvalid
 	}
 
-	tile, err := s.repo.ClaimTile(ctx, tileID, userID)
+	// A capture costs more than a claim, so the tile's owner is looked up
+	// first to take the right number of tokens before claiming.
+	captured := false
+	if s.capture.Enabled {
+		owner, err := s.repo.TileOwner(ctx, board.ID, tileID)
+		if err != nil {
+			return nil, err
+		}
+		captured = owner != nil && *owner != userID
+	}
+	cost := s.claimCost(captured)
+	if err := s.limiter.Allow(ctx, userID, cost); err != nil {
+		return nil, err
+	}
+
+	result, err := s.repo.ClaimTile(ctx, board.ID, tileID, userID, s.capture, nil)
 	if err != nil {
+		if rejectedClaim(err) {
+			s.refund(ctx, userID, tileID, cost)
+		}
 		return nil, err
 	}
 
-	if err := s.redis.ZIncrBy(ctx, "board:leaderboard", 1, userID.String()); err != nil {
-		return nil, fmt.Errorf("leaderboard update: %w", err)
+	// The tile changed hands between the lookup and the claim, so the claim
+	// cost more or less than was taken. It has committed by now, so failing to
+	// settle the difference is only logged; the client still has to hear that
+	// it went through.
+	if extra := s.claimCost(result.Captured()) - cost; extra > 0 {
+		if err := s.limiter.Charge(ctx, userID, extra); err != nil {
+			log.Printf("Charge capture of tile %d by %s failed: %v", tileID, userID, err)
+		}
+	} else if extra < 0 {
+		s.refund(ctx, userID, tileID, -extra)
+	}
+
+	s.updateLeaderboards(ctx, board.ID, result)
+	return result, nil
+}
+
+// claimCost returns how many limiter tokens a claim takes.
+func (s *TileService) claimCost(captured bool) int {
+	if captured {
+		return s.capture.Cost
 	}
+	return 1
+}
 
-	return tile, nil
+func (s *TileService) refund(ctx context.Context, userID uuid.UUID, tileID int, cost int) {
+	if err := s.limiter.Refund(ctx, userID, cost); err != nil {
+		log.Printf("Refund claim of tile %d by %s failed: %v", tileID, userID, err)
+	}
 }
 
-func (s *TileService) GetAllTiles(ctx context.Context) ([]*domain.Tile, error) {
-	return s.repo.GetAllTilesWithOwners(ctx)
+// rejectedClaim reports whether err is the game turning a claim down, as
+// opposed to the claim failing.
+func rejectedClaim(err error) bool {
+	return errors.Is(err, domain.ErrTileAlreadyClaimed) ||
+		errors.Is(err, domain.ErrTileProtected) ||
+		errors.Is(err, domain.ErrTileNotAdjacent)
 }
 
-func (s *TileService) GridSize() (int, int) {
-	return s.gridWidth, s.gridHeight
+// Reassign hands tileID to userID whoever holds it, skipping the claim
+// limiter and capture rules. It fails with domain.ErrTileAlreadyClaimed if
+// userID already owns the tile. audit, if not nil, is recorded along with
+// the claim.
+func (s *TileService) Reassign(ctx context.Context, boardID string, tileID int, userID uuid.UUID, audit *domain.AuditEntry) (*domain.ClaimResult, error) {
+	board, err := s.boards.Get(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	if !board.Contains(tileID) {
+		return nil, domain.ErrTileInvalid
+	}
+	result, err := s.repo.ClaimTile(ctx, board.ID, tileID, userID, domain.CaptureRules{Enabled: true}, audit)
+	if err != nil {
+		return nil, err
+	}
+	s.updateLeaderboards(ctx, board.ID, result)
+	return result, nil
 }
 
-func (s *TileService) SeedIfNeeded(ctx context.Context) error {
-	count, err := s.repo.TileCount(ctx)
+// ResetRegion unclaims every tile inside vp and returns how many there were.
+// The rectangle is clamped to the board first and returned as applied.
+// audit, if not nil, is recorded along with the reset.
+func (s *TileService) ResetRegion(ctx context.Context, boardID string, vp domain.Viewport, audit *domain.AuditEntry) (domain.Viewport, int, error) {
+	board, err := s.boards.Get(ctx, boardID)
+	if err != nil {
+		return domain.Viewport{}, 0, err
+	}
+	vp, err = vp.ClampTo(board)
 	if err != nil {
-		return fmt.Errorf("SeedIfNeeded: %w", err)
+		return domain.Viewport{}, 0, err
 	}
-	if count == 0 {
-		if err := s.repo.SeedTiles(ctx, s.gridWidth, s.gridHeight); err != nil {
-			return fmt.Errorf("SeedIfNeeded: %w", err)
+	count, err := s.repo.ResetRegion(ctx, board.ID, vp, audit)
+	if err != nil {
+		return domain.Viewport{}, 0, err
+	}
+	return vp, count, nil
+}
+
+// updateLeaderboards moves the claimed tile's point from its previous owner
+// and team to its new ones. The claim has already committed, so failures are
+// only logged; the leaderboard reconcile repairs the sorted sets.
+func (s *TileService) updateLeaderboards(ctx context.Context, boardID string, result *domain.ClaimResult) {
+	type increment struct {
+		key    string
+		by     float64
+		member string
+	}
+	leaderboardKey := boardKey(boardID, "leaderboard")
+	teamKey := boardKey(boardID, "team-leaderboard")
+	increments := []increment{{leaderboardKey, 1, result.Tile.OwnerID.String()}}
+	if result.Captured() {
+		increments = append(increments, increment{leaderboardKey, -1, result.PreviousOwnerID.String()})
+	}
+	if teamID := result.Tile.OwnerTeamID; teamID != nil {
+		increments = append(increments, increment{teamKey, 1, teamID.String()})
+	}
+	if result.PreviousTeamID != nil {
+		increments = append(increments, increment{teamKey, -1, result.PreviousTeamID.String()})
+	}
+
+	for _, inc := range increments {
+		if err := s.redis.ZIncrBy(ctx, inc.key, inc.by, inc.member); err != nil {
+			log.Printf("Leaderboard update of %s in %s failed: %v", inc.member, inc.key, err)
 		}
 	}
-	return nil
 }
 
-func (s *TileService) GetBoardStats(ctx context.Context, onlineCount int, totalUsers int) (map[string]interface{}, error) {
-	_, claimed, err := s.repo.CountTiles(ctx)
+func (s *TileService) GetAllTiles(ctx context.Context, boardID string) ([]*domain.Tile, error) {
+	return s.repo.GetAllTilesWithOwners(ctx, boardID)
+}
+
+func (s *TileService) GetTilesInViewport(ctx context.Context, boardID string, vp domain.Viewport) ([]*domain.Tile, error) {
+	return s.repo.GetTilesInViewport(ctx, boardID, vp)
+}
+
+// GetChunkVersion returns the version of chunk cx, cy on board.
+func (s *TileService) GetChunkVersion(ctx context.Context, board *domain.Board, cx, cy int) (int64, error) {
+	if _, ok := board.ChunkBounds(cx, cy); !ok {
+		return 0, domain.ErrChunkNotFound
+	}
+	return s.repo.ChunkVersion(ctx, board.ID, cx, cy)
+}
+
+func (s *TileService) GetChunk(ctx context.Context, board *domain.Board, cx, cy int) (*domain.Chunk, error) {
+	bounds, ok := board.ChunkBounds(cx, cy)
+	if !ok {
+		return nil, domain.ErrChunkNotFound
+	}
+	return s.repo.GetChunk(ctx, board.ID, cx, cy, bounds)
+}
+
+func (s *TileService) GetBoardStats(ctx context.Context, board *domain.Board, onlineCount int, totalUsers int) (map[string]interface{}, error) {
+	_, claimed, err := s.repo.CountTiles(ctx, board.ID)
 	if err != nil {
 		return nil, err
 	}
-	lastActivity, err := s.repo.LastActivity(ctx)
+	lastActivity, err := s.repo.LastActivity(ctx, board.ID)
 	if err != nil {
 		return nil, err
 	}
-	// Use grid dimensions from config, not DB count (migration may have different size)
-	total := s.gridWidth * s.gridHeight
+	teams, err := s.repo.TeamTerritory(ctx, board.ID)
+	if err != nil {
+		return nil, err
+	}
+	rankTeams(teams)
+	teamTiles := 0
+	for _, team := range teams {
+		teamTiles += team.TileCount
+	}
+	total := board.TileCount()
 	unclaimed := total - claimed
 	// Ensure unclaimed doesn't go negative if DB has more claimed tiles than expected
 	if unclaimed < 0 {
 		unclaimed = 0
 	}
 	payload := map[string]interface{}{
+		"boardId":        board.ID,
 		"totalTiles":     total,
 		"claimedTiles":   claimed,
 		"unclaimedTiles": unclaimed,
 		"onlineUsers":    onlineCount,
 		"totalUsers":     totalUsers,
 		"lastActivity":   lastActivity,
+		"teamTiles":      teamTiles,
+		"teams":          teams,
 	}
 	return payload, nil
 }
+
+func boardKey(boardID string, suffix string) string {
+	return "board:" + boardID + ":" + suffix
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+	"ownthegrid/internal/testenv"
+)
+
+func TestClaimTileCaptureCost(t *testing.T) {
+	db := testenv.Postgres(t)
+	redis := NewRedisStore(testenv.Redis(t))
+	boards := NewBoardService(repository.NewBoardRepo(db))
+	rules := domain.CaptureRules{Enabled: true, Cost: 3}
+	// One token a second, so the bucket barely refills while the test runs.
+	tiles := NewTileService(repository.NewTileRepo(db), boards, redis, rules, NewClaimLimiter(redis, 1, 3, 0))
+
+	alice, bob, carol := newTestUser(t, db, "alice"), newTestUser(t, db, "bob"), newTestUser(t, db, "carol")
+	board := newTestBoard(t, boards, "cost", 4, 4, alice.ID)
+	setTileOwner(t, db, board.ID, 0, alice.ID, time.Hour)
+	setTileOwner(t, db, board.ID, 1, alice.ID, time.Hour)
+	ctx := context.Background()
+
+	// A full bucket pays for a capture and nothing more.
+	result, err := tiles.ClaimTile(ctx, board.ID, 0, bob.ID)
+	if err != nil {
+		t.Fatalf("capture with a full bucket: %v", err)
+	}
+	if !result.Captured() || *result.PreviousOwnerID != alice.ID {
+		t.Fatalf("previous owner = %v, want %s", result.PreviousOwnerID, alice.ID)
+	}
+	var rateErr *domain.RateLimitError
+	if _, err := tiles.ClaimTile(ctx, board.ID, 5, bob.ID); !errors.As(err, &rateErr) {
+		t.Fatalf("claim with an empty bucket = %v, want a rate limit error", err)
+	}
+
+	// With only one token left a capture is turned away before the tile
+	// changes hands, and says how long until three tokens are back.
+	for _, tile := range []int{8, 9} {
+		if _, err := tiles.ClaimTile(ctx, board.ID, tile, carol.ID); err != nil {
+			t.Fatalf("claim %d: %v", tile, err)
+		}
+	}
+	_, err = tiles.ClaimTile(ctx, board.ID, 1, carol.ID)
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("capture with one token = %v, want a rate limit error", err)
+	}
+	if rateErr.RetryAfter <= time.Second || rateErr.RetryAfter > 2*time.Second {
+		t.Fatalf("retry after %v, want just under 2s", rateErr.RetryAfter)
+	}
+	owner, err := repository.NewTileRepo(db).TileOwner(ctx, board.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner == nil || *owner != alice.ID {
+		t.Fatalf("tile owner after a refused capture = %v, want %s", owner, alice.ID)
+	}
+}
+
+func TestClaimTileRejectionRefunds(t *testing.T) {
+	db := testenv.Postgres(t)
+	redis := NewRedisStore(testenv.Redis(t))
+	boards := NewBoardService(repository.NewBoardRepo(db))
+	rules := domain.CaptureRules{Enabled: true, ProtectionWindow: time.Hour, Cost: 2}
+	tiles := NewTileService(repository.NewTileRepo(db), boards, redis, rules, NewClaimLimiter(redis, 1, 2, 0))
+
+	alice, bob := newTestUser(t, db, "alice"), newTestUser(t, db, "bob")
+	board := newTestBoard(t, boards, "refunds", 4, 4, alice.ID)
+	setTileOwner(t, db, board.ID, 0, alice.ID, time.Minute)
+	setTileOwner(t, db, board.ID, 1, bob.ID, time.Hour)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		tile    int
+		wantErr error
+	}{
+		{"protected tile", 0, domain.ErrTileProtected},
+		{"own tile", 1, domain.ErrTileAlreadyClaimed},
+		{"protected tile again", 0, domain.ErrTileProtected},
+	}
+	for _, tt := range tests {
+		if _, err := tiles.ClaimTile(ctx, board.ID, tt.tile, bob.ID); !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: ClaimTile() = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// None of the rejections cost anything, so the bucket still holds the
+	// two tokens a capture-sized claim needs.
+	if err := tiles.limiter.Allow(ctx, bob.ID, 2); err != nil {
+		t.Fatalf("Allow() after rejected claims = %v, want the full burst left", err)
+	}
+}
@@ -18,26 +18,73 @@ import (
 var ErrUsernameTaken = errors.New("username already taken")
 
 type UserService struct {
-	repo      *repository.UserRepo
-	redis     RedisStore
-	jwtSecret string
-	tokenTTL  time.Duration
+	repo        *repository.UserRepo
+	sessions    *repository.SessionRepo
+	credentials *repository.CredentialRepo
+	apiKeys     *repository.APIKeyRepo
+	redis       RedisStore
+	presence    *Presence
+	keys        *KeySet
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	apiKeyRate  int
 }
 
-func NewUserService(repo *repository.UserRepo, redis RedisStore, jwtSecret string, tokenTTL time.Duration) *UserService {
+// NewUserService returns a service issuing access tokens signed with keys
+// that live for accessTTL, and refresh tokens that live for refreshTTL. API
+// keys are allowed at most apiKeyRate requests a minute.
+func NewUserService(
+	repo *repository.UserRepo,
+	sessions *repository.SessionRepo,
+	credentials *repository.CredentialRepo,
+	apiKeys *repository.APIKeyRepo,
+	redis RedisStore,
+	presence *Presence,
+	keys *KeySet,
+	accessTTL time.Duration,
+	refreshTTL time.Duration,
+	apiKeyRate int,
+) *UserService {
 	return &UserService{
-		repo:      repo,
-		redis:     redis,
-		jwtSecret: jwtSecret,
-		tokenTTL:  tokenTTL,
+		repo:        repo,
+		sessions:    sessions,
+		credentials: credentials,
+		apiKeys:     apiKeys,
+		redis:       redis,
+		presence:    presence,
+		keys:        keys,
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+		apiKeyRate:  apiKeyRate,
 	}
 }
 
-func (s *UserService) Register(ctx context.Context, username string) (*domain.User, error) {
+// Register creates a user, with a password if one is given, and starts
+// their first session. The returned user carries their recovery codes, which
+// are never shown again. ip is the client's address, for rate limiting.
+func (s *UserService) Register(ctx context.Context, username string, password string, ip string) (*domain.User, error) {
 	username = strings.TrimSpace(username)
 	if username == "" {
 		return nil, errors.New("username is required")
 	}
+	if password != "" {
+		if err := validatePassword(password); err != nil {
+			return nil, err
+		}
+	}
+	if ip != "" {
+		if err := s.allowWindow(ctx, "ratelimit:register:"+ip, registerIPLimit, registerWindow); err != nil {
+			return nil, err
+		}
+	}
+	var passwordHash *string
+	if password != "" {
+		hash, err := hashPassword(ctx, password)
+		if err != nil {
+			return nil, err
+		}
+		passwordHash = &hash
+	}
 
 	existing, err := s.repo.GetByUsername(ctx, username)
 	if err != nil {
@@ -47,9 +94,13 @@ func (s *UserService) Register(ctx context.Context, username string) (*domain.Us
 		return nil, ErrUsernameTaken
 	}
 
+	codes, codeHashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
 	color := pickColor()
 	user := &domain.User{Username: username, Color: color}
-	created, err := s.repo.Create(ctx, user)
+	created, err := s.repo.Create(ctx, user, passwordHash, codeHashes)
 	if err != nil {
 		if isUniqueViolation(err) {
 			return nil, ErrUsernameTaken
@@ -57,11 +108,10 @@ func (s *UserService) Register(ctx context.Context, username string) (*domain.Us
 		return nil, err
 	}
 
-	token, err := buildToken(created.ID, created.Username, s.jwtSecret, s.tokenTTL)
-	if err != nil {
-		return nil, fmt.Errorf("token: %w", err)
+	if err := s.startSession(ctx, created); err != nil {
+		return nil, err
 	}
-	created.Token = token
+	created.RecoveryCodes = codes
 	return created, nil
 }
 
@@ -69,46 +119,81 @@ func (s *UserService) GetByID(ctx context.Context, id uuid.UUID) (*domain.User,
 	return s.repo.GetByID(ctx, id)
 }
 
-func (s *UserService) ValidateToken(token string) (*Claims, error) {
-	return parseToken(token, s.jwtSecret)
+// SetRole gives the user called username role and returns them with a new
+// session whose tokens carry it.
+func (s *UserService) SetRole(ctx context.Context, username string, role string) (*domain.User, error) {
+	if role != domain.RoleUser && role != domain.RoleAdmin {
+		return nil, fmt.Errorf("unknown role %q", role)
+	}
+	user, err := s.repo.SetRole(ctx, strings.TrimSpace(username), role)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	if err := s.startSession(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
 func (s *UserService) UpdateLastSeen(ctx context.Context, id uuid.UUID) error {
 	return s.repo.UpdateLastSeen(ctx, id)
 }
 
-func (s *UserService) GetLeaderboard(ctx context.Context, limit int) ([]repository.LeaderboardEntry, error) {
-	return s.repo.GetLeaderboard(ctx, limit)
-}
-
 func (s *UserService) CountUsers(ctx context.Context) (int, error) {
 	return s.repo.CountUsers(ctx)
 }
 
-func (s *UserService) OnlineCount(ctx context.Context) (int, error) {
-	count, err := s.redis.SCard(ctx, "board:online")
+func (s *UserService) OnlineCount(ctx context.Context, boardID string) (int, error) {
+	count, err := s.redis.SCard(ctx, boardKey(boardID, "online"))
 	if err != nil {
 		return 0, fmt.Errorf("online count: %w", err)
 	}
 	return int(count), nil
 }
 
-func (s *UserService) SetOnline(ctx context.Context, userID uuid.UUID) error {
-	if err := s.redis.SAdd(ctx, "board:online", userID.String()); err != nil {
-		return fmt.Errorf("set online: %w", err)
+// SetOnline records the user as connected to boardID through this instance
+// and reports whether they just came online.
+func (s *UserService) SetOnline(ctx context.Context, boardID string, userID uuid.UUID) (bool, error) {
+	joined, err := s.presence.Join(ctx, boardID, userID.String())
+	if err != nil {
+		return false, fmt.Errorf("set online: %w", err)
 	}
-	return nil
+	return joined, nil
 }
 
-func (s *UserService) SetOffline(ctx context.Context, userID uuid.UUID) error {
-	if err := s.redis.SRem(ctx, "board:online", userID.String()); err != nil {
-		return fmt.Errorf("set offline: %w", err)
+// SetOffline drops this instance's presence for the user and reports whether
+// they are now offline everywhere.
+func (s *UserService) SetOffline(ctx context.Context, boardID string, userID uuid.UUID) (bool, error) {
+	left, err := s.presence.Leave(ctx, boardID, userID.String())
+	if err != nil {
+		return false, fmt.Errorf("set offline: %w", err)
+	}
+	return left, nil
+}
+
+// EvictStalePresence removes users whose owning instance stopped
+// heartbeating and returns them.
+func (s *UserService) EvictStalePresence(ctx context.Context, boardID string) ([]*domain.User, error) {
+	ids, err := s.presence.EvictStale(ctx, boardID)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	parsed := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		uid, err := uuid.Parse(id)
+		if err != nil {
+			continue
+		}
+		parsed = append(parsed, uid)
+	}
+	return s.repo.GetByIDs(ctx, parsed)
 }
 
-func (s *UserService) ListOnlineUsers(ctx context.Context) ([]*domain.User, error) {
-	ids, err := s.redis.SMembers(ctx, "board:online")
+func (s *UserService) ListOnlineUsers(ctx context.Context, boardID string) ([]*domain.User, error) {
+	ids, err := s.redis.SMembers(ctx, boardKey(boardID, "online"))
 	if err != nil {
 		return nil, fmt.Errorf("online users: %w", err)
 	}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ownthegrid/internal/domain"
+)
+
+// WSTicketTTL is how long a WebSocket ticket can be redeemed for.
+const WSTicketTTL = 30 * time.Second
+
+// IssueWSTicket returns a single-use ticket that opens one WebSocket
+// connection as the holder of claims. It keeps access tokens out of the
+// upgrade URL, where proxies and access logs would see them.
+func (s *UserService) IssueWSTicket(ctx context.Context, claims *Claims) (string, error) {
+	ticket, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("ws ticket: %w", err)
+	}
+	if err := s.redis.Set(ctx, wsTicketKey(ticket), payload, WSTicketTTL); err != nil {
+		return "", fmt.Errorf("ws ticket: %w", err)
+	}
+	return ticket, nil
+}
+
+// RedeemWSTicket spends ticket and returns the claims it was issued for. An
+// unknown, expired or already redeemed ticket is domain.ErrTokenInvalid; one
+// whose session or API key has been revoked since is domain.ErrTokenRevoked.
+func (s *UserService) RedeemWSTicket(ctx context.Context, ticket string) (*Claims, error) {
+	raw, err := s.redis.GetDel(ctx, wsTicketKey(ticket))
+	if err != nil {
+		return nil, fmt.Errorf("ws ticket: %w", err)
+	}
+	if raw == "" {
+		return nil, domain.ErrTokenInvalid
+	}
+	claims := &Claims{}
+	if err := json.Unmarshal([]byte(raw), claims); err != nil {
+		return nil, fmt.Errorf("ws ticket: %w", err)
+	}
+	if err := s.checkRevoked(ctx, claims); err != nil {
+		return nil, err
+	}
+	if claims.APIKeyID != "" {
+		keyID, err := uuid.Parse(claims.APIKeyID)
+		if err != nil {
+			return nil, domain.ErrTokenInvalid
+		}
+		live, err := s.apiKeys.IsLive(ctx, keyID)
+		if err != nil {
+			return nil, err
+		}
+		if !live {
+			return nil, domain.ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+func wsTicketKey(ticket string) string {
+	return "wsticket:" + hashToken(ticket)
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"ownthegrid/internal/domain"
+	"ownthegrid/internal/repository"
+	"ownthegrid/internal/testenv"
+)
+
+func TestRedeemWSTicket(t *testing.T) {
+	db := testenv.Postgres(t)
+	redis := NewRedisStore(testenv.Redis(t))
+	keys, err := NewKeySet(nil, "", testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := NewUserService(
+		repository.NewUserRepo(db), repository.NewSessionRepo(db), repository.NewCredentialRepo(db),
+		repository.NewAPIKeyRepo(db), redis, nil, keys, 15*time.Minute, time.Hour, 60,
+	)
+	ctx := context.Background()
+
+	alice, err := users.Register(ctx, "alice", "correct horse", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := users.ValidateToken(ctx, alice.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issue := func() string {
+		ticket, err := users.IssueWSTicket(ctx, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ticket
+	}
+	first, second := issue(), issue()
+
+	steps := []struct {
+		name    string
+		ticket  string
+		logout  bool // revoke alice's session first
+		wantErr error
+	}{
+		{name: "fresh ticket", ticket: first},
+		{name: "redeemed twice", ticket: first, wantErr: domain.ErrTokenInvalid},
+		{name: "unknown ticket", ticket: "not-a-ticket", wantErr: domain.ErrTokenInvalid},
+		{name: "session revoked since", ticket: second, logout: true, wantErr: domain.ErrTokenRevoked},
+	}
+	for _, step := range steps {
+		if step.logout {
+			if _, err := users.Logout(ctx, claims, "", false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := users.RedeemWSTicket(ctx, step.ticket)
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: RedeemWSTicket() = %v, want %v", step.name, err, step.wantErr)
+		}
+		if err == nil && (got.UserID != claims.UserID || got.SessionID != claims.SessionID) {
+			t.Fatalf("%s: claims for user %s session %s, want %s session %s",
+				step.name, got.UserID, got.SessionID, claims.UserID, claims.SessionID)
+		}
+	}
+}
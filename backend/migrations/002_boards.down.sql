@@ -0,0 +1,17 @@
+DROP INDEX IF EXISTS idx_events_board_created;
+
+DELETE FROM tile_events WHERE board_id <> 'default';
+DELETE FROM tiles WHERE board_id <> 'default';
+
+ALTER TABLE tile_events DROP CONSTRAINT tile_events_tile_fkey;
+ALTER TABLE tiles DROP CONSTRAINT tiles_board_x_y_key;
+ALTER TABLE tiles DROP CONSTRAINT tiles_pkey;
+ALTER TABLE tiles ADD PRIMARY KEY (id);
+ALTER TABLE tiles ADD CONSTRAINT tiles_x_y_key UNIQUE (x, y);
+ALTER TABLE tile_events ADD CONSTRAINT tile_events_tile_id_fkey
+    FOREIGN KEY (tile_id) REFERENCES tiles(id);
+
+ALTER TABLE tile_events DROP COLUMN board_id;
+ALTER TABLE tiles DROP COLUMN board_id;
+
+DROP TABLE IF EXISTS boards;
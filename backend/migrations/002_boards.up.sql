@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS boards (
+    id          VARCHAR(32) PRIMARY KEY,
+    name        VARCHAR(64) NOT NULL,
+    width       INTEGER NOT NULL CHECK (width > 0),
+    height      INTEGER NOT NULL CHECK (height > 0),
+    created_by  UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Guarded so databases already upgraded by the old built-in schema list are left alone.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'tiles' AND column_name = 'board_id'
+    ) THEN
+        INSERT INTO boards (id, name, width, height)
+        SELECT 'default', 'Default', MAX(x) + 1, MAX(y) + 1
+        FROM tiles
+        HAVING COUNT(*) > 0
+        ON CONFLICT (id) DO NOTHING;
+
+        ALTER TABLE tiles ADD COLUMN board_id VARCHAR(32) NOT NULL DEFAULT 'default'
+            REFERENCES boards(id) ON DELETE CASCADE;
+        ALTER TABLE tile_events ADD COLUMN board_id VARCHAR(32) NOT NULL DEFAULT 'default';
+
+        ALTER TABLE tile_events DROP CONSTRAINT tile_events_tile_id_fkey;
+        ALTER TABLE tiles DROP CONSTRAINT tiles_pkey;
+        ALTER TABLE tiles DROP CONSTRAINT tiles_x_y_key;
+        ALTER TABLE tiles ADD PRIMARY KEY (board_id, id);
+        ALTER TABLE tiles ADD CONSTRAINT tiles_board_x_y_key UNIQUE (board_id, x, y);
+        ALTER TABLE tile_events ADD CONSTRAINT tile_events_tile_fkey
+            FOREIGN KEY (board_id, tile_id) REFERENCES tiles(board_id, id) ON DELETE CASCADE;
+
+        ALTER TABLE tiles ALTER COLUMN board_id DROP DEFAULT;
+        ALTER TABLE tile_events ALTER COLUMN board_id DROP DEFAULT;
+    END IF;
+END
+$$;
+
+CREATE INDEX IF NOT EXISTS idx_events_board_created ON tile_events(board_id, created_at DESC);
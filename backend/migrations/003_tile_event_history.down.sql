@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_events_board_id;
+DROP INDEX IF EXISTS idx_events_board_tile;
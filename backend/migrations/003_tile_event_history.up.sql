@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_events_board_tile ON tile_events(board_id, tile_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_events_board_id ON tile_events(board_id, id);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS board_chunks (
+    board_id  VARCHAR(32) NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+    cx        INTEGER NOT NULL,
+    cy        INTEGER NOT NULL,
+    version   BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (board_id, cx, cy)
+);
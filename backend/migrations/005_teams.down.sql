@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_users_team;
+ALTER TABLE users DROP COLUMN IF EXISTS team_id;
+DROP TABLE IF EXISTS teams;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS season_team_standings;
+DROP TABLE IF EXISTS season_standings;
+DROP TABLE IF EXISTS season_tiles;
+DROP TABLE IF EXISTS seasons;
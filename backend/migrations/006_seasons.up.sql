@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS seasons (
+    id          BIGSERIAL PRIMARY KEY,
+    board_id    VARCHAR(32) NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+    number      INTEGER NOT NULL,
+    starts_at   TIMESTAMPTZ NOT NULL,
+    ends_at     TIMESTAMPTZ NOT NULL,
+    ended_at    TIMESTAMPTZ,
+    UNIQUE (board_id, number)
+);
+
+-- At most one running season per board.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_seasons_board_current ON seasons(board_id) WHERE ended_at IS NULL;
+
+-- Archives keep names and colors as they were when the season ended, so
+-- they carry no foreign keys to users or teams.
+CREATE TABLE IF NOT EXISTS season_tiles (
+    season_id        BIGINT NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+    tile_id          INTEGER NOT NULL,
+    x                INTEGER NOT NULL,
+    y                INTEGER NOT NULL,
+    owner_id         UUID NOT NULL,
+    owner_username   VARCHAR(32) NOT NULL,
+    owner_color      CHAR(7) NOT NULL,
+    owner_team_id    UUID,
+    owner_team_name  VARCHAR(32),
+    claimed_at       TIMESTAMPTZ,
+    PRIMARY KEY (season_id, tile_id)
+);
+
+CREATE TABLE IF NOT EXISTS season_standings (
+    season_id   BIGINT NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+    user_id     UUID NOT NULL,
+    username    VARCHAR(32) NOT NULL,
+    color       CHAR(7) NOT NULL,
+    tile_count  INTEGER NOT NULL,
+    rank        INTEGER NOT NULL,
+    PRIMARY KEY (season_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_season_standings_rank ON season_standings(season_id, rank);
+
+CREATE TABLE IF NOT EXISTS season_team_standings (
+    season_id   BIGINT NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+    team_id     UUID NOT NULL,
+    name        VARCHAR(32) NOT NULL,
+    color       CHAR(7),
+    tile_count  INTEGER NOT NULL,
+    rank        INTEGER NOT NULL,
+    PRIMARY KEY (season_id, team_id)
+);
@@ -0,0 +1,15 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS banned_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS ban_reason TEXT;
+
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    admin_id    UUID REFERENCES users(id) ON DELETE SET NULL,
+    action      VARCHAR(32) NOT NULL,
+    board_id    VARCHAR(32),
+    target      TEXT,
+    details     JSONB NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_created ON admin_audit_log(created_at DESC);
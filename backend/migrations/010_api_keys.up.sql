@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id          UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name             VARCHAR(64) NOT NULL,
+    prefix           VARCHAR(16) NOT NULL,
+    key_hash         CHAR(64) NOT NULL UNIQUE,
+    scopes           TEXT[] NOT NULL,
+    rate_per_minute  INT NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at     TIMESTAMPTZ,
+    revoked_at       TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys(user_id);
@@ -3,37 +3,118 @@ import { useState } from 'react';
 import { useUser } from '../../hooks/useUser';
 import { useUIStore } from '../../store/uiStore';
 
+type Mode = 'register' | 'login' | 'recover';
+
+const inputClass =
+  'mt-3 w-full rounded-xl border border-black/20 bg-white px-4 py-3 text-sm text-black placeholder:text-black/40 focus:border-black focus:outline-none';
+
 export const UsernameModal = () => {
-  const { register, isLoading } = useUser();
+  const { register, login, recover, isLoading } = useUser();
   const show = useUIStore((state) => state.showUsernameModal);
+  const [mode, setMode] = useState<Mode>('register');
   const [username, setUsername] = useState('');
+  const [password, setPassword] = useState('');
+  const [recoveryCode, setRecoveryCode] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+
+  if (recoveryCodes.length > 0) {
+    return (
+      <div className="fixed inset-0 z-40 flex items-center justify-center bg-black/80 px-4">
+        <div className="w-full max-w-md rounded-2xl border border-black/10 bg-white p-6 shadow-xl">
+          <p className="text-xs uppercase tracking-[0.3em] text-black/60">Recovery codes</p>
+          <h2 className="mt-2 text-2xl font-semibold text-black">Save these somewhere safe</h2>
+          <p className="mt-2 text-sm text-black/60">
+            Each code gets you back into this account once if you lose this browser. They won't be shown again.
+          </p>
+          <ul className="mt-4 grid grid-cols-2 gap-2 font-mono text-sm text-black">
+            {recoveryCodes.map((code) => (
+              <li key={code}>{code}</li>
+            ))}
+          </ul>
+          <button
+            type="button"
+            onClick={() => setRecoveryCodes([])}
+            className="mt-4 w-full rounded-xl bg-black px-4 py-3 text-sm font-semibold text-white transition hover:bg-black/80"
+          >
+            I've saved them
+          </button>
+        </div>
+      </div>
+    );
+  }
 
   if (!show) return null;
 
+  const submit = async () => {
+    if (mode === 'register') {
+      setRecoveryCodes(await register(username, password));
+    } else if (mode === 'login') {
+      await login(username, password);
+    } else {
+      await recover(username, recoveryCode, password);
+    }
+  };
+
+  const canSubmit =
+    username.trim().length >= 2 &&
+    (mode !== 'login' || password.length > 0) &&
+    (mode !== 'recover' || recoveryCode.trim().length > 0);
+
   return (
     <div className="fixed inset-0 z-40 flex items-center justify-center bg-black/80 px-4">
       <div className="w-full max-w-md rounded-2xl border border-black/10 bg-white p-6 shadow-xl">
         <p className="text-xs uppercase tracking-[0.3em] text-black/60">Welcome</p>
-        <h2 className="mt-2 text-2xl font-semibold text-black">Pick a username</h2>
+        <h2 className="mt-2 text-2xl font-semibold text-black">
+          {mode === 'register' ? 'Pick a username' : mode === 'login' ? 'Sign in' : 'Recover your account'}
+        </h2>
         <p className="mt-2 text-sm text-black/60">
-          This will be visible on the grid. Keep it short.
+          {mode === 'register'
+            ? 'This will be visible on the grid. Keep it short. A password is optional but lets you sign in elsewhere.'
+            : mode === 'login'
+              ? 'Use the password you set for your username.'
+              : 'Enter one of your recovery codes. You can set a new password at the same time.'}
         </p>
 
         <input
           value={username}
           onChange={(event) => setUsername(event.target.value)}
           placeholder="PixelKing"
-          className="mt-4 w-full rounded-xl border border-black/20 bg-white px-4 py-3 text-sm text-black placeholder:text-black/40 focus:border-black focus:outline-none"
+          className={inputClass}
+        />
+        {mode === 'recover' && (
+          <input
+            value={recoveryCode}
+            onChange={(event) => setRecoveryCode(event.target.value)}
+            placeholder="xxxxx-xxxxx"
+            className={inputClass}
+          />
+        )}
+        <input
+          type="password"
+          value={password}
+          onChange={(event) => setPassword(event.target.value)}
+          placeholder={mode === 'login' ? 'Password' : mode === 'recover' ? 'New password (optional)' : 'Password (optional)'}
+          className={inputClass}
         />
 
         <button
           type="button"
-          onClick={() => register(username)}
-          disabled={isLoading || username.trim().length < 2}
+          onClick={submit}
+          disabled={isLoading || !canSubmit}
           className="mt-4 w-full rounded-xl bg-black px-4 py-3 text-sm font-semibold text-white transition hover:bg-black/80 disabled:cursor-not-allowed disabled:bg-black/40"
         >
-          {isLoading ? 'Creating...' : 'Enter the grid'}
+          {isLoading ? 'Working...' : mode === 'register' ? 'Enter the grid' : 'Sign in'}
         </button>
+
+        <div className="mt-4 flex justify-between text-xs text-black/60">
+          {(['register', 'login', 'recover'] as const)
+            .filter((option) => option !== mode)
+            .map((option) => (
+              <button key={option} type="button" onClick={() => setMode(option)} className="underline">
+                {option === 'register' ? 'New here' : option === 'login' ? 'I have a password' : 'Use a recovery code'}
+              </button>
+            ))}
+        </div>
       </div>
     </div>
   );
@@ -1,11 +1,36 @@
 import { useCallback, useEffect, useState } from 'react';
 
-import { registerUser } from '../services/api';
-import { loadUser, saveUser } from '../services/storage';
+import { loginUser, recoverAccount, refreshSession, registerUser } from '../services/api';
+import type { RegisterResponse } from '../services/api';
+import { clearUser, loadUser, saveUser } from '../services/storage';
 import { useUserStore } from '../store/userStore';
 import { useUIStore } from '../store/uiStore';
 import type { User } from '../types/user';
 
+const refreshLeewayMs = 60_000;
+
+const toUser = (response: RegisterResponse): User => ({
+  id: response.id,
+  username: response.username,
+  color: response.color,
+  createdAt: response.createdAt,
+  lastSeen: response.lastSeen,
+  token: response.token,
+  tokenExpiresAt: response.tokenExpiresAt,
+  refreshToken: response.refreshToken,
+});
+
+const persist = (user: User) => {
+  saveUser({
+    id: user.id,
+    username: user.username,
+    color: user.color,
+    token: user.token,
+    tokenExpiresAt: user.tokenExpiresAt,
+    refreshToken: user.refreshToken,
+  });
+};
+
 export const useUser = () => {
   const { currentUser, setUser } = useUserStore();
   const { setShowUsernameModal, addToast } = useUIStore();
@@ -21,6 +46,8 @@ export const useUser = () => {
           createdAt: new Date().toISOString(),
           lastSeen: new Date().toISOString(),
           token: stored.token,
+          tokenExpiresAt: stored.tokenExpiresAt,
+          refreshToken: stored.refreshToken,
         };
         setUser(user);
         setShowUsernameModal(false);
@@ -29,25 +56,37 @@ export const useUser = () => {
       }
     }, [setUser, setShowUsernameModal]);
 
+  // Access tokens are short-lived: trade the refresh token for a new pair a
+  // minute before the current one expires (or straight away if it already
+  // has). A rejected refresh token means the session is gone.
+  useEffect(() => {
+    const refreshToken = currentUser?.refreshToken;
+    if (!refreshToken) return;
+    const expiresAt = currentUser?.tokenExpiresAt ? new Date(currentUser.tokenExpiresAt).getTime() : 0;
+    const delay = Math.max(0, expiresAt - Date.now() - refreshLeewayMs);
+    const timer = window.setTimeout(() => {
+      refreshSession(refreshToken)
+        .then((response) => {
+          const user = toUser(response);
+          persist(user);
+          setUser(user);
+        })
+        .catch(() => {
+          clearUser();
+          setUser(null);
+          setShowUsernameModal(true);
+        });
+    }, delay);
+    return () => window.clearTimeout(timer);
+  }, [currentUser?.refreshToken, currentUser?.tokenExpiresAt, setUser, setShowUsernameModal]);
+
   const register = useCallback(
-    async (username: string) => {
+    async (username: string, password?: string): Promise<string[]> => {
       setIsLoading(true);
       try {
-        const response = await registerUser(username);
-        const user: User = {
-          id: response.id,
-          username: response.username,
-          color: response.color,
-          createdAt: response.createdAt,
-          lastSeen: response.lastSeen,
-          token: response.token,
-        };
-        saveUser({
-          id: response.id,
-          username: response.username,
-          color: response.color,
-          token: response.token,
-        });
+        const response = await registerUser(username, password || undefined);
+        const user = toUser(response);
+        persist(user);
         setUser(user);
         setShowUsernameModal(false);
         addToast({
@@ -55,12 +94,14 @@ export const useUser = () => {
           message: `Welcome, ${user.username}!`,
           type: 'success',
         });
+        return response.recoveryCodes ?? [];
       } catch {
         addToast({
           id: `register-${Date.now()}`,
           message: 'Username already taken or invalid',
           type: 'error',
         });
+        return [];
       } finally {
         setIsLoading(false);
       }
@@ -68,5 +109,46 @@ export const useUser = () => {
     [addToast, setShowUsernameModal, setUser]
   );
 
-  return { currentUser, isLoading, register };
+  const signIn = useCallback(
+    async (request: () => Promise<RegisterResponse>, failure: string) => {
+      setIsLoading(true);
+      try {
+        const user = toUser(await request());
+        persist(user);
+        setUser(user);
+        setShowUsernameModal(false);
+        addToast({
+          id: `welcome-${Date.now()}`,
+          message: `Welcome back, ${user.username}!`,
+          type: 'success',
+        });
+      } catch {
+        addToast({
+          id: `signin-${Date.now()}`,
+          message: failure,
+          type: 'error',
+        });
+      } finally {
+        setIsLoading(false);
+      }
+    },
+    [addToast, setShowUsernameModal, setUser]
+  );
+
+  const login = useCallback(
+    (username: string, password: string) =>
+      signIn(() => loginUser(username, password), 'Wrong username or password'),
+    [signIn]
+  );
+
+  const recover = useCallback(
+    (username: string, recoveryCode: string, newPassword?: string) =>
+      signIn(
+        () => recoverAccount(username, recoveryCode, newPassword || undefined),
+        'Recovery code not valid for that username'
+      ),
+    [signIn]
+  );
+
+  return { currentUser, isLoading, register, login, recover };
 };
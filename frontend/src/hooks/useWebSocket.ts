@@ -1,5 +1,6 @@
 import { useCallback, useEffect, useRef } from 'react';
 
+import { fetchWSTicket } from '../services/api';
 import { WebSocketService } from '../services/websocket';
 import { useBoardStore } from '../store/boardStore';
 import { useUserStore } from '../store/userStore';
@@ -12,6 +13,8 @@ import type {
   InitBoardPayload,
   LeaderboardUpdatePayload,
   PongPayload,
+  RegionResetPayload,
+  SystemAnnouncementPayload,
   TileClaimedPayload,
   UserJoinedPayload,
   UserLeftPayload,
@@ -22,7 +25,7 @@ const claimSoundUrl = '/assets/sounds/claim.mp3';
 
 export const useWebSocket = () => {
   const wsRef = useRef<WebSocketService | null>(null);
-  const { initBoard, applyTileClaimed, revertOptimisticClaim } = useBoardStore();
+  const { initBoard, applyTileClaimed, applyRegionReset, revertOptimisticClaim } = useBoardStore();
   const currentUser = useUserStore((s) => s.currentUser);
   const setLeaderboard = useUserStore((s) => s.setLeaderboard);
   const setOnlineUsers = useUserStore((s) => s.setOnlineUsers);
@@ -36,6 +39,7 @@ export const useWebSocket = () => {
     currentUser,
     initBoard,
     applyTileClaimed,
+    applyRegionReset,
     revertOptimisticClaim,
     setLeaderboard,
     setOnlineUsers,
@@ -50,6 +54,7 @@ export const useWebSocket = () => {
       currentUser,
       initBoard,
       applyTileClaimed,
+      applyRegionReset,
       revertOptimisticClaim,
       setLeaderboard,
       setOnlineUsers,
@@ -66,6 +71,7 @@ export const useWebSocket = () => {
     const {
       initBoard,
       applyTileClaimed,
+      applyRegionReset,
       revertOptimisticClaim,
       setLeaderboard,
       setOnlineUsers,
@@ -79,10 +85,12 @@ export const useWebSocket = () => {
     const normalizedBase = wsBase.startsWith('http') ? wsBase.replace(/^http/, 'ws') : wsBase;
     const wsUrl = new URL('/ws', normalizedBase);
     wsUrl.searchParams.set('userId', currentUser.id);
-    if (currentUser.token) {
-      wsUrl.searchParams.set('token', currentUser.token);
-    }
-    const ws = new WebSocketService(wsUrl.toString(), setStatus);
+    // Tickets are fetched with whatever access token is current at the time,
+    // so refreshing it doesn't need a reconnect.
+    const ws = new WebSocketService(wsUrl.toString(), setStatus, () => {
+      const token = refs.current.currentUser?.token;
+      return token ? fetchWSTicket(token) : Promise.reject(new Error('not signed in'));
+    });
     wsRef.current = ws;
 
     optimisticallyAddUser({
@@ -128,7 +136,13 @@ export const useWebSocket = () => {
           ? 'Too slow! Someone else got there first.'
           : payload.reason === 'INVALID_TILE'
             ? 'Invalid tile.'
-            : 'Server error while claiming tile.';
+            : payload.reason === 'TILE_PROTECTED'
+              ? 'That tile was just claimed and is still protected.'
+              : payload.reason === 'NOT_ADJACENT'
+                ? 'You can only capture tiles next to your own.'
+                : payload.reason === 'RATE_LIMITED'
+                  ? `Slow down! Try again in ${Math.ceil((payload.retryAfterMs ?? 1000) / 1000)}s.`
+                  : 'Server error while claiming tile.';
       addToast({
         id: `${payload.tileId}-${Date.now()}`,
         message,
@@ -173,6 +187,18 @@ export const useWebSocket = () => {
       setLeaderboard(ranked);
     });
 
+    ws.on<RegionResetPayload>('REGION_RESET', ({ payload }) => {
+      applyRegionReset(payload);
+    });
+
+    ws.on<SystemAnnouncementPayload>('SYSTEM_ANNOUNCEMENT', ({ payload }) => {
+      addToast({
+        id: `announce-${Date.now()}`,
+        message: payload.message,
+        type: 'info',
+      });
+    });
+
     ws.on<ErrorPayload>('ERROR', ({ payload }) => {
       addToast({
         id: `err-${payload.code}-${Date.now()}`,
@@ -190,7 +216,7 @@ export const useWebSocket = () => {
       ws.disconnect();
       setSender(null);
     };
-  }, [currentUser?.id, currentUser?.token]);
+  }, [currentUser?.id]);
 
   const claimTile = useCallback((tileId: number) => {
     wsRef.current?.send('CLAIM_TILE', { tileId });
@@ -12,13 +12,46 @@ const api = axios.create({
 
 export interface RegisterResponse extends User {
   token: string;
+  tokenExpiresAt: string;
+  refreshToken: string;
+  recoveryCodes?: string[];
 }
 
-export const registerUser = async (username: string): Promise<RegisterResponse> => {
-  const response = await api.post('/api/users/register', { username });
+export const registerUser = async (username: string, password?: string): Promise<RegisterResponse> => {
+  const response = await api.post('/api/users/register', { username, password });
   return response.data as RegisterResponse;
 };
 
+export const loginUser = async (username: string, password: string): Promise<RegisterResponse> => {
+  const response = await api.post('/api/auth/login', { username, password });
+  return response.data as RegisterResponse;
+};
+
+export const recoverAccount = async (
+  username: string,
+  recoveryCode: string,
+  newPassword?: string
+): Promise<RegisterResponse> => {
+  const response = await api.post('/api/auth/recover', { username, recoveryCode, newPassword });
+  return response.data as RegisterResponse;
+};
+
+export const refreshSession = async (refreshToken: string): Promise<RegisterResponse> => {
+  const response = await api.post('/api/auth/refresh', { refreshToken });
+  return response.data as RegisterResponse;
+};
+
+export const fetchWSTicket = async (token: string): Promise<string> => {
+  const response = await api.post('/api/ws/ticket', null, {
+    headers: { Authorization: `Bearer ${token}` },
+  });
+  return (response.data as { ticket: string }).ticket;
+};
+
+export const logout = async (refreshToken?: string): Promise<void> => {
+  await api.post('/api/auth/logout', { refreshToken });
+};
+
 export const fetchBoard = async (): Promise<{
   tiles: Tile[];
   gridWidth: number;
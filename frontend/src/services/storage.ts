@@ -5,6 +5,8 @@ export interface StoredUser {
   username: string;
   color: string;
   token?: string;
+  tokenExpiresAt?: string;
+  refreshToken?: string;
 }
 
 export const saveUser = (user: StoredUser): void => {
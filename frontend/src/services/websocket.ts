@@ -1,4 +1,4 @@
-import type { WSMessage } from '../types/ws';
+import type { BatchPayload, WSMessage } from '../types/ws';
 
 type MessageHandler = (msg: WSMessage) => void;
 
@@ -10,16 +10,47 @@ export class WebSocketService {
   private maxReconnectAttempts = 10;
   private reconnectDelay = 1000;
   private heartbeatInterval: ReturnType<typeof setInterval> | null = null;
+  private lastSeq: number | null = null;
   private onStatusChange?: (status: 'Connecting' | 'Connected' | 'Disconnected') => void;
+  private getTicket?: () => Promise<string>;
+  private closed = false;
 
-  constructor(url: string, onStatusChange?: typeof this.onStatusChange) {
+  constructor(
+    url: string,
+    onStatusChange?: typeof this.onStatusChange,
+    getTicket?: () => Promise<string>
+  ) {
     this.url = url;
     this.onStatusChange = onStatusChange;
+    this.getTicket = getTicket;
   }
 
   connect(): void {
     this.onStatusChange?.('Connecting');
-    this.ws = new WebSocket(this.url);
+    const url = new URL(this.url);
+    url.searchParams.set('batch', '1');
+    if (this.lastSeq !== null) {
+      url.searchParams.set('lastSeq', String(this.lastSeq));
+    }
+    if (!this.getTicket) {
+      this.open(url);
+      return;
+    }
+    // Tickets are single-use, so every attempt fetches a fresh one.
+    this.getTicket()
+      .then((ticket) => {
+        if (this.closed) return;
+        url.searchParams.set('ticket', ticket);
+        this.open(url);
+      })
+      .catch(() => {
+        this.onStatusChange?.('Disconnected');
+        this.scheduleReconnect();
+      });
+  }
+
+  private open(url: URL): void {
+    this.ws = new WebSocket(url.toString());
 
     this.ws.onopen = () => {
       this.reconnectAttempts = 0;
@@ -31,7 +62,24 @@ export class WebSocketService {
     this.ws.onmessage = (event: MessageEvent) => {
       try {
         const msg: WSMessage = JSON.parse(event.data);
-        this.dispatch(msg);
+        const messages =
+          msg.type === 'BATCH' ? (msg.payload as BatchPayload).messages : [msg];
+        for (const inner of messages) {
+          if (inner.type === 'RESYNC_REQUIRED') {
+            // Events were dropped server-side; reconnect for a fresh INIT_BOARD.
+            this.lastSeq = null;
+            this.ws?.close();
+            return;
+          }
+          if (!this.trackSeq(inner)) continue;
+          this.dispatch(inner);
+          if (inner.type === 'SEASON_ENDED') {
+            // The board was reset; reconnect for the new season's INIT_BOARD.
+            this.lastSeq = null;
+            this.ws?.close();
+            return;
+          }
+        }
       } catch (error) {
         console.error('WS parse error:', error);
       }
@@ -63,6 +111,26 @@ export class WebSocketService {
     return () => this.handlers.get(type)?.delete(handler as MessageHandler);
   }
 
+  // Returns false for broadcasts that were already applied.
+  private trackSeq(msg: WSMessage): boolean {
+    if (msg.type === 'INIT_BOARD') {
+      const seq = (msg.payload as { seq?: number }).seq;
+      this.lastSeq = typeof seq === 'number' ? seq : null;
+      return true;
+    }
+    if (msg.type === 'VIEWPORT_SNAPSHOT') {
+      const seq = (msg.payload as { seq?: number }).seq;
+      if (typeof seq === 'number' && (this.lastSeq === null || seq > this.lastSeq)) {
+        this.lastSeq = seq;
+      }
+      return true;
+    }
+    if (typeof msg.seq !== 'number') return true;
+    if (this.lastSeq !== null && msg.seq <= this.lastSeq) return false;
+    this.lastSeq = msg.seq;
+    return true;
+  }
+
   private dispatch(msg: WSMessage): void {
     this.handlers.get(msg.type)?.forEach((handler) => handler(msg));
     this.handlers.get('*')?.forEach((handler) => handler(msg));
@@ -92,6 +160,7 @@ export class WebSocketService {
   }
 
   disconnect(): void {
+    this.closed = true;
     this.maxReconnectAttempts = 0;
     this.ws?.close();
   }
@@ -3,7 +3,7 @@ import { immer } from 'zustand/middleware/immer';
 import { enableMapSet } from "immer";
 
 import type { Tile, TileMap } from '../types/tile';
-import type { TileClaimedPayload } from '../types/ws';
+import type { RegionResetPayload, TileClaimedPayload } from '../types/ws';
 
 enableMapSet();
 
@@ -18,6 +18,7 @@ interface BoardState {
   lastActivity: string | null;
   initBoard: (tiles: Tile[], gridWidth: number, gridHeight: number) => void;
   applyTileClaimed: (payload: TileClaimedPayload) => void;
+  applyRegionReset: (payload: RegionResetPayload) => void;
   optimisticallyClaimTile: (tileId: number, userId: string, color: string) => void;
   revertOptimisticClaim: (tileId: number) => void;
   getLastActivity: () => string | null;
@@ -56,6 +57,8 @@ export const useBoardStore = create<BoardState>()(
           existing.ownerId = payload.userId;
           existing.ownerUsername = payload.username;
           existing.ownerColor = payload.color;
+          existing.ownerTeamId = payload.teamId ?? undefined;
+          existing.ownerTeamName = payload.teamName ?? undefined;
           existing.claimedAt = payload.claimedAt;
           state.lastActivity = payload.claimedAt;
         }
@@ -66,6 +69,23 @@ export const useBoardStore = create<BoardState>()(
         state.pendingClaims = newPending;
       }),
 
+    applyRegionReset: (payload) =>
+      set((state) => {
+        for (let y = payload.y; y < payload.y + payload.h; y++) {
+          for (let x = payload.x; x < payload.x + payload.w; x++) {
+            const tile = state.tiles.get(y * state.gridWidth + x);
+            if (tile) {
+              tile.ownerId = null;
+              tile.ownerUsername = null;
+              tile.ownerColor = null;
+              tile.ownerTeamId = undefined;
+              tile.ownerTeamName = undefined;
+              tile.claimedAt = null;
+            }
+          }
+        }
+      }),
+
     optimisticallyClaimTile: (tileId, userId, color) =>
       set((state) => {
         const newPending = new Set(state.pendingClaims);
@@ -5,6 +5,8 @@ export interface Tile {
   ownerId: string | null;
   ownerUsername: string | null;
   ownerColor: string | null;
+  ownerTeamId?: string;
+  ownerTeamName?: string;
   claimedAt: string | null;
 }
 
@@ -2,9 +2,13 @@ export interface User {
   id: string;
   username: string;
   color: string;
+  teamId?: string;
+  role?: string;
   createdAt: string;
   lastSeen: string;
   token?: string;
+  tokenExpiresAt?: string;
+  refreshToken?: string;
 }
 
 export interface LeaderboardEntry {
@@ -15,3 +19,11 @@ export interface LeaderboardEntry {
   rank: number;
   optimisticDelta?: number;
 }
+
+export interface TeamLeaderboardEntry {
+  teamId: string;
+  name: string;
+  color: string | null;
+  tileCount: number;
+  rank: number;
+}
@@ -1,5 +1,5 @@
 import type { Tile } from './tile';
-import type { User, LeaderboardEntry } from './user';
+import type { User, LeaderboardEntry, TeamLeaderboardEntry } from './user';
 
 export type WSMessageType =
   | 'INIT_BOARD'
@@ -9,10 +9,19 @@ export type WSMessageType =
   | 'USER_LEFT'
   | 'LEADERBOARD_UPDATE'
   | 'ERROR'
+  | 'RESUMED'
+  | 'VIEWPORT_SNAPSHOT'
+  | 'BATCH'
+  | 'RESYNC_REQUIRED'
+  | 'SEASON_ENDED'
+  | 'SEASON_STARTED'
+  | 'REGION_RESET'
+  | 'SYSTEM_ANNOUNCEMENT'
   | 'PING'
   | 'PONG';
 
 export interface WSMessage<T = unknown> {
+  seq?: number;
   type: WSMessageType;
   payload: T;
   timestamp?: string;
@@ -27,15 +36,34 @@ export interface TileClaimedPayload {
   color: string;
   claimedAt: string;
   previousOwner: string | null;
+  chunkVersion?: number;
+  teamId?: string | null;
+  teamName?: string | null;
 }
 
 export interface ClaimRejectedPayload {
   tileId: number;
-  reason: 'ALREADY_CLAIMED' | 'INVALID_TILE' | 'SERVER_ERROR';
+  reason:
+    | 'ALREADY_CLAIMED'
+    | 'INVALID_TILE'
+    | 'TILE_PROTECTED'
+    | 'NOT_ADJACENT'
+    | 'RATE_LIMITED'
+    | 'SERVER_ERROR';
   retryAfterMs?: number;
 }
 
+export interface Viewport {
+  x: number;
+  y: number;
+  w: number;
+  h: number;
+}
+
 export interface InitBoardPayload {
+  boardId?: string;
+  seq?: number;
+  viewport?: Viewport;
   tiles: Tile[];
   user: User;
   onlineCount: number;
@@ -43,6 +71,26 @@ export interface InitBoardPayload {
   gridHeight?: number;
 }
 
+export interface ResumedPayload {
+  boardId: string;
+  fromSeq: number;
+  toSeq: number;
+  missed: number;
+  user: User;
+  onlineCount: number;
+}
+
+export interface ViewportSnapshotPayload {
+  boardId: string;
+  seq: number;
+  viewport: Viewport;
+  tiles: Tile[];
+}
+
+export interface BatchPayload {
+  messages: WSMessage[];
+}
+
 export interface UserJoinedPayload {
   userId: string;
   username: string;
@@ -58,6 +106,40 @@ export interface UserLeftPayload {
 
 export interface LeaderboardUpdatePayload {
   leaderboard: LeaderboardEntry[];
+  teams?: TeamLeaderboardEntry[];
+}
+
+export interface Season {
+  id: number;
+  boardId: string;
+  number: number;
+  startsAt: string;
+  endsAt: string;
+  endedAt?: string;
+  winners?: LeaderboardEntry[];
+  winningTeams?: TeamLeaderboardEntry[];
+}
+
+export interface SeasonEndedPayload {
+  season: Season;
+  leaderboard: LeaderboardEntry[];
+  teams: TeamLeaderboardEntry[];
+}
+
+export interface SeasonStartedPayload {
+  season: Season;
+}
+
+export interface RegionResetPayload {
+  x: number;
+  y: number;
+  w: number;
+  h: number;
+  tiles: number;
+}
+
+export interface SystemAnnouncementPayload {
+  message: string;
 }
 
 export interface ErrorPayload {